@@ -0,0 +1,222 @@
+//go:build byzantine
+
+package internal
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"go.uber.org/zap"
+)
+
+// misbehaviour modes of the node, set by byzantine config key (comma separated)
+const (
+	byzantineEquivocate   = "equivocate"    // send conflicting consensus messages and blocks to different peers
+	byzantinePhantomVotes = "phantom_votes" // vote for txs which do not exist
+	byzantineBadParent    = "bad_parent"    // propose blocks with wrong previous block hash
+	byzantineWithhold     = "withhold"      // do not send votes and blocks
+	byzantineReplay       = "replay"        // resend consensus messages of old rounds
+)
+
+// faulty validator for testing, messages are changed before broadcasting
+type byzantine struct {
+	mu    sync.Mutex
+	modes map[string]bool
+	rand  *rand.Rand
+	sent  []*models.ConsensusMessage // sent consensus messages, replayed later
+}
+
+func (s *InternalService) newByzantine() (*byzantine, error) {
+	config := s.GlobalService.GetConfig("byzantine", "").(string)
+	if config == "" {
+		return nil, nil
+	}
+	b := &byzantine{
+		modes: make(map[string]bool),
+		rand:  rand.New(rand.NewSource(int64(s.GlobalService.GetConfig("byzantine_seed", 0).(int)))),
+	}
+	for _, mode := range strings.Split(config, ",") {
+		mode = strings.TrimSpace(mode)
+		switch mode {
+		case byzantineEquivocate, byzantinePhantomVotes, byzantineBadParent, byzantineWithhold, byzantineReplay:
+			b.modes[mode] = true
+		default:
+			return nil, fmt.Errorf("unknown byzantine mode : %s", mode)
+		}
+	}
+	s.GlobalService.Logger.Warn("byzantine - node is faulty", zap.String("modes", config))
+	return b, nil
+}
+
+// send message instead of broadcastMsg, sent = false if message should be broadcasted as usual
+func (s *InternalService) misbehave(msg interface{}) (sent bool, err error) {
+	b := s.byzantine
+	if b == nil {
+		return false, nil
+	}
+	switch m := msg.(type) {
+	case *models.ConsensusMessage:
+		return true, b.sendConsensusMsg(s, m)
+	case *models.BlockConsensusMessage:
+		return true, b.sendBlock(s, m)
+	default:
+		return false, nil
+	}
+}
+
+func (b *byzantine) sendConsensusMsg(s *InternalService, msg *models.ConsensusMessage) error {
+	if b.modes[byzantineWithhold] {
+		return nil
+	}
+
+	if b.modes[byzantinePhantomVotes] {
+		phantom := *msg
+		phantom.Messages = append(append([]string{}, msg.Messages...), b.fakeHash(), b.fakeHash())
+		err := s.resignConsensusMsg(&phantom)
+		if err != nil {
+			return err
+		}
+		msg = &phantom
+	}
+
+	if b.modes[byzantineEquivocate] {
+		conflicting := *msg
+		conflicting.Messages = []string{b.fakeHash()}
+		err := s.resignConsensusMsg(&conflicting)
+		if err != nil {
+			return err
+		}
+		err = b.split(s, msg, &conflicting)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := s.Transport.Broadcast(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.modes[byzantineReplay] {
+		b.mu.Lock()
+		var old *models.ConsensusMessage
+		if len(b.sent) > 0 {
+			old = b.sent[b.rand.Intn(len(b.sent))]
+		}
+		b.sent = append(b.sent, msg)
+		b.mu.Unlock()
+		if old != nil {
+			return s.Transport.Broadcast(old)
+		}
+	}
+	return nil
+}
+
+func (b *byzantine) sendBlock(s *InternalService, msg *models.BlockConsensusMessage) error {
+	if b.modes[byzantineWithhold] {
+		return nil
+	}
+
+	if b.modes[byzantineBadParent] {
+		bad := copyBlock(msg)
+		bad.Block.PreviousBlockHash = b.fakeHash()
+		err := s.resignBlock(bad)
+		if err != nil {
+			return err
+		}
+		msg = bad
+	}
+
+	if b.modes[byzantineEquivocate] {
+		conflicting := copyBlock(msg)
+		conflicting.Block.Messages = make(map[string]*models.Tx)
+		err := s.resignBlock(conflicting)
+		if err != nil {
+			return err
+		}
+		return b.split(s, msg, conflicting)
+	}
+	return s.Transport.Broadcast(msg)
+}
+
+// send one message to half of peers and another message to the rest
+func (b *byzantine) split(s *InternalService, first, second interface{}) error {
+	peers, err := s.Transport.Peers()
+	if err != nil {
+		return err
+	}
+	for i, peer := range peers {
+		msg := first
+		if i%2 == 1 {
+			msg = second
+		}
+		err = s.Transport.SendTo(peer, msg)
+		if err != nil {
+			s.GlobalService.Logger.Error("byzantine - send to peer", zap.String("peer", peer), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (b *byzantine) fakeHash() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hash := make([]byte, 32)
+	b.rand.Read(hash)
+	return hex.EncodeToString(hash)
+}
+
+func copyBlock(msg *models.BlockConsensusMessage) *models.BlockConsensusMessage {
+	block := *msg.Block
+	block.Messages = make(map[string]*models.Tx, len(msg.Block.Messages))
+	for hash, tx := range msg.Block.Messages {
+		block.Messages[hash] = tx
+	}
+	c := *msg
+	c.Block = &block
+	c.Signatures = nil
+	return &c
+}
+
+// faulty node signs by its key directly, it works only with native signer
+// remote signer refuses consensus payloads without step, so byzantine modes can't make it double sign
+func (s *InternalService) resignConsensusMsg(msg *models.ConsensusMessage) error {
+	hash, err := msg.GetHash()
+	if err != nil {
+		return fmt.Errorf("byzantine - hash consensus message : %w", err)
+	}
+	msg.Hash = hash
+	payload, err := models.SignPayload(msg)
+	if err != nil {
+		return err
+	}
+	msg.Signature, err = s.currentSigner().Sign(payload)
+	if err != nil {
+		return fmt.Errorf("byzantine - sign consensus message : %w", err)
+	}
+	return nil
+}
+
+func (s *InternalService) resignBlock(msg *models.BlockConsensusMessage) error {
+	hash, err := msg.Block.GetHash()
+	if err != nil {
+		return fmt.Errorf("byzantine - hash block : %w", err)
+	}
+	msg.BlockHash = hash
+	msg.Block.BlockHash = hash
+	payload, err := models.SignPayload(msg)
+	if err != nil {
+		return err
+	}
+	signature, err := s.currentSigner().Sign(payload)
+	if err != nil {
+		return fmt.Errorf("byzantine - sign block : %w", err)
+	}
+	msg.Block.SenderSignature = signature
+	msg.Signatures = []string{signature}
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !byzantine
+
+package internal
+
+import "fmt"
+
+// misbehaviour of the node is available in builds with byzantine tag only (tests, devnet)
+type byzantine struct{}
+
+func (s *InternalService) newByzantine() (*byzantine, error) {
+	config := s.GlobalService.GetConfig("byzantine", "").(string)
+	if config != "" {
+		return nil, fmt.Errorf("byzantine mode %s requires build with byzantine tag", config)
+	}
+	return nil, nil
+}
+
+func (s *InternalService) misbehave(msg interface{}) (sent bool, err error) {
+	return false, nil
+}
@@ -1,131 +1,134 @@
 package internal
 
 import (
-	"encoding/json"
 	"errors"
 	"math"
 	"reflect"
 	"sort"
 
 	"github.com/iamthe1whoknocks/bft/models"
-	"github.com/iamthe1whoknocks/bft/utils"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/iamthe1whoknocks/bft/storage"
 	"go.uber.org/zap"
 )
 
-// listening for messages from saiP2P
-func (s *InternalService) listenFromSaiP2P(saiBTCaddress string) {
-	s.GlobalService.Logger.Debug("saiP2P listener started") // DEBUG
-
-	storageToken, ok := s.GlobalService.Configuration["storage_token"].(string)
-	if !ok {
-		s.GlobalService.Logger.Fatal("wrong type of storage_token value in config")
-	}
-	saiBtcAddress, ok := s.GlobalService.Configuration["saiBTC_address"].(string)
-	if !ok {
-		s.GlobalService.Logger.Fatal("wrong type of saiBTC_address value in config")
-	}
-	saiP2Paddress, ok := s.GlobalService.Configuration["saiP2P_address"].(string)
-	if !ok {
-		s.GlobalService.Logger.Fatal("processing - wrong type of saiP2P address value from config")
-	}
-
-	saiP2pProxyAddress, ok := s.GlobalService.Configuration["saiProxy_address"].(string)
-	if !ok {
-		s.GlobalService.Logger.Fatal("processing - wrong type of saiP2pProxy address value from config")
-	}
-
-	for {
-		data := <-s.MsgQueue
-		s.GlobalService.Logger.Debug("chain - got data", zap.Any("data", data)) // DEBUG
-		switch data.(type) {
-		case *models.Tx:
-			txMsg := data.(*models.Tx)
-			Service.GlobalService.Logger.Sugar().Debugf("chain - got tx message : %+v", txMsg) //DEBUG
-
-			msg := &models.TransactionMessage{
-				Tx:          txMsg,
-				MessageHash: txMsg.MessageHash,
-			}
-			err := msg.Validate()
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - transactionMsg - validate", zap.Error(err))
-				continue
-			}
-			err = utils.ValidateSignature(msg, saiBtcAddress, msg.Tx.SenderAddress, msg.Tx.SenderSignature)
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - tx msg - validate signature ", zap.Error(err))
-				continue
-			}
-
-			err, result := s.Storage.Get("MessagesPool", msg, bson.M{}, storageToken)
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - transactionMsg - get from storage", zap.Error(err))
-				continue
-			}
-
-			if len(result) > 2 {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - transactionMsg - we have sent this message", zap.Error(err))
-				continue
-			}
+// validate and save message from the queue
+func (s *InternalService) handleQueuedMsg(data interface{}) {
+	s.GlobalService.Logger.Debug("chain - got data", zap.Any("data", data)) // DEBUG
+	switch data.(type) {
+	case *models.Tx:
+		txMsg := data.(*models.Tx)
+		s.GlobalService.Logger.Sugar().Debugf("chain - got tx message : %+v", txMsg) //DEBUG
+
+		msg := &models.TransactionMessage{
+			Tx:          txMsg,
+			MessageHash: txMsg.MessageHash,
+		}
+		err := msg.Validate()
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - transactionMsg - validate", zap.Error(err))
+			return
+		}
+		err = s.validateSignature(msg, msg.Tx.SenderAddress, msg.Tx.SenderSignature)
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - tx msg - validate signature ", zap.Error(err))
+			return
+		}
 
-			err, _ = s.Storage.Put("MessagesPool", msg, storageToken)
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - transactionMsg - put to storage", zap.Error(err))
-				continue
-			}
+		s.inbound.txMu.Lock()
+		defer s.inbound.txMu.Unlock()
+		_, err = s.Storage.TxByHash(msg.MessageHash)
+		if err == nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - transactionMsg - we have sent this message", zap.String("hash", msg.MessageHash))
+			return
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - transactionMsg - get from storage", zap.Error(err))
+			return
+		}
 
-			Service.GlobalService.Logger.Sugar().Debugf("TransactionMsg was saved in MessagesPool storage, msg : %+v\n", msg)
-			//s.MsgQueue <- struct{}{}
+		err = s.Storage.PutTx(msg)
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - transactionMsg - put to storage", zap.Error(err))
+			return
+		}
 
-		case *models.ConsensusMessage:
-			msg := data.(*models.ConsensusMessage)
-			Service.GlobalService.Logger.Sugar().Debugf("chain - got consensus message : %+v", msg) //DEBUG
-			err := msg.Validate()
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - validate", zap.Error(err))
-				continue
-			}
-			err = utils.ValidateSignature(msg, saiBtcAddress, msg.SenderAddress, msg.Signature)
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - validate signature ", zap.Error(err))
-				continue
-			}
-			err, _ = s.Storage.Put("ConsensusPool", msg, storageToken)
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - put to storage", zap.Error(err))
-				continue
-			}
-			Service.GlobalService.Logger.Sugar().Debugf("ConsensusMsg was saved in ConsensusPool storage, msg : %+v\n", msg)
-			continue
+		s.GlobalService.Logger.Sugar().Debugf("TransactionMsg was saved in MessagesPool storage, msg : %+v\n", msg)
 
-		case *models.BlockConsensusMessage:
-			msg := data.(*models.BlockConsensusMessage)
-			Service.GlobalService.Logger.Sugar().Debugf("chain - got block consensus message : %+v", msg) //DEBUG
-			err := msg.Validate()
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - validate", zap.Error(err))
-				continue
-			}
-			err = utils.ValidateSignature(msg, saiBtcAddress, msg.Block.SenderAddress, msg.Block.SenderSignature)
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - validate signature ", zap.Error(err))
-				continue
-			}
+	case *models.ConsensusMessage:
+		msg := data.(*models.ConsensusMessage)
+		s.GlobalService.Logger.Sugar().Debugf("chain - got consensus message : %+v", msg) //DEBUG
+		err := msg.Validate()
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - validate", zap.Error(err))
+			return
+		}
+		err = s.validateValidatorSignature(msg, msg.SenderAddress, msg.BlockNumber, msg.Signature)
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - validate signature ", zap.Error(err))
+			return
+		}
+		err = s.Storage.PutConsensusMsg(msg)
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - put to storage", zap.Error(err))
+			return
+		}
+		s.walReceived(msg)
+		s.GlobalService.Logger.Sugar().Debugf("ConsensusMsg was saved in ConsensusPool storage, msg : %+v\n", msg)
+		return
+
+	case *models.BlockConsensusMessage:
+		msg := data.(*models.BlockConsensusMessage)
+		s.GlobalService.Logger.Sugar().Debugf("chain - got block consensus message : %+v", msg) //DEBUG
+		err := msg.Validate()
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - validate", zap.Error(err))
+			return
+		}
+		err = s.validateValidatorSignature(msg, msg.Block.SenderAddress, msg.Block.Number, msg.Block.SenderSignature)
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - consensusMsg - validate signature ", zap.Error(err))
+			return
+		}
 
-			err = s.handleBlockConsensusMsg(saiBtcAddress, saiP2pProxyAddress, storageToken, msg, saiP2Paddress)
-			if err != nil {
-				Service.GlobalService.Logger.Error("listenFromSaiP2P - block consensus msg - put to storage", zap.Error(err))
-				continue
-			}
-		default:
-			Service.GlobalService.Logger.Error("listenFromSaiP2P - got wrong msg type", zap.Any("type", reflect.TypeOf(data)))
+		err = s.handleBlockConsensusMsg(msg)
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - block consensus msg - put to storage", zap.Error(err))
+			return
+		}
+	case *models.SnapshotManifest:
+		msg := data.(*models.SnapshotManifest)
+		s.GlobalService.Logger.Sugar().Debugf("chain - got snapshot manifest : %+v", msg) //DEBUG
+		err := msg.Validate()
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - snapshot manifest - validate", zap.Error(err))
+			return
+		}
+		err = s.handleSnapshotMsg(msg)
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - snapshot manifest - handle", zap.Error(err))
+			return
+		}
+	case *models.PeerRequest:
+		msg := data.(*models.PeerRequest)
+		err := msg.Validate()
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - peer request - validate", zap.Error(err))
+			return
+		}
+		err = s.answerRequest(msg)
+		if err != nil {
+			s.GlobalService.Logger.Error("listenFromSaiP2P - peer request - answer", zap.String("request_id", msg.RequestID), zap.Error(err))
+			return
 		}
+	case *models.PeerResponse:
+		s.handleResponse(data.(*models.PeerResponse))
+	default:
+		s.GlobalService.Logger.Error("listenFromSaiP2P - got wrong msg type", zap.Any("type", reflect.TypeOf(data)))
 	}
 }
 
 // handle BlockConsensusMsg
-func (s *InternalService) handleBlockConsensusMsg(saiBTCaddress, saiP2pProxyAddress, storageToken string, msg *models.BlockConsensusMessage, saiP2pAddress string) error {
+func (s *InternalService) handleBlockConsensusMsg(msg *models.BlockConsensusMessage) error {
 	isValid := s.validateBlockConsensusMsg(msg)
 	if !isValid {
 		err := errors.New("Provided BlockConsensusMsg is invalid")
@@ -133,36 +136,20 @@ func (s *InternalService) handleBlockConsensusMsg(saiBTCaddress, saiP2pProxyAddr
 		return err
 	}
 	// Get Block N
-	err, result := s.Storage.Get(blockchainCollection, bson.M{"block.number": msg.Block.Number}, bson.M{}, storageToken)
+	block, err := s.Storage.BlockByNumber(msg.Block.Number)
 	if err != nil {
+		// if there is no such block - go futher (compare block hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			return s.handleBlockCandidate(msg)
+		}
 		s.GlobalService.Logger.Error("handleBlockConsensusMsg - get block N ", zap.Error(err))
 		return err
 	}
 
-	// if there is no such block - go futher (compare block hash)
-	if len(result) == 2 {
-		return s.handleBlockCandidate(msg, saiP2pProxyAddress, saiP2pAddress, storageToken)
-	}
-
-	s.GlobalService.Logger.Sugar().Debugf("got block consensus : %s\n", result)
-
-	data, err := utils.ExtractResult(result)
-	if err != nil {
-		s.GlobalService.Logger.Error("handleBlockConsensusMsg - extract data from response", zap.Error(err))
-		return err
-	}
-
-	blocks := []models.BlockConsensusMessage{}
-	err = json.Unmarshal(data, &blocks)
-	if err != nil {
-		s.GlobalService.Logger.Error("handleBlockConsensusMsg - unmarshal block", zap.Error(err))
-		return err
-	}
-
-	block := blocks[0]
+	s.GlobalService.Logger.Sugar().Debugf("got block consensus : %+v\n", block)
 
 	if block.BlockHash == msg.BlockHash {
-		err := s.addVotesToBlock(&block, msg, storageToken)
+		err := s.addVotesToBlock(block, msg)
 		if err != nil {
 			s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash = msgBlockHash - add votes to block", zap.Error(err))
 			return err
@@ -170,43 +157,80 @@ func (s *InternalService) handleBlockConsensusMsg(saiBTCaddress, saiP2pProxyAddr
 		s.GlobalService.Logger.Sugar().Debugf("votes was updated in blockchain storage for block : %+v\n", block)
 		return nil
 	} else {
-		return s.handleBlockCandidate(msg, saiP2pProxyAddress, saiP2pAddress, storageToken)
+		return s.handleBlockCandidate(msg)
 	}
 }
 
+// block returned by connected nodes and the number of nodes, which returned it
+type syncedBlock struct {
+	block *models.BlockConsensusMessage
+	count int
+}
+
 // Get missed blocks from connected nodes & compare received blocks
-func (s *InternalService) sendDirectGetBlockMsg(lastBlockNumber int, saiP2pProxyAddress string, saiP2pAddress string) (resultBlocks []*models.BlockConsensusMessage, err error) {
-	// temp map for comparing missed blocks, which got from connected saiP2p nodes
-	tempMap := make(map[*models.BlockConsensusMessage]int)
+// the same block from several nodes is counted by block hash, block returned by more nodes is chosen for the number
+func (s *InternalService) sendDirectGetBlockMsg(lastBlockNumber int) (resultBlocks []*models.BlockConsensusMessage, err error) {
+	// temp map for comparing missed blocks by block hash, which got from connected saiP2p nodes
+	tempMap := make(map[string]*syncedBlock)
 
-	addresses, err := utils.GetConnectedNodesAddresses(saiP2pProxyAddress, lastBlockNumber)
+	addresses, err := s.peersAtHeight(lastBlockNumber)
 	if err != nil {
 		s.GlobalService.Logger.Error("chain - handleBlockConsensusMsg - sendDirectGetBlockMsg", zap.Error(err))
 		return nil, err
 	}
 
 	for _, node := range addresses {
-		blocks, err := utils.SendDirectGetBlockMsg(node, lastBlockNumber, saiP2pAddress)
+		blocks, err := s.requestBlocks(node, 0, lastBlockNumber)
 		if err != nil {
 			s.GlobalService.Logger.Error("chain - send direct get block message", zap.String("node", node), zap.Error(err))
 			continue
 		}
+		// node could keep the same block several times, it is counted once for the node
+		returned := make(map[string]bool)
 		for _, b := range blocks {
-			tempMap[b]++
+			if b.Block == nil || s.checkChainID(b.Block.ChainID) != nil {
+				continue
+			}
+			hash, err := b.Block.GetHash()
+			if err != nil || hash != b.BlockHash {
+				continue
+			}
+
+			synced, ok := tempMap[hash]
+			if !ok {
+				synced = &syncedBlock{block: b}
+				tempMap[hash] = synced
+			} else {
+				// copies of the block could have votes of different validators
+				synced.block.Signatures = mergeSignatures(synced.block.Signatures, b.Signatures)
+			}
+			if !returned[hash] {
+				returned[hash] = true
+				synced.count++
+			}
 		}
 	}
 	resultBlocks = make([]*models.BlockConsensusMessage, 0)
 
 	for i := 1; i <= lastBlockNumber; i++ {
 		sliceToSort := make([]*models.BlockConsensusMessage, 0)
-		for k, v := range tempMap {
+		for _, synced := range tempMap {
+			k := synced.block
 			if k.Block.Number == i {
 				sliceToSort = append(sliceToSort, &models.BlockConsensusMessage{
-					Count: v,
-					Block: k.Block,
+					Type:       k.Type,
+					BlockHash:  k.BlockHash,
+					Votes:      k.Votes,
+					Count:      synced.count,
+					Block:      k.Block,
+					Signatures: k.Signatures,
 				})
 			}
 		}
+		// none of the nodes returned the block
+		if len(sliceToSort) == 0 {
+			continue
+		}
 		sort.Slice(sliceToSort, func(i, j int) bool {
 			return sliceToSort[i].Count > sliceToSort[j].Count
 		})
@@ -221,6 +245,24 @@ func (s *InternalService) sendDirectGetBlockMsg(lastBlockNumber int, saiP2pProxy
 	return resultBlocks, nil
 }
 
+// signatures of both lists without duplicates
+func mergeSignatures(signatures, other []string) []string {
+	merged := append([]string{}, signatures...)
+	for _, signature := range other {
+		found := false
+		for _, existing := range merged {
+			if existing == signature {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, signature)
+		}
+	}
+	return merged
+}
+
 // validate block consensus message
 func (s *InternalService) validateBlockConsensusMsg(msg *models.BlockConsensusMessage) bool {
 	for _, validator := range s.TrustedValidators {
@@ -232,59 +274,75 @@ func (s *InternalService) validateBlockConsensusMsg(msg *models.BlockConsensusMe
 	return false
 }
 
-// get block candidate with the block hash, add vote if exists
-// insert blockCandidate, if not exists
-func (s *InternalService) getBlockCandidate(msg *models.BlockConsensusMessage, storageToken string) ([]byte, error) {
-	err, result := s.Storage.Get("BlockCandidates", bson.M{"hash": msg.Block.BlockHash}, bson.M{}, storageToken)
+// get block candidate with the block hash
+func (s *InternalService) getBlockCandidate(msg *models.BlockConsensusMessage) (*models.BlockConsensusMessage, error) {
+	blockCandidate, err := s.Storage.BlockCandidate(msg.Block.BlockHash)
 	if err != nil {
-		s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash != msgBlockHash - get block candidate by msg block hash", zap.Error(err))
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash != msgBlockHash - get block candidate by msg block hash", zap.Error(err))
+		}
 		return nil, err
 	}
-	return result, nil
+	return blockCandidate, nil
 }
 
 // add vote to block N
-func (s *InternalService) addVotesToBlock(block, msg *models.BlockConsensusMessage, storageToken string) error {
+func (s *InternalService) addVotesToBlock(block, msg *models.BlockConsensusMessage) error {
 	block.Signatures = append(block.Signatures, msg.Block.SenderSignature)
 	block.Votes++
-	filter := bson.M{"block.number": block.Block.Number}
-	update := bson.M{"votes": block.Votes, "voted_signatures": block.Signatures}
-	err, _ := s.Storage.Update(blockchainCollection, filter, update, storageToken)
-	return err
+	return s.Storage.UpdateBlockVotes(block.Block.Number, block.Votes, block.Signatures)
 }
 
 // update blockchain
 // 1. get missed blocks from connected nodes
 // 2. put missed and chosen blocks to blockchain collection
-func (s *InternalService) updateBlockchain(msg, blockCandidate *models.BlockConsensusMessage, storageToken, saiP2pProxyAddress, saiP2pAddress string) error {
-	resultBlocks, err := s.sendDirectGetBlockMsg(msg.Block.Number, saiP2pProxyAddress, saiP2pAddress)
+func (s *InternalService) updateBlockchain(msg, blockCandidate *models.BlockConsensusMessage) error {
+	resultBlocks, err := s.sendDirectGetBlockMsg(msg.Block.Number)
 	if err != nil {
 		s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash = msgBlockHash - sendDirectGetBlockMessage", zap.Error(err))
 		return err
 	}
 
-	err, _ = s.Storage.Put(blockchainCollection, resultBlocks, storageToken)
+	// synced blocks should be signed by validators and linked to the previous block as it is done by fast sync
+	// first block is linked to the initial block, blocks after the first wrong or missing block are not saved
+	initialBlock, err := s.createInitialBlock()
 	if err != nil {
 		return err
 	}
+	previousHash := initialBlock.BlockHash
+	for i, block := range resultBlocks {
+		if block.Block.Number != i+1 || block.Block.PreviousBlockHash != previousHash {
+			s.GlobalService.Logger.Error("chain - update blockchain - synced block is not linked to previous block", zap.Int("number", block.Block.Number))
+			break
+		}
+		err = s.verifySyncedBlock(block)
+		if err != nil {
+			s.GlobalService.Logger.Error("chain - update blockchain - verify synced block", zap.Int("number", block.Block.Number), zap.Error(err))
+			break
+		}
+		err = s.saveBlock(block)
+		if err != nil {
+			return err
+		}
+		previousHash = block.BlockHash
+	}
 	s.GlobalService.Logger.Sugar().Debugf("blockCandidate was saved in blockchain collection, msg : %+v\n", blockCandidate)
 	return nil
 }
 
 // Block candidate logic
 // 1. Get block candidate from db
-//2. update blockchain if blockCandidate votes < incoming msg.Votes
-func (s *InternalService) handleBlockCandidate(msg *models.BlockConsensusMessage, saiP2pProxyAddress, saiP2pAddress, storageToken string) error {
-	result, err := s.getBlockCandidate(msg, storageToken)
-	if err != nil {
-		s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash != msgBlockHash - get block candidate by msg block hash", zap.Error(err))
+// 2. update blockchain if blockCandidate votes < incoming msg.Votes
+func (s *InternalService) handleBlockCandidate(msg *models.BlockConsensusMessage) error {
+	blockCandidate, err := s.getBlockCandidate(msg)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
 		return err
 	}
 
-	// empty get response returns '{}' in storage get method
-	if len(result) == 2 {
+	// there is no block candidate with such hash
+	if errors.Is(err, storage.ErrNotFound) {
 		if float64(msg.Votes) > math.Ceil(float64(len(s.TrustedValidators))*7/10) {
-			err, _ := s.Storage.Put("Blockchain", msg, storageToken)
+			err := s.saveBlock(msg)
 			if err != nil {
 				s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash = msgBlockHash - insert block to BlockCandidates collection", zap.Error(err))
 				return err
@@ -292,7 +350,7 @@ func (s *InternalService) handleBlockCandidate(msg *models.BlockConsensusMessage
 			s.GlobalService.Logger.Sugar().Debugf("block candidate was inserted to blockchain collection, blockCandidate : %+v\n", msg) // DEBUG
 			return nil
 		} else {
-			err, _ := s.Storage.Put("BlockCandidates", msg, storageToken)
+			err := s.Storage.PutBlockCandidate(msg)
 			if err != nil {
 				s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash = msgBlockHash - insert block to BlockCandidates collection", zap.Error(err))
 				return err
@@ -302,20 +360,13 @@ func (s *InternalService) handleBlockCandidate(msg *models.BlockConsensusMessage
 		}
 
 	}
-	blockCandidates := make([]models.BlockConsensusMessage, 0)
-	err = json.Unmarshal(result, &blockCandidates)
-	if err != nil {
-		s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockCandidateHash = msgBlockHash - unmarshal", zap.Error(err))
-		return err
-	}
 
-	blockCandidate := blockCandidates[0]
 	s.GlobalService.Logger.Sugar().Debugf("got block candidate : %+v\n", blockCandidate) //DEBUG
 
 	blockCandidate.Votes++
 	blockCandidate.Signatures = append(blockCandidate.Signatures, msg.Block.SenderSignature)
 	if blockCandidate.Votes > msg.Votes {
-		err, _ := s.Storage.Put("Blockchain", msg, storageToken)
+		err := s.saveBlock(msg)
 		if err != nil {
 			s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash = msgBlockHash - insert block to BlockCandidates collection", zap.Error(err))
 			return err
@@ -323,7 +374,7 @@ func (s *InternalService) handleBlockCandidate(msg *models.BlockConsensusMessage
 
 		s.GlobalService.Logger.Sugar().Debugf("block candidate was inserted to blockchain collection, blockCandidate : %+v\n", msg) // DEBUG
 
-		err = s.updateBlockchain(msg, &blockCandidate, saiP2pProxyAddress, storageToken, saiP2pAddress)
+		err = s.updateBlockchain(msg, blockCandidate)
 		if err != nil {
 			s.GlobalService.Logger.Error("handleBlockConsensusMsg - blockHash = msgBlockHash - update blockchain", zap.Error(err))
 			return err
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"github.com/iamthe1whoknocks/bft/storage"
+	"github.com/iamthe1whoknocks/bft/transport"
+	"github.com/iamthe1whoknocks/saiService"
+	"go.uber.org/zap"
+)
+
+const testChainID = "bft-test"
+
+func generateKeys(t *testing.T, n int) []*models.BtcKeys {
+	t.Helper()
+	keys := make([]*models.BtcKeys, 0, n)
+	for i := 0; i < n; i++ {
+		k, err := signer.GenerateEd25519Keys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// node with memory storage in loopback network, validators are trusted validators of the node
+// node keys are generated if keys are nil, config replaces default config values of the node
+func newTestNode(t *testing.T, network *transport.LoopbackNetwork, keys *models.BtcKeys, validators []*models.BtcKeys, config map[string]interface{}) *InternalService {
+	t.Helper()
+	if keys == nil {
+		keys = generateKeys(t, 1)[0]
+	}
+	trusted := make([]interface{}, 0, len(validators))
+	for _, v := range validators {
+		trusted = append(trusted, v.Address)
+	}
+	configuration := map[string]interface{}{
+		"chain_id":           testChainID,
+		"trusted_validators": trusted,
+		"storage_type":       "memory",
+		"signer":             "native",
+		"wal_path":           "",
+	}
+	for key, value := range config {
+		configuration[key] = value
+	}
+	svc := &saiService.Service{
+		Name:          "bft-test",
+		Configuration: configuration,
+		Logger:        zap.NewNop(),
+	}
+	s, err := NewNode(svc, &NodeOptions{
+		Storage: storage.NewMemoryStore(),
+		Keys:    keys,
+		Transport: func(handler transport.Handler) transport.Transport {
+			return network.Join(keys.Address, handler)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range validators {
+		s.TrustedValidators = append(s.TrustedValidators, v.Address)
+	}
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s
+}
+
+// block signed by each of signers, first signer is the sender
+func signedBlock(t *testing.T, number int, previousHash string, txs map[string]*models.Tx, signers ...*models.BtcKeys) *models.BlockConsensusMessage {
+	t.Helper()
+	if txs == nil {
+		txs = make(map[string]*models.Tx)
+	}
+	block := &models.BlockConsensusMessage{
+		Type: models.BlockConsensusMsgType,
+		Block: &models.Block{
+			ChainID:           testChainID,
+			Number:            number,
+			PreviousBlockHash: previousHash,
+			SenderAddress:     signers[0].Address,
+			Messages:          txs,
+		},
+	}
+	hash, err := block.Block.GetHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.BlockHash = hash
+	block.Block.BlockHash = hash
+
+	for i, k := range signers {
+		signed := *block.Block
+		signed.SenderAddress = k.Address
+		payload, err := models.SignPayload(&models.BlockConsensusMessage{Block: &signed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodeSigner, err := signer.NewEd25519Signer(k.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := nodeSigner.Sign(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			block.Block.SenderSignature = signature
+		}
+		block.Signatures = append(block.Signatures, signature)
+	}
+	block.Votes = len(signers)
+	return block
+}
+
+func initialBlockHash(t *testing.T, s *InternalService) string {
+	t.Helper()
+	block, err := s.createInitialBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block.BlockHash
+}
+
+func blockHashes(t *testing.T, s *InternalService) []string {
+	t.Helper()
+	blocks, err := s.Storage.Blocks(1, math.MaxInt32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		hashes = append(hashes, b.BlockHash)
+	}
+	return hashes
+}
+
+func putBlocks(t *testing.T, s *InternalService, blocks ...*models.BlockConsensusMessage) {
+	t.Helper()
+	for _, b := range blocks {
+		err := s.Storage.PutBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdateBlockchain(t *testing.T) {
+	validators := generateKeys(t, 4)
+	network := transport.NewLoopbackNetwork(1)
+	genesis := initialBlockHash(t, newTestNode(t, network, nil, validators, nil))
+
+	block1 := signedBlock(t, 1, genesis, nil, validators[0], validators[1], validators[2])
+	block2 := signedBlock(t, 2, block1.BlockHash, nil, validators[0], validators[1], validators[2])
+	// forged block is signed only by the peer, which returns it
+	forged := signedBlock(t, 2, block1.BlockHash, map[string]*models.Tx{"forged": {ChainID: testChainID}}, validators[3])
+	unlinked := signedBlock(t, 2, "wrong", nil, validators[0], validators[1], validators[2])
+	// every peer has only part of the votes of the block
+	block1Part1 := signedBlock(t, 1, genesis, nil, validators[0], validators[1])
+	block1Part2 := signedBlock(t, 1, genesis, nil, validators[2])
+
+	tests := []struct {
+		name  string
+		peers [][]*models.BlockConsensusMessage
+		want  []string
+	}{
+		{
+			name:  "same blocks from two peers",
+			peers: [][]*models.BlockConsensusMessage{{block1, block2}, {block1, block2}},
+			want:  []string{block1.BlockHash, block2.BlockHash},
+		},
+		{
+			name:  "same block saved several times by the peer",
+			peers: [][]*models.BlockConsensusMessage{{block1, block1, block2}, {block1, block2}},
+			want:  []string{block1.BlockHash, block2.BlockHash},
+		},
+		{
+			name:  "forged block from one of three peers",
+			peers: [][]*models.BlockConsensusMessage{{block1, block2}, {block1, block2}, {block1, forged}},
+			want:  []string{block1.BlockHash, block2.BlockHash},
+		},
+		{
+			name:  "block with not enough signatures",
+			peers: [][]*models.BlockConsensusMessage{{block1, forged}},
+			want:  []string{block1.BlockHash},
+		},
+		{
+			name:  "block is not linked to the previous block",
+			peers: [][]*models.BlockConsensusMessage{{block1, unlinked}, {block1, unlinked}},
+			want:  []string{block1.BlockHash},
+		},
+		{
+			name:  "signatures of block copies are merged",
+			peers: [][]*models.BlockConsensusMessage{{block1Part1}, {block1Part2}},
+			want:  []string{block1.BlockHash},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := transport.NewLoopbackNetwork(1)
+			for _, blocks := range tt.peers {
+				putBlocks(t, newTestNode(t, network, nil, validators, nil), blocks...)
+			}
+			s := newTestNode(t, network, nil, validators, nil)
+
+			err := s.updateBlockchain(block2, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := blockHashes(t, s)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("synced blocks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errForeignChain = errors.New("message from foreign chain")
+
+// chain id of the network, every hashed and signed message includes it
+// there is no default, node of one network should not sign messages of another one by forgotten config
+func (s *InternalService) chainID() string {
+	return s.GlobalService.GetConfig("chain_id", "").(string)
+}
+
+// chain id should be set and should not contain signed payload separator
+func (s *InternalService) validateChainID() error {
+	chainID := s.chainID()
+	if chainID == "" {
+		return errors.New("chain_id is not set in config")
+	}
+	if strings.Contains(chainID, "/") {
+		return fmt.Errorf("wrong chain id : %q", chainID)
+	}
+	return nil
+}
+
+// reject messages of other networks
+func (s *InternalService) checkChainID(chainID string) error {
+	if chainID != s.chainID() {
+		return fmt.Errorf("%w : %q, expected : %q", errForeignChain, chainID, s.chainID())
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"context"
+	"time"
+)
+
+// clock of consensus timers, recorded time is used instead of real one on replay
+type clock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) // returns earlier if ctx is done
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// height and round of consensus loop
+type consensusStep struct {
+	Height int
+	Round  int
+}
+
+// consensus timer, fired timer is recorded
+func (s *InternalService) wait(d time.Duration) {
+	s.clock.Sleep(s.ctx, d)
+	if s.stopped() {
+		return
+	}
+	s.recordTimer(d)
+}
@@ -10,9 +10,8 @@ import (
 	"strconv"
 
 	"github.com/iamthe1whoknocks/bft/models"
-	"github.com/iamthe1whoknocks/bft/utils"
+	"github.com/iamthe1whoknocks/bft/signer"
 	"github.com/iamthe1whoknocks/saiService"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.uber.org/zap"
 )
 
@@ -28,11 +27,6 @@ var GetMissedBlocks = saiService.HandlerElement{
 			return nil, fmt.Errorf("wrong type of incoming data")
 		}
 
-		storageToken, ok := Service.GlobalService.Configuration["storage_token"].(string)
-		if !ok {
-			Service.GlobalService.Logger.Fatal("wrong type of storage_token value in config")
-		}
-
 		if len(cliData) == 0 {
 			err := errors.New("empty argument provided")
 			Service.GlobalService.Logger.Error("handlers - getBlocks", zap.Error(err))
@@ -45,31 +39,29 @@ var GetMissedBlocks = saiService.HandlerElement{
 			Service.GlobalService.Logger.Sugar().Fatalf("Cant convert cli input to int  :%s", err.Error())
 		}
 
-		filterGte := bson.M{"block.number": bson.M{"$lte": blockNumber}}
-		err, response := Service.Storage.Get(blockchainCollection, filterGte, bson.M{}, storageToken)
+		from := 1
+
+		// optional lower bound of requested blocks
+		if len(cliData) > 1 {
+			from, err = strconv.Atoi(cliData[1])
+			if err != nil {
+				Service.GlobalService.Logger.Error("handlers - GetMissedBlocks - convert from argument", zap.Error(err))
+				return nil, fmt.Errorf("handlers - GetMissedBlocks - convert from argument : %w", err)
+			}
+		}
+
+		blocks, err := Service.Storage.Blocks(from, blockNumber)
 		if err != nil {
 			Service.GlobalService.Logger.Error("handlers - GetMissedBlocks - get blocks from storage", zap.Error(err))
 			return nil, fmt.Errorf("handlers - GetMissedBlocks - get blocks from storage : %w", err)
 		}
 
-		if len(response) == 2 {
+		if len(blocks) == 0 {
 			err = fmt.Errorf("block with number = %d was not found", blockNumber)
 			Service.GlobalService.Logger.Error("handleBlockConsensusMsg - get block N", zap.Error(err))
 			return nil, err
 		}
 
-		result, err := utils.ExtractResult(response)
-		if err != nil {
-			Service.GlobalService.Logger.Error("handlers - GetMissedBlocks - get blocks from storage - extract result", zap.Error(err))
-			return nil, fmt.Errorf("handlers - GetMissedBlocks - get blocks from storage - extract result: %w", err)
-		}
-		blocks := make([]*models.BlockConsensusMessage, 0)
-
-		err = json.Unmarshal(result, &blocks)
-		if err != nil {
-			Service.GlobalService.Logger.Error("handlers - GetMissedBlocks - get blocks from storage - unmarshal result", zap.Error(err))
-			return nil, fmt.Errorf("handlers - GetMissedBlocks - get blocks from storage - unmarshal result: %w", err)
-		}
 		return blocks, nil
 	},
 }
@@ -90,129 +82,131 @@ var HandleTxFromCli = saiService.HandlerElement{
 			return nil, errors.New("not enough arguments in cli tx method")
 		}
 
-		saiBtcAddress, ok := Service.GlobalService.Configuration["saiBTC_address"].(string)
-		if !ok {
-			Service.GlobalService.Logger.Fatal("wrong type of saiBTC_address value in config")
-		}
-
-		btckeys, err := Service.GetBTCkeys("btc_keys.json", saiBtcAddress)
-		if err != nil {
-			Service.GlobalService.Logger.Fatal("listenFromSaiP2P  - handle tx msg - get btc keys", zap.Error(err))
-		}
-		Service.BTCkeys = btckeys
-
 		txMsg := &models.TxMessage{
 			Method: args[0],
 		}
 		params := args[1:]
 		txMsg.Params = append(txMsg.Params, params...)
 
-		txMsgBytes, err := json.Marshal(txMsg)
+		err := Service.SendTx(txMsg)
 		if err != nil {
-			Service.GlobalService.Logger.Error("handlers - tx  -  marshal tx msg", zap.Error(err))
-			return nil, fmt.Errorf("handlers - tx  -  marshal tx msg: %w", err)
+			return nil, err
 		}
-		transactionMessage := &models.TransactionMessage{
-			Tx: &models.Tx{
-				SenderAddress: Service.BTCkeys.Address,
-				Message:       string(txMsgBytes),
-			},
+		return "ok", nil
+	},
+}
+
+// handle message from saiP2p
+var HandleMessage = saiService.HandlerElement{
+	Name:        "message",
+	Description: "handle message from saiP2p",
+	Function: func(data interface{}) (interface{}, error) {
+		return Service.handleMessage(data)
+	},
+}
+
+// get counters of inbound queues
+var GetInboundStats = saiService.HandlerElement{
+	Name:        "inboundStats",
+	Description: "get counters of inbound message queues",
+	Function: func(data interface{}) (interface{}, error) {
+		return Service.InboundStats(), nil
+	},
+}
+
+// get snapshot manifest
+// example : getSnapshot $HEIGHT (latest snapshot if height is not provided)
+var GetSnapshot = saiService.HandlerElement{
+	Name:        "getSnapshot",
+	Description: "get snapshot manifest",
+	Function: func(data interface{}) (interface{}, error) {
+		args, ok := data.([]string)
+		if !ok {
+			return nil, errors.New("wrong type for args in getSnapshot method")
 		}
 
-		hash, err := transactionMessage.Tx.GetHash()
-		if err != nil {
-			Service.GlobalService.Logger.Error("handlers  - tx - count tx message hash", zap.Error(err))
-			return nil, fmt.Errorf("handlers  - tx - count tx message hash: %w", err)
+		height := 0
+		if len(args) > 0 {
+			h, err := strconv.Atoi(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("handlers - getSnapshot - convert height : %w", err)
+			}
+			height = h
 		}
-		transactionMessage.Tx.MessageHash = hash
 
-		btcResp, err := utils.SignMessage(transactionMessage, saiBtcAddress, Service.BTCkeys.Private)
+		manifest, err := Service.getSnapshotManifest(height)
 		if err != nil {
-			Service.GlobalService.Logger.Error("handlers  - tx - sign tx message", zap.Error(err))
-			return nil, fmt.Errorf("handlers  - tx - sign tx message: %w", err)
+			Service.GlobalService.Logger.Error("handlers - getSnapshot - get snapshot manifest", zap.Int("height", height), zap.Error(err))
+			return nil, err
 		}
-		transactionMessage.Tx.SenderSignature = btcResp.Signature
+		return manifest, nil
+	},
+}
 
-		saiP2Paddress, ok := Service.GlobalService.Configuration["saiP2P_address"].(string)
+// get snapshot chunk
+// example : getSnapshotChunk $HEIGHT $INDEX
+var GetSnapshotChunk = saiService.HandlerElement{
+	Name:        "getSnapshotChunk",
+	Description: "get snapshot chunk",
+	Function: func(data interface{}) (interface{}, error) {
+		args, ok := data.([]string)
 		if !ok {
-			Service.GlobalService.Logger.Fatal("processing - wrong type of saiP2P address value from config")
+			return nil, errors.New("wrong type for args in getSnapshotChunk method")
+		}
+
+		if len(args) != 2 {
+			return nil, errors.New("not enough arguments in getSnapshotChunk method")
 		}
 
-		err = Service.broadcastMsg(transactionMessage.Tx, saiP2Paddress)
+		height, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("handlers - getSnapshotChunk - convert height : %w", err)
+		}
+		index, err := strconv.Atoi(args[1])
 		if err != nil {
-			Service.GlobalService.Logger.Error("listenFromSaiP2P  - handle tx msg - broadcast tx", zap.Error(err))
+			return nil, fmt.Errorf("handlers - getSnapshotChunk - convert index : %w", err)
 		}
 
-		Service.MsgQueue <- transactionMessage.Tx
-		<-Service.MsgQueue
-		return "ok", nil
+		chunk, err := Service.getSnapshotChunk(height, index)
+		if err != nil {
+			Service.GlobalService.Logger.Error("handlers - getSnapshotChunk - get snapshot chunk", zap.Int("height", height), zap.Int("index", index), zap.Error(err))
+			return nil, err
+		}
+		return chunk, nil
 	},
 }
 
-// handle message from saiP2p
-var HandleMessage = saiService.HandlerElement{
-	Name:        "message",
-	Description: "handle message from saiP2p",
+// rotate validator key, new key is valid from the height
+// example : rotateKey $NEW_KEYS_PATH $HEIGHT
+var RotateKey = saiService.HandlerElement{
+	Name:        "rotateKey",
+	Description: "rotate validator key",
 	Function: func(data interface{}) (interface{}, error) {
-		m, ok := data.(map[string]interface{})
+		args, ok := data.([]string)
 		if !ok {
-			return nil, fmt.Errorf("Wrong type of data  : %+v\n", reflect.TypeOf(data))
+			return nil, errors.New("wrong type for args in cli rotateKey method")
 		}
-		Service.GlobalService.Logger.Sugar().Debugf("got message from saiP2p : %+v", m) // DEBUG
+		Service.GlobalService.Logger.Debug("got message from cli", zap.Strings("data", args))
 
-		switch m["type"].(string) {
-		case models.BlockConsensusMsgType:
-			Service.GlobalService.Logger.Sugar().Debugf("got message from saiP2p detected type : %s", models.BlockConsensusMsgType) // DEBUG
-			msg := models.BlockConsensusMessage{}
-			b, err := json.Marshal(m)
-			if err != nil {
-				return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
-			}
-			err = json.Unmarshal(b, &msg)
-			if err != nil {
-				return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
-			}
-			Service.MsgQueue <- &msg
-		case models.ConsensusMsgType:
-			Service.GlobalService.Logger.Sugar().Debugf("got message from saiP2p detected type : %s", models.ConsensusMsgType) // DEBUG
-			msg := models.ConsensusMessage{}
-			b, err := json.Marshal(m)
-			if err != nil {
-				Service.GlobalService.Logger.Sugar().Error(err) // DEBUG
-				return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
-			}
-			err = json.Unmarshal(b, &msg)
-			if err != nil {
-				Service.GlobalService.Logger.Sugar().Error(err) // DEBUG
-				return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
-			}
-			Service.MsgQueue <- &msg
-		case models.TransactionMsgType:
-			Service.GlobalService.Logger.Sugar().Debugf("got message from saiP2p detected type : %s", models.TransactionMsgType) // DEBUG
-			msg := models.Tx{}
-			b, err := json.Marshal(m)
-			if err != nil {
-				return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
-			}
-			err = json.Unmarshal(b, &msg)
-			if err != nil {
-				return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
-			}
-			Service.MsgQueue <- &msg
-		default:
-			Service.GlobalService.Logger.Sugar().Errorf("got message from saiP2p wrong detected type : %s", m["type"].(string)) // DEBUG
-			return nil, errors.New("handlers - handle message - wrong message type" + m["type"].(string))
+		if len(args) != 2 {
+			return nil, errors.New("path to new keys and height should be provided")
 		}
-
-		return "ok", nil
+		height, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("wrong height : %w", err)
+		}
+		return Service.rotateKey(args[0], height)
 	},
 }
 
-// create btc keys
-// example : keys
+// manage node keys
+// example : keys $TYPE - create keys, type is btc (default) or ed25519
+// example : keys import $PATH - import plaintext keys json
+// example : keys export $PATH - export decrypted keys to plaintext json
+// example : keys change-passphrase - encrypt keystore by new passphrase
 var CreateBTCKeys = saiService.HandlerElement{
 	Name:        "keys",
-	Description: "create btc keys",
+	Description: "create, import, export node keys or change keystore passphrase",
 	Function: func(data interface{}) (interface{}, error) {
 		args, ok := data.([]string)
 		if !ok {
@@ -220,49 +214,193 @@ var CreateBTCKeys = saiService.HandlerElement{
 		}
 		Service.GlobalService.Logger.Debug("got message from cli", zap.Strings("data", args))
 
-		// todo : handle flags if it will be needed
-		// if len(args) != 5 {
-		// 	return nil, errors.New("not enough arguments in cli tx method")
-		// }
-		file, err := os.OpenFile(btcKeyFile, os.O_RDWR, 0666)
+		if len(args) > 0 {
+			switch args[0] {
+			case "import":
+				if len(args) != 2 {
+					return nil, errors.New("path to keys file is not provided")
+				}
+				return Service.importBTCkeys(btcKeyFile, args[1])
+			case "export":
+				if len(args) != 2 {
+					return nil, errors.New("path to export keys is not provided")
+				}
+				return Service.exportBTCkeys(btcKeyFile, args[1])
+			case "change-passphrase":
+				return Service.changeKeystorePassphrase(btcKeyFile)
+			}
+		}
 
+		_, err := os.Stat(btcKeyFile)
 		//todo: handle args if file exists
 		if err == nil {
 			Service.GlobalService.Logger.Debug("handlers - create btc keys - open key btc file - keys already exists")
 			return "btc keys file already exists", nil
 		}
 
-		saiBtcAddress, ok := Service.GlobalService.Configuration["saiBTC_address"].(string)
-		if !ok {
-			Service.GlobalService.Logger.Fatal("wrong type of saiBTC_address value in config")
+		keyType := Service.GlobalService.GetConfig("key_type", signer.KeyTypeBtc).(string)
+		if len(args) > 0 {
+			keyType = args[0]
 		}
 
-		btcKeys, body, err := utils.GetBtcKeys(saiBtcAddress)
+		btcKeys, err := Service.generateBTCkeys(keyType)
 		if err != nil {
 			Service.GlobalService.Logger.Error("handlers - create btc keys  - get btc keys", zap.Error(err))
 			return nil, err
 		}
 
-		file, err = os.OpenFile(btcKeyFile, os.O_CREATE|os.O_RDWR, 0666)
+		err = Service.saveBTCkeys(btcKeyFile, btcKeys)
 		if err != nil {
-			Service.GlobalService.Logger.Error("handlers - create btc keys  - open key btc file", zap.Error(err))
+			Service.GlobalService.Logger.Error("handlers - create btc keys - save keys", zap.Error(err))
 			return nil, err
 		}
-		_, err = file.Write(body)
-		if err != nil {
-			Service.GlobalService.Logger.Error("handlers -  - write btc keys to file", zap.Error(err))
-			return nil, err
-		}
-		return btcKeys, nil
-
+		return fmt.Sprintf("keys created, address : %s", btcKeys.Address), nil
 	},
 }
 
 func (s *InternalService) Init() {
-	go s.listenFromSaiP2P(s.GlobalService.Configuration["saiBTC_address"].(string))
-
+	s.startInbound()
+	s.registerMetrics()
 }
 
 func (s *InternalService) Process() {
+	s.running.Add(1)
+	defer s.running.Done()
 	s.Processing()
 }
+
+// handle message from saiP2p or gossip transport, message is validated and queued for inbound workers
+// handler does not wait for the queue, message is rejected if the queue of its class is full
+func (s *InternalService) handleMessage(data interface{}) (interface{}, error) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Wrong type of data  : %+v\n", reflect.TypeOf(data))
+	}
+	s.GlobalService.Logger.Sugar().Debugf("got message from saiP2p : %+v", m) // DEBUG
+	s.recordMessage(m)
+
+	msg, err := s.decodeMessage(m)
+	if err != nil {
+		return nil, err
+	}
+	// response is passed to the waiting request, it is not queued
+	if resp, ok := msg.(*models.PeerResponse); ok {
+		s.handleResponse(resp)
+		return "ok", nil
+	}
+	err = s.enqueue(msg)
+	if err != nil {
+		return nil, err
+	}
+	return "ok", nil
+}
+
+// decode message by its type, messages of other chains are rejected
+func (s *InternalService) decodeMessage(m map[string]interface{}) (interface{}, error) {
+
+	msgType, _ := m["type"].(string)
+	switch msgType {
+	case models.BlockConsensusMsgType:
+		s.GlobalService.Logger.Sugar().Debugf("got message from saiP2p detected type : %s", models.BlockConsensusMsgType) // DEBUG
+		msg := models.BlockConsensusMessage{}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
+		}
+		err = json.Unmarshal(b, &msg)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
+		}
+		if msg.Block == nil {
+			return nil, errors.New("handlers - handle message - empty block")
+		}
+		err = s.checkChainID(msg.Block.ChainID)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message : %w", err)
+		}
+		return &msg, nil
+	case models.ConsensusMsgType:
+		s.GlobalService.Logger.Sugar().Debugf("got message from saiP2p detected type : %s", models.ConsensusMsgType) // DEBUG
+		msg := models.ConsensusMessage{}
+		b, err := json.Marshal(m)
+		if err != nil {
+			s.GlobalService.Logger.Sugar().Error(err) // DEBUG
+			return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
+		}
+		err = json.Unmarshal(b, &msg)
+		if err != nil {
+			s.GlobalService.Logger.Sugar().Error(err) // DEBUG
+			return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
+		}
+		err = s.checkChainID(msg.ChainID)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message : %w", err)
+		}
+		return &msg, nil
+	case models.TransactionMsgType:
+		s.GlobalService.Logger.Sugar().Debugf("got message from saiP2p detected type : %s", models.TransactionMsgType) // DEBUG
+		msg := models.Tx{}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
+		}
+		err = json.Unmarshal(b, &msg)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
+		}
+		err = s.checkChainID(msg.ChainID)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message : %w", err)
+		}
+		return &msg, nil
+	case models.SnapshotMsgType:
+		s.GlobalService.Logger.Sugar().Debugf("got message from saiP2p detected type : %s", models.SnapshotMsgType) // DEBUG
+		msg := models.SnapshotManifest{}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
+		}
+		err = json.Unmarshal(b, &msg)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
+		}
+		err = s.checkChainID(msg.ChainID)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message : %w", err)
+		}
+		return &msg, nil
+	case models.RequestMsgType:
+		msg := models.PeerRequest{}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
+		}
+		err = json.Unmarshal(b, &msg)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
+		}
+		err = msg.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - validate request : %w", err)
+		}
+		return &msg, nil
+	case models.ResponseMsgType:
+		msg := models.PeerResponse{}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - unmarshal : %w", err)
+		}
+		err = json.Unmarshal(b, &msg)
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - marshal bytes : %w", err)
+		}
+		err = msg.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("handlers - handle message - validate response : %w", err)
+		}
+		return &msg, nil
+	default:
+		s.GlobalService.Logger.Sugar().Errorf("got message from saiP2p wrong detected type : %s", msgType) // DEBUG
+		return nil, errors.New("handlers - handle message - wrong message type" + msgType)
+	}
+}
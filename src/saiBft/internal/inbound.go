@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"go.uber.org/zap"
+)
+
+var errInboundOverloaded = errors.New("inbound queue is full, message is dropped")
+
+// class of inbound message, each class has own queue and workers
+type msgClass int
+
+const (
+	classConsensus msgClass = iota // consensus votes, highest priority
+	classBlock                     // blocks and snapshot manifests
+	classRequest                   // direct requests of other nodes
+	classTx                        // transactions, lowest priority
+	numClasses
+)
+
+func (c msgClass) String() string {
+	switch c {
+	case classConsensus:
+		return "consensus"
+	case classBlock:
+		return "block"
+	case classRequest:
+		return "request"
+	case classTx:
+		return "tx"
+	default:
+		return "unknown"
+	}
+}
+
+// counters of inbound queue
+type queueStats struct {
+	accepted   uint64
+	shed       uint64 // dropped, because queue was full
+	handled    uint64
+	overloaded uint32 // 1 since the first shed message until queue accepts again
+}
+
+// InboundStats is a state of inbound queue of one message class
+type InboundStats struct {
+	Accepted uint64 `json:"accepted"`
+	Shed     uint64 `json:"shed"`
+	Handled  uint64 `json:"handled"`
+	Depth    int    `json:"depth"`
+	Capacity int    `json:"capacity"`
+	Workers  int    `json:"workers"`
+}
+
+// bounded queues of inbound messages, handlers of transport never block on them
+// overloaded queue sheds new messages, consensus messages are taken first by tx workers too
+type inboundPipeline struct {
+	consensus chan *models.ConsensusMessage
+	block     chan interface{} // *models.BlockConsensusMessage, *models.SnapshotManifest
+	request   chan *models.PeerRequest
+	tx        chan *models.Tx
+	workers   [numClasses]int
+	stats     [numClasses]queueStats
+	txMu      sync.Mutex // check and save of tx is not interleaved by tx workers
+}
+
+func (s *InternalService) newInboundPipeline() *inboundPipeline {
+	p := &inboundPipeline{
+		consensus: make(chan *models.ConsensusMessage, s.GlobalService.GetConfig("inbound.consensus_queue", 1024).(int)),
+		block:     make(chan interface{}, s.GlobalService.GetConfig("inbound.block_queue", 256).(int)),
+		request:   make(chan *models.PeerRequest, s.GlobalService.GetConfig("inbound.request_queue", 256).(int)),
+		tx:        make(chan *models.Tx, s.GlobalService.GetConfig("inbound.tx_queue", 1024).(int)),
+	}
+	p.workers[classConsensus] = s.GlobalService.GetConfig("inbound.consensus_workers", 4).(int)
+	// blocks are applied to the chain in order of arrival
+	p.workers[classBlock] = 1
+	p.workers[classRequest] = s.GlobalService.GetConfig("inbound.request_workers", 2).(int)
+	p.workers[classTx] = s.GlobalService.GetConfig("inbound.tx_workers", 2).(int)
+	for class := range p.workers {
+		if p.workers[class] < 1 {
+			p.workers[class] = 1
+		}
+	}
+	return p
+}
+
+// pass message to the queue of its class without blocking
+// errInboundOverloaded is returned if the queue is full, message is dropped if node is stopped
+func (s *InternalService) enqueue(msg interface{}) error {
+	if s.stopped() {
+		return nil
+	}
+	p := s.inbound
+	var class msgClass
+	var queued bool
+	switch m := msg.(type) {
+	case *models.ConsensusMessage:
+		class = classConsensus
+		select {
+		case p.consensus <- m:
+			queued = true
+		default:
+		}
+	case *models.BlockConsensusMessage, *models.SnapshotManifest:
+		class = classBlock
+		select {
+		case p.block <- m:
+			queued = true
+		default:
+		}
+	case *models.PeerRequest:
+		class = classRequest
+		select {
+		case p.request <- m:
+			queued = true
+		default:
+		}
+	case *models.Tx:
+		class = classTx
+		select {
+		case p.tx <- m:
+			queued = true
+		default:
+		}
+	default:
+		return fmt.Errorf("inbound - wrong msg type : %v", reflect.TypeOf(msg))
+	}
+
+	stats := &p.stats[class]
+	if queued {
+		atomic.AddUint64(&stats.accepted, 1)
+		if atomic.CompareAndSwapUint32(&stats.overloaded, 1, 0) {
+			s.GlobalService.Logger.Info("inbound - queue accepts messages again", zap.Stringer("class", class), zap.Uint64("shed", atomic.LoadUint64(&stats.shed)))
+		}
+		return nil
+	}
+	atomic.AddUint64(&stats.shed, 1)
+	if atomic.CompareAndSwapUint32(&stats.overloaded, 0, 1) {
+		s.GlobalService.Logger.Warn("inbound - queue is full, shedding messages", zap.Stringer("class", class))
+	}
+	return fmt.Errorf("%w : %s", errInboundOverloaded, class)
+}
+
+// start workers of inbound queues, workers are stopped with the node
+func (s *InternalService) startInbound() {
+	p := s.inbound
+	for class, workers := range p.workers {
+		for i := 0; i < workers; i++ {
+			s.running.Add(1)
+			go func(class msgClass) {
+				defer s.running.Done()
+				s.inboundWorker(class)
+			}(msgClass(class))
+		}
+	}
+	s.GlobalService.Logger.Debug("inbound - workers started", zap.Ints("workers", p.workers[:])) // DEBUG
+}
+
+func (s *InternalService) inboundWorker(class msgClass) {
+	p := s.inbound
+	for {
+		// pending consensus messages are handled before transactions
+		if class == classTx {
+			select {
+			case msg := <-p.consensus:
+				s.handleInbound(classConsensus, msg)
+				continue
+			default:
+			}
+		}
+
+		var msg interface{}
+		var from msgClass
+		switch class {
+		case classConsensus:
+			select {
+			case m := <-p.consensus:
+				msg, from = m, classConsensus
+			case <-s.ctx.Done():
+				return
+			}
+		case classBlock:
+			select {
+			case m := <-p.block:
+				msg, from = m, classBlock
+			case <-s.ctx.Done():
+				return
+			}
+		case classRequest:
+			select {
+			case m := <-p.request:
+				msg, from = m, classRequest
+			case <-s.ctx.Done():
+				return
+			}
+		case classTx:
+			select {
+			case m := <-p.consensus:
+				msg, from = m, classConsensus
+			case m := <-p.tx:
+				msg, from = m, classTx
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		s.handleInbound(from, msg)
+	}
+}
+
+func (s *InternalService) handleInbound(class msgClass, msg interface{}) {
+	s.handleQueuedMsg(msg)
+	atomic.AddUint64(&s.inbound.stats[class].handled, 1)
+}
+
+// InboundStats returns counters of inbound queues by message class
+func (s *InternalService) InboundStats() map[string]*InboundStats {
+	p := s.inbound
+	depth := [numClasses]int{len(p.consensus), len(p.block), len(p.request), len(p.tx)}
+	capacity := [numClasses]int{cap(p.consensus), cap(p.block), cap(p.request), cap(p.tx)}
+	stats := make(map[string]*InboundStats, numClasses)
+	for class := msgClass(0); class < numClasses; class++ {
+		stats[class.String()] = &InboundStats{
+			Accepted: atomic.LoadUint64(&p.stats[class].accepted),
+			Shed:     atomic.LoadUint64(&p.stats[class].shed),
+			Handled:  atomic.LoadUint64(&p.stats[class].handled),
+			Depth:    depth[class],
+			Capacity: capacity[class],
+			Workers:  p.workers[class],
+		}
+	}
+	return stats
+}
@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"go.uber.org/zap"
+)
+
+// new keys are kept here until key rotation becomes effective
+const btcNextKeyFile = "btc_keys.next.json"
+
+// keyRegistry knows which key every validator uses at each height
+// validator without rotations signs by the key of its address
+type keyRegistry struct {
+	mu        sync.RWMutex
+	rotations map[string][]*models.KeyRotation // validator -> rotations ordered by height
+}
+
+func newKeyRegistry(rotations []*models.KeyRotation) *keyRegistry {
+	r := &keyRegistry{
+		rotations: make(map[string][]*models.KeyRotation),
+	}
+	for _, rotation := range rotations {
+		r.add(rotation)
+	}
+	return r
+}
+
+// add rotation, rotation with the same height is replaced
+func (r *keyRegistry) add(rotation *models.KeyRotation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rotations := r.rotations[rotation.Validator]
+	for i, existing := range rotations {
+		if existing.Height == rotation.Height {
+			rotations[i] = rotation
+			return
+		}
+	}
+	rotations = append(rotations, rotation)
+	sort.Slice(rotations, func(i, j int) bool {
+		return rotations[i].Height < rotations[j].Height
+	})
+	r.rotations[rotation.Validator] = rotations
+}
+
+// key address of the validator at the height
+func (r *keyRegistry) keyAt(validator string, height int) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := validator
+	for _, rotation := range r.rotations[validator] {
+		if rotation.Height > height {
+			break
+		}
+		key = rotation.NewAddress
+	}
+	return key
+}
+
+// validator, which the key was rotated to
+func (r *keyRegistry) validatorOf(key string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for validator, rotations := range r.rotations {
+		for _, rotation := range rotations {
+			if rotation.NewAddress == key {
+				return validator, true
+			}
+		}
+	}
+	return "", false
+}
+
+// address of the node as validator, it stays the same after key rotations
+func (s *InternalService) validatorAddress() string {
+	if address := s.GlobalService.GetConfig("validator_address", "").(string); address != "" {
+		return address
+	}
+	address := s.currentSigner().Address()
+	if validator, ok := s.keyRegistry.validatorOf(address); ok {
+		return validator
+	}
+	return address
+}
+
+// validate signature of validator message by the validator key at the height
+func (s *InternalService) validateValidatorSignature(msg interface{}, validator string, height int, signature string) error {
+	return s.validateSignature(msg, s.keyRegistry.keyAt(validator, height), signature)
+}
+
+// save block to blockchain and apply key rotations from it
+func (s *InternalService) saveBlock(block *models.BlockConsensusMessage) error {
+	err := s.Storage.PutBlock(block)
+	if err != nil {
+		return err
+	}
+	s.applyKeyRotations(block.Block.Number, block.Block.Messages)
+	return nil
+}
+
+// apply key rotation txs, which were committed at the block
+// invalid rotations are skipped, they are the part of the block anyway
+func (s *InternalService) applyKeyRotations(blockNumber int, txs map[string]*models.Tx) {
+	hashes := make([]string, 0, len(txs))
+	for hash := range txs {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	for _, hash := range hashes {
+		tx := txs[hash]
+		rotation, err := models.KeyRotationFromTx(tx)
+		if err != nil {
+			s.GlobalService.Logger.Error("key rotation - parse rotation tx", zap.String("hash", hash), zap.Error(err))
+			continue
+		}
+		if rotation == nil {
+			continue
+		}
+
+		err = s.applyKeyRotation(tx, rotation, blockNumber)
+		if err != nil {
+			s.GlobalService.Logger.Error("key rotation - apply", zap.String("hash", hash), zap.String("validator", rotation.Validator), zap.Error(err))
+			continue
+		}
+		s.GlobalService.Logger.Info("key rotation - applied", zap.String("validator", rotation.Validator), zap.String("new key", rotation.NewAddress), zap.Int("height", rotation.Height))
+	}
+}
+
+// 1. validator is trusted and the tx is sent by its current key
+// 2. new key signed the rotation
+// 3. rotation becomes effective after the block, so committed blocks keep their keys
+func (s *InternalService) applyKeyRotation(tx *models.Tx, rotation *models.KeyRotation, blockNumber int) error {
+	err := s.checkChainID(rotation.ChainID)
+	if err != nil {
+		return err
+	}
+	if !s.isTrustedValidator(rotation.Validator) {
+		return fmt.Errorf("validator %s is not trusted", rotation.Validator)
+	}
+
+	currentKey := s.keyRegistry.keyAt(rotation.Validator, blockNumber)
+	if tx.SenderAddress != currentKey {
+		return fmt.Errorf("rotation is sent by %s, current validator key is %s", tx.SenderAddress, currentKey)
+	}
+	err = s.validateSignature(tx, tx.SenderAddress, tx.SenderSignature)
+	if err != nil {
+		return fmt.Errorf("validate old key signature : %w", err)
+	}
+	err = s.validateSignature(rotation, rotation.NewAddress, rotation.NewSignature)
+	if err != nil {
+		return fmt.Errorf("validate new key signature : %w", err)
+	}
+
+	if rotation.Height <= blockNumber {
+		return fmt.Errorf("rotation height %d is not after the block %d", rotation.Height, blockNumber)
+	}
+
+	rotation.OldAddress = currentKey
+	rotation.BlockNumber = blockNumber
+	err = s.Storage.PutKeyRotation(rotation)
+	if err != nil {
+		return err
+	}
+	s.keyRegistry.add(rotation)
+	return nil
+}
+
+// create key rotation tx, which is signed by current key, new keys are kept till the height
+func (s *InternalService) rotateKey(newKeysPath string, height int) (string, error) {
+	data, err := ioutil.ReadFile(newKeysPath)
+	if err != nil {
+		return "", fmt.Errorf("read new keys : %w", err)
+	}
+	newKeys := &models.BtcKeys{}
+	err = json.Unmarshal(data, newKeys)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal new keys : %w", err)
+	}
+	err = newKeys.Validate()
+	if err != nil {
+		return "", fmt.Errorf("validate new keys : %w", err)
+	}
+
+	newSigner, _, err := s.NewSigner(newKeys)
+	if err != nil {
+		return "", fmt.Errorf("create signer of new keys : %w", err)
+	}
+
+	rotation := &models.KeyRotation{
+		ChainID:    s.chainID(),
+		Validator:  s.validatorAddress(),
+		NewAddress: newKeys.Address,
+		Height:     height,
+	}
+	payload, err := models.SignPayload(rotation)
+	if err != nil {
+		return "", err
+	}
+	rotation.NewSignature, err = newSigner.Sign(payload)
+	if err != nil {
+		return "", fmt.Errorf("sign rotation by new key : %w", err)
+	}
+
+	rotationBytes, err := json.Marshal(rotation)
+	if err != nil {
+		return "", fmt.Errorf("marshal rotation : %w", err)
+	}
+
+	err = s.saveBTCkeys(btcNextKeyFile, newKeys)
+	if err != nil {
+		return "", fmt.Errorf("save new keys : %w", err)
+	}
+
+	err = s.SendTx(&models.TxMessage{
+		Method: models.KeyRotationMethod,
+		Params: []string{string(rotationBytes)},
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("key rotation sent, new key %s is valid from height %d", newKeys.Address, height), nil
+}
+
+// switch to new keys, when key rotation of the node becomes effective at the height
+func (s *InternalService) rotateSignerIfNeeded(height int) {
+	key := s.keyRegistry.keyAt(s.validatorAddress(), height)
+	if key == s.currentSigner().Address() {
+		return
+	}
+
+	if s.isRemoteSigner() {
+		s.reconnectRemoteSigner(key, height)
+		return
+	}
+
+	newKeys, err := s.readBTCkeys(btcNextKeyFile)
+	if err != nil {
+		s.GlobalService.Logger.Error("key rotation - read new keys", zap.String("expected key", key), zap.Error(err))
+		return
+	}
+	if newKeys.Address != key {
+		s.GlobalService.Logger.Error("key rotation - new keys do not match rotation", zap.String("expected key", key), zap.String("new keys", newKeys.Address))
+		return
+	}
+
+	newSigner, _, err := s.NewSigner(newKeys)
+	if err != nil {
+		s.GlobalService.Logger.Error("key rotation - create signer", zap.Error(err))
+		return
+	}
+
+	err = os.Rename(btcNextKeyFile, btcKeyFile)
+	if err != nil {
+		// bind mounted keys file can not be replaced by rename
+		err = s.saveBTCkeys(btcKeyFile, newKeys)
+		if err != nil {
+			s.GlobalService.Logger.Error("key rotation - save new keys", zap.Error(err))
+			return
+		}
+	}
+
+	s.setSigner(newSigner)
+	s.Mutex.Lock()
+	s.BTCkeys = newKeys
+	s.Mutex.Unlock()
+	s.GlobalService.Logger.Info("key rotation - switched to new key", zap.String("key", key), zap.Int("height", height))
+}
+
+// new key of remote signer is set at signer process, node reconnects to get it
+func (s *InternalService) reconnectRemoteSigner(key string, height int) {
+	remote, newKeys, err := s.newRemoteSigner()
+	if err != nil {
+		s.GlobalService.Logger.Error("key rotation - connect to remote signer", zap.Error(err))
+		return
+	}
+	if newKeys.Address != key {
+		remote.Close()
+		s.GlobalService.Logger.Error("key rotation - remote signer key does not match rotation", zap.String("expected key", key), zap.String("signer key", newKeys.Address))
+		return
+	}
+
+	// signing with the old connection, which is in progress, fails
+	if old, ok := s.setSigner(remote).(*signer.RemoteSigner); ok {
+		old.Close()
+	}
+	s.Mutex.Lock()
+	s.BTCkeys = newKeys
+	s.Mutex.Unlock()
+	s.GlobalService.Logger.Info("key rotation - switched to new key", zap.String("key", key), zap.Int("height", height))
+}
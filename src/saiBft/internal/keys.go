@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/iamthe1whoknocks/bft/keystore"
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPassphraseEnv    = "BFT_KEYSTORE_PASSPHRASE"
+	defaultNewPassphraseEnv = "BFT_KEYSTORE_NEW_PASSPHRASE"
+)
+
+// get node keys from keystore file, new keys are generated if there are no valid keys
+// plaintext keys are encrypted in place if keystore_encrypted is set
+func (s *InternalService) GetBTCkeys(fileStr string) (*models.BtcKeys, error) {
+	data, err := ioutil.ReadFile(fileStr)
+	if err != nil && !os.IsNotExist(err) {
+		s.GlobalService.Logger.Error("processing - read key btc file", zap.Error(err))
+		return nil, err
+	}
+
+	if keystore.IsEncrypted(data) {
+		btcKeys, err := s.decryptBTCkeys(data)
+		if err != nil {
+			s.GlobalService.Logger.Error("processing - decrypt keystore", zap.Error(err))
+			return nil, err
+		}
+		return btcKeys, nil
+	}
+
+	btcKeys := &models.BtcKeys{}
+	err = json.Unmarshal(data, btcKeys)
+	if err == nil {
+		err = btcKeys.Validate()
+	}
+	if err != nil {
+		s.GlobalService.Logger.Debug("get btc keys - no valid keys in file, generating new keys", zap.String("file", fileStr))
+		btcKeys, err = s.generateBTCkeys(s.GlobalService.GetConfig("key_type", signer.KeyTypeBtc).(string))
+		if err != nil {
+			s.GlobalService.Logger.Error("processing - get btc keys", zap.Error(err))
+			return nil, err
+		}
+		err = s.saveBTCkeys(fileStr, btcKeys)
+		if err != nil {
+			s.GlobalService.Logger.Error("processing - write btc keys to file", zap.Error(err))
+			return nil, err
+		}
+		return btcKeys, nil
+	}
+
+	if s.keystoreEncrypted() {
+		s.GlobalService.Logger.Warn("get btc keys - plaintext keys found, encrypting keystore", zap.String("file", fileStr))
+		err = s.saveBTCkeys(fileStr, btcKeys)
+		if err != nil {
+			s.GlobalService.Logger.Error("processing - encrypt plaintext keys", zap.Error(err))
+			return nil, err
+		}
+	}
+	return btcKeys, nil
+}
+
+// read existing keys from plaintext or encrypted file
+func (s *InternalService) readBTCkeys(fileStr string) (*models.BtcKeys, error) {
+	data, err := ioutil.ReadFile(fileStr)
+	if err != nil {
+		return nil, err
+	}
+	if keystore.IsEncrypted(data) {
+		return s.decryptBTCkeys(data)
+	}
+
+	btcKeys := &models.BtcKeys{}
+	err = json.Unmarshal(data, btcKeys)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal keys : %w", err)
+	}
+	return btcKeys, btcKeys.Validate()
+}
+
+func (s *InternalService) decryptBTCkeys(data []byte) (*models.BtcKeys, error) {
+	passphrase, err := s.keystorePassphrase()
+	if err != nil {
+		return nil, err
+	}
+	return keystore.Decrypt(data, passphrase)
+}
+
+// save keys to file, encrypted if keystore_encrypted is set
+func (s *InternalService) saveBTCkeys(fileStr string, btcKeys *models.BtcKeys) error {
+	if !s.keystoreEncrypted() {
+		return writePlainKeys(fileStr, btcKeys)
+	}
+
+	passphrase, err := s.keystorePassphrase()
+	if err != nil {
+		return err
+	}
+	return writeEncryptedKeys(fileStr, btcKeys, passphrase)
+}
+
+// import plaintext keys, current keys are replaced
+func (s *InternalService) importBTCkeys(fileStr, importPath string) (string, error) {
+	data, err := ioutil.ReadFile(importPath)
+	if err != nil {
+		return "", fmt.Errorf("read keys to import : %w", err)
+	}
+
+	btcKeys := &models.BtcKeys{}
+	err = json.Unmarshal(data, btcKeys)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal keys to import : %w", err)
+	}
+	err = btcKeys.Validate()
+	if err != nil {
+		return "", fmt.Errorf("validate keys to import : %w", err)
+	}
+
+	// check that private key belongs to the address before replacing node keys
+	_, _, err = s.NewSigner(btcKeys)
+	if err != nil {
+		return "", fmt.Errorf("check keys to import : %w", err)
+	}
+
+	err = s.saveBTCkeys(fileStr, btcKeys)
+	if err != nil {
+		return "", err
+	}
+	s.GlobalService.Logger.Warn("keys - keys imported", zap.String("address", btcKeys.Address), zap.String("previous address", s.BTCkeys.Address))
+	return fmt.Sprintf("keys imported, address : %s", btcKeys.Address), nil
+}
+
+// export decrypted keys to plaintext file
+func (s *InternalService) exportBTCkeys(fileStr, exportPath string) (string, error) {
+	btcKeys, err := s.GetBTCkeys(fileStr)
+	if err != nil {
+		return "", err
+	}
+
+	err = writePlainKeys(exportPath, btcKeys)
+	if err != nil {
+		return "", err
+	}
+	s.GlobalService.Logger.Warn("keys - keys exported to plaintext file", zap.String("address", btcKeys.Address), zap.String("path", exportPath))
+	return fmt.Sprintf("keys exported to %s", exportPath), nil
+}
+
+// encrypt keystore by new passphrase
+// new passphrase is read from keystore_new_passphrase_env variable or asked interactively
+func (s *InternalService) changeKeystorePassphrase(fileStr string) (string, error) {
+	data, err := ioutil.ReadFile(fileStr)
+	if err != nil {
+		return "", fmt.Errorf("read keystore : %w", err)
+	}
+	if !keystore.IsEncrypted(data) {
+		return "", errors.New("keystore is not encrypted")
+	}
+
+	btcKeys, err := s.decryptBTCkeys(data)
+	if err != nil {
+		return "", err
+	}
+
+	envName := s.GlobalService.GetConfig("keystore_new_passphrase_env", defaultNewPassphraseEnv).(string)
+	newPassphrase, err := keystore.Passphrase(envName, "", "New keystore passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	// interactive passphrase is asked twice
+	if os.Getenv(envName) == "" {
+		repeated, err := keystore.Prompt("Repeat new keystore passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if string(repeated) != string(newPassphrase) {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+
+	err = writeEncryptedKeys(fileStr, btcKeys, newPassphrase)
+	if err != nil {
+		return "", err
+	}
+	s.keystorePass = newPassphrase
+	return "keystore passphrase changed", nil
+}
+
+// keys are encrypted by default, keystore_encrypted: false keeps plaintext keys file
+func (s *InternalService) keystoreEncrypted() bool {
+	return s.GlobalService.GetConfig("keystore_encrypted", true).(bool)
+}
+
+// passphrase of keystore, which is read once
+func (s *InternalService) keystorePassphrase() ([]byte, error) {
+	if s.keystorePass != nil {
+		return s.keystorePass, nil
+	}
+
+	envName := s.GlobalService.GetConfig("keystore_passphrase_env", defaultPassphraseEnv).(string)
+	path := s.GlobalService.GetConfig("keystore_passphrase_file", "").(string)
+	passphrase, err := keystore.Passphrase(envName, path, "Keystore passphrase: ")
+	if err != nil {
+		return nil, fmt.Errorf("get keystore passphrase, set %s env variable or keystore_passphrase_file, keystore_encrypted: false keeps keys unencrypted : %w", envName, err)
+	}
+	s.keystorePass = passphrase
+	return passphrase, nil
+}
+
+func writePlainKeys(fileStr string, btcKeys *models.BtcKeys) error {
+	data, err := json.Marshal(btcKeys)
+	if err != nil {
+		return fmt.Errorf("marshal keys : %w", err)
+	}
+	return writeKeysFile(fileStr, data)
+}
+
+func writeEncryptedKeys(fileStr string, btcKeys *models.BtcKeys, passphrase []byte) error {
+	data, err := keystore.Encrypt(btcKeys, passphrase)
+	if err != nil {
+		return fmt.Errorf("encrypt keys : %w", err)
+	}
+	return writeKeysFile(fileStr, data)
+}
+
+// keys file is readable only by owner, existing file is replaced atomically
+func writeKeysFile(fileStr string, data []byte) error {
+	tmp := fileStr + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("write keys file : %w", err)
+	}
+	err = os.Rename(tmp, fileStr)
+	if err != nil {
+		// bind mounted files (docker volumes) can not be replaced by rename
+		os.Remove(tmp)
+		err = ioutil.WriteFile(fileStr, data, 0600)
+		if err != nil {
+			return fmt.Errorf("write keys file : %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// metrics of the node, they are collected on scrape of /metrics of saiService
+var (
+	inboundAcceptedDesc = prometheus.NewDesc("bft_inbound_accepted_total", "Messages accepted to inbound queue.", []string{"class"}, nil)
+	inboundShedDesc     = prometheus.NewDesc("bft_inbound_shed_total", "Messages dropped, because inbound queue was full.", []string{"class"}, nil)
+	inboundHandledDesc  = prometheus.NewDesc("bft_inbound_handled_total", "Messages handled by inbound workers.", []string{"class"}, nil)
+	inboundDepthDesc    = prometheus.NewDesc("bft_inbound_depth", "Messages waiting in inbound queue.", []string{"class"}, nil)
+	inboundCapacityDesc = prometheus.NewDesc("bft_inbound_capacity", "Capacity of inbound queue.", []string{"class"}, nil)
+	heightDesc          = prometheus.NewDesc("bft_height", "Number of the last block of the node.", nil, nil)
+)
+
+type nodeCollector struct {
+	s *InternalService
+}
+
+func (c *nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- inboundAcceptedDesc
+	ch <- inboundShedDesc
+	ch <- inboundHandledDesc
+	ch <- inboundDepthDesc
+	ch <- inboundCapacityDesc
+	ch <- heightDesc
+}
+
+func (c *nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	for class, stats := range c.s.InboundStats() {
+		ch <- prometheus.MustNewConstMetric(inboundAcceptedDesc, prometheus.CounterValue, float64(stats.Accepted), class)
+		ch <- prometheus.MustNewConstMetric(inboundShedDesc, prometheus.CounterValue, float64(stats.Shed), class)
+		ch <- prometheus.MustNewConstMetric(inboundHandledDesc, prometheus.CounterValue, float64(stats.Handled), class)
+		ch <- prometheus.MustNewConstMetric(inboundDepthDesc, prometheus.GaugeValue, float64(stats.Depth), class)
+		ch <- prometheus.MustNewConstMetric(inboundCapacityDesc, prometheus.GaugeValue, float64(stats.Capacity), class)
+	}
+
+	// height is not reported, if storage is unavailable
+	height, err := c.s.height()
+	if err != nil {
+		c.s.GlobalService.Logger.Error("metrics - get height", zap.Error(err))
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(heightDesc, prometheus.GaugeValue, float64(height.Height))
+}
+
+// register metrics of the node in saiService
+func (s *InternalService) registerMetrics() {
+	err := s.GlobalService.RegisterMetrics(&nodeCollector{s: s})
+	if err != nil {
+		s.GlobalService.Logger.Error("metrics - register", zap.Error(err))
+	}
+}
@@ -1,22 +1,15 @@
 package internal
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
-	"net/http"
-	"net/url"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/iamthe1whoknocks/bft/models"
-	"github.com/iamthe1whoknocks/bft/utils"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/iamthe1whoknocks/bft/storage"
 	"go.uber.org/zap"
 )
 
@@ -25,37 +18,32 @@ var (
 )
 
 const (
-	blockchainCollection = "Blockchain"
-	maxRoundNumber       = 7
-	btcKeyFile           = "btc_keys.json"
+	maxRoundNumber = 7
+	btcKeyFile     = "btc_keys.json"
 )
 
-// main process of blockchain
-func (s *InternalService) Processing() {
-	saiBtcAddress, ok := s.GlobalService.Configuration["saiBTC_address"].(string)
-	if !ok {
-		s.GlobalService.Logger.Fatal("processing - wrong type of saiBTC address value from config")
-	}
-
-	saiP2Paddress, ok := s.GlobalService.Configuration["saiP2P_address"].(string)
-	if !ok {
-		s.GlobalService.Logger.Fatal("processing - wrong type of saiP2P address value from config")
+// duration of consensus round
+// sleep_ms allows rounds shorter than a second (simulation)
+func (s *InternalService) roundDuration() time.Duration {
+	sleepMs := s.GlobalService.GetConfig("sleep_ms", 0).(int)
+	if sleepMs > 0 {
+		return time.Duration(sleepMs) * time.Millisecond
 	}
+	return time.Duration(s.GlobalService.Configuration["sleep"].(int)) * time.Second
+}
 
+// main process of blockchain
+func (s *InternalService) Processing() {
 	s.GlobalService.Logger.Sugar().Debugf("starting processing") //DEBUG
 
 	// for tests
-	//btcKeys1, _ := s.getBTCkeys("btc_keys3.json", saiBtcAddress)
-	// btcKeys2, _ := s.getBTCkeys("btc_keys2.json", saiBtcAddress)
-	// btcKeys3, _ := s.getBTCkeys("btc_keys1.json", saiBtcAddress)
+	//btcKeys1, _ := s.getBTCkeys("btc_keys3.json")
+	// btcKeys2, _ := s.getBTCkeys("btc_keys2.json")
+	// btcKeys3, _ := s.getBTCkeys("btc_keys1.json")
 	//s.TrustedValidators = append(s.TrustedValidators, s.BTCkeys.Address)
 	//
 	//s.GlobalService.Logger.Sugar().Debugf("btc keys : %+v\n", s.BTCkeys) //DEBUG
 	//
-	storageToken, ok := s.GlobalService.Configuration["storage_token"].(string)
-	if !ok {
-		s.GlobalService.Logger.Fatal("handlers - processing - wrong type of storage token value from config")
-	}
 
 	// get trusted validators from config
 
@@ -70,41 +58,75 @@ func (s *InternalService) Processing() {
 
 	s.GlobalService.Logger.Sugar().Debugf("got trusted validators : %v", s.TrustedValidators) //DEBUG
 
+	// restore state from snapshot of connected nodes instead of replaying all blocks
+	if s.GlobalService.GetConfig("fast_sync", false).(bool) {
+		s.fastSyncIfNeeded()
+	}
+
 	//TEST transaction &consensus messages
-	s.saveTestTx(saiBtcAddress, storageToken, saiP2Paddress)
+	s.saveTestTx()
+
+	// continue the height from the round of the last vote, if node was restarted
+	resume := true
 
 	for {
 
 	startLoop:
+		if s.stopped() {
+			s.GlobalService.Logger.Debug("process - stopped") // DEBUG
+			return
+		}
 		round := 0
 		s.GlobalService.Logger.Debug("start loop,round = 0") // DEBUG
-		time.Sleep(1 * time.Second)                          //DEBUG
+		s.wait(1 * time.Second)                              //DEBUG
 
 		// get last block from blockchain collection or create initial block
-		block, err := s.getLastBlockFromBlockChain(storageToken, saiBtcAddress)
+		block, err := s.getLastBlockFromBlockChain()
 		if err != nil {
 			continue
 		}
+
+		// key rotation of the node could become effective at this block
+		s.rotateSignerIfNeeded(block.Block.Number)
+
+		s.truncateWAL(block.Block.Number)
+		if resume {
+			resume = false
+			round = s.resumeRound(block.Block.Number)
+			if round > 0 {
+				s.GlobalService.Logger.Info("process - resume height from wal", zap.Int("height", block.Block.Number), zap.Int("round", round))
+			}
+		}
 	checkRound:
-		// for testing purposes
+		if s.stopped() {
+			s.GlobalService.Logger.Debug("process - stopped") // DEBUG
+			return
+		}
+		s.step = consensusStep{Height: block.Block.Number, Round: round}
 
 		s.GlobalService.Logger.Sugar().Debugf("ROUND = %d", round) //DEBUG
 		if round == 0 {
 			// get messages with votes = 0
-			transactions, err := s.getZeroVotedTransactions(storageToken)
+			transactions, err := s.getZeroVotedTransactions()
 			if err != nil {
 				s.GlobalService.Logger.Error("process - round == 0 - get zero-voted tx messages", zap.Error(err))
 			}
 			consensusMsg := &models.ConsensusMessage{
 				Type:          models.ConsensusMsgType,
-				SenderAddress: s.BTCkeys.Address,
+				ChainID:       s.chainID(),
+				SenderAddress: s.validatorAddress(),
 				BlockNumber:   block.Block.Number,
 				Round:         round,
 			}
-			// validate/execute each tx msg, update hash and votes
+			// validate signatures of all tx msgs at once, then execute valid ones, update hash and votes
 			if len(transactions) != 0 {
-				for _, tx := range transactions {
-					err = s.validateExecuteTransactionMsg(tx, saiBtcAddress, storageToken)
+				signatureErrs := s.validateTxSignatures(transactions)
+				for i, tx := range transactions {
+					if signatureErrs[i] != nil {
+						s.GlobalService.Logger.Error("process - round == 0 - validate tx msg signature", zap.String("hash", tx.MessageHash), zap.Error(signatureErrs[i]))
+						continue
+					}
+					err = s.executeTransactionMsg(tx)
 					if err != nil {
 						continue
 					}
@@ -120,38 +142,38 @@ func (s *InternalService) Processing() {
 				goto startLoop
 			}
 
-			btcResp, err := utils.SignMessage(consensusMsg, saiBtcAddress, s.BTCkeys.Private)
+			consensusMsg, err = s.signVote(consensusMsg)
 			if err != nil {
 				s.GlobalService.Logger.Error("process - round==0 - sign consensus message", zap.Error(err))
 				goto startLoop
 			}
-			consensusMsg.Signature = btcResp.Signature
 
-			err, _ = s.Storage.Put("ConsensusPool", consensusMsg, storageToken)
+			err = s.Storage.PutConsensusMsg(consensusMsg)
 			if err != nil {
 				s.GlobalService.Logger.Error("process - round == 0 - put consensus to ConsensusPool collection", zap.Error(err))
 				goto startLoop
 			}
 
-			err = s.broadcastMsg(consensusMsg, saiP2Paddress)
+			err = s.broadcastMsg(consensusMsg)
 			if err != nil {
 				s.GlobalService.Logger.Error("process - round==0 - broadcast consensus message", zap.Error(err))
 				goto startLoop
 			}
 
-			time.Sleep(time.Duration(s.GlobalService.Configuration["sleep"].(int)) * time.Second)
+			s.wait(s.roundDuration())
 			round++
 			goto checkRound
 
 		} else {
 			// get consensus messages for the round
-			msgs, err := s.getConsensusMsgForTheRound(round, block.Block.Number, storageToken)
+			msgs, err := s.getConsensusMsgForTheRound(round, block.Block.Number)
 			if err != nil {
 				goto startLoop
 			}
 
 			//	if round < maxRoundNumber {
 			// update votes for each transaction msg from consensus msg
+			counted := make(map[string]bool)
 			for _, msg := range msgs {
 				// check if consensus message sender is from trusted validators list
 				err = checkConsensusMsgSender(s.TrustedValidators, msg)
@@ -160,20 +182,25 @@ func (s *InternalService) Processing() {
 					continue
 				}
 
+				// votes of each validator are counted once at the round, also if the round is resumed after restart
+				if counted[msg.SenderAddress] || !s.markVotesCounted(msg) {
+					continue
+				}
+				counted[msg.SenderAddress] = true
+
 				s.GlobalService.Logger.Sugar().Debugf("Consensus message transactions: %v", msg.Messages) //DEBUG
 
 				// update votes for each tx message from consensusMsg
 				for _, txMsgHash := range msg.Messages {
-					err, result := s.Storage.Get("MessagesPool", bson.M{"message_hash": txMsgHash}, bson.M{}, storageToken)
+					_, err := s.Storage.TxByHash(txMsgHash)
 					if err != nil {
-						s.GlobalService.Logger.Error("process - get msg from consensus msg from storage", zap.Error(err))
+						if !errors.Is(err, storage.ErrNotFound) {
+							s.GlobalService.Logger.Error("process - get msg from consensus msg from storage", zap.Error(err))
+						}
 						continue
 					}
 
-					if len(result) == 2 {
-						continue
-					}
-					err = s.updateTxMsgVotes(txMsgHash, storageToken, round)
+					err = s.updateTxMsgVotes(txMsgHash, round)
 					if err != nil {
 						continue
 					}
@@ -182,19 +209,20 @@ func (s *InternalService) Processing() {
 			//}
 
 			// get messages with votes>=(roundNumber*10)%
-			txMsgs, err := s.getTxMsgsWithCertainNumberOfVotes(storageToken, round)
+			txMsgs, err := s.getTxMsgsWithCertainNumberOfVotes(round)
 			if err != nil {
 				if errors.Is(err, errNotEnoughVotes) {
 					s.GlobalService.Logger.Error("process - getTxMsgsWithCertainNumberOfVotes error", zap.Error(err))
-					newBlock, err := s.formAndSaveNewBlock(block, saiBtcAddress, storageToken, txMsgs)
+					newBlock, err := s.formAndSaveNewBlock(block, txMsgs)
 					if err != nil {
 						goto startLoop
 					}
-					err = s.broadcastMsg(newBlock, saiP2Paddress)
+					err = s.broadcastMsg(newBlock)
 					if err != nil {
 						goto startLoop
 					}
 
+					s.snapshotIfNeeded(newBlock)
 					goto startLoop
 				} else {
 					goto startLoop
@@ -204,7 +232,8 @@ func (s *InternalService) Processing() {
 			if round < maxRoundNumber-1 {
 				newConsensusMsg := &models.ConsensusMessage{
 					Type:          models.ConsensusMsgType,
-					SenderAddress: Service.BTCkeys.Address,
+					ChainID:       s.chainID(),
+					SenderAddress: s.validatorAddress(),
 					BlockNumber:   block.Block.Number,
 				}
 
@@ -221,27 +250,25 @@ func (s *InternalService) Processing() {
 
 				newConsensusMsg.Hash = newConsensusMsgHash
 
-				btcResp, err := utils.SignMessage(newConsensusMsg, saiBtcAddress, s.BTCkeys.Private)
+				newConsensusMsg, err = s.signVote(newConsensusMsg)
 				if err != nil {
 					s.GlobalService.Logger.Error("process - round==0 - sign consensus message", zap.Error(err))
 					goto startLoop
 				}
 
-				newConsensusMsg.Signature = btcResp.Signature
-
-				err, _ = s.Storage.Put("ConsensusPool", newConsensusMsg, storageToken)
+				err = s.Storage.PutConsensusMsg(newConsensusMsg)
 				if err != nil {
 					s.GlobalService.Logger.Error("process - round == 0 - put consensus to ConsensusPool collection", zap.Error(err))
 					goto startLoop
 				}
 
-				err = s.broadcastMsg(newConsensusMsg, saiP2Paddress)
+				err = s.broadcastMsg(newConsensusMsg)
 				if err != nil {
 					goto startLoop
 				}
 			}
 
-			time.Sleep(time.Duration(s.GlobalService.Configuration["sleep"].(int)) * time.Second)
+			s.wait(s.roundDuration())
 			round++
 
 			if round < maxRoundNumber {
@@ -249,15 +276,16 @@ func (s *InternalService) Processing() {
 			} else {
 				s.GlobalService.Logger.Sugar().Debugf("ROUND = %d", round) //DEBUG
 
-				newBlock, err := s.formAndSaveNewBlock(block, saiBtcAddress, storageToken, txMsgs)
+				newBlock, err := s.formAndSaveNewBlock(block, txMsgs)
 				if err != nil {
 					goto startLoop
 				}
-				err = s.broadcastMsg(newBlock, saiP2Paddress)
+				err = s.broadcastMsg(newBlock)
 				if err != nil {
 					goto startLoop
 				}
 
+				s.snapshotIfNeeded(newBlock)
 				goto startLoop
 			}
 		}
@@ -265,52 +293,38 @@ func (s *InternalService) Processing() {
 }
 
 // get last block from blockchain collection
-func (s *InternalService) getLastBlockFromBlockChain(storageToken string, saiBtcAddress string) (*models.BlockConsensusMessage, error) {
-	opts := options.Find().SetSort(bson.M{"block.number": -1}).SetLimit(1)
-	err, result := s.Storage.Get(blockchainCollection, bson.M{}, opts, storageToken)
+func (s *InternalService) getLastBlockFromBlockChain() (*models.BlockConsensusMessage, error) {
+	block, err := s.Storage.LastBlock()
 	if err != nil {
+		// no blocks in blockchain collection -> new block should be created
+		if errors.Is(err, storage.ErrNotFound) {
+			s.GlobalService.Logger.Sugar().Debugf("block not found, creating initial block") //DEBUG
+			block, err := s.createInitialBlock()
+			if err != nil {
+				s.GlobalService.Logger.Error("process - create initial block", zap.Error(err))
+				return nil, err
+			}
+			return block, nil
+		}
 		s.GlobalService.Logger.Error("handlers - process - processing - get last block", zap.Error(err))
 		return nil, err
 	}
 
-	// empty get response returns '{}' in storage get method -> new block should be created
-	if len(result) == 2 {
-		block, err := s.createInitialBlock(saiBtcAddress)
-		if err != nil {
-			s.GlobalService.Logger.Error("process - create initial block", zap.Error(err))
-			return nil, err
-		}
-		return block, nil
-	} else {
-		blocks := make([]*models.BlockConsensusMessage, 0)
-		data, err := utils.ExtractResult(result)
-		if err != nil {
-			Service.GlobalService.Logger.Error("process - get last block from blockchain - extract data from response", zap.Error(err))
-			return nil, err
-		}
-		s.GlobalService.Logger.Sugar().Debugf("get last block data : %s", string(data))
-		err = json.Unmarshal(data, &blocks)
-		if err != nil {
-			s.GlobalService.Logger.Error("handlers - process - unmarshal result of last block from blockchain collection", zap.Error(err))
-			return nil, err
-		}
-		block := blocks[0]
-		block.Block.Number++
-		s.GlobalService.Logger.Sugar().Debugf("Got last block from blockchain collection : %+v\n", block) //DEBUG
+	block.Block.Number++
+	s.GlobalService.Logger.Sugar().Debugf("Got last block from blockchain collection : %+v\n", block) //DEBUG
 
-		return block, nil
-	}
+	return block, nil
 }
 
 // create initial block
-func (s *InternalService) createInitialBlock(address string) (block *models.BlockConsensusMessage, err error) {
-	s.GlobalService.Logger.Sugar().Debugf("block not found, creating initial block") //DEBUG
-
+// it is the same for all nodes of the chain, its hash is the previous block hash of block 1
+func (s *InternalService) createInitialBlock() (block *models.BlockConsensusMessage, err error) {
 	block = &models.BlockConsensusMessage{
 		Type: models.BlockConsensusMsgType,
 		Block: &models.Block{
+			ChainID:           s.chainID(),
 			Number:            1,
-			SenderAddress:     s.BTCkeys.Address,
+			SenderAddress:     s.validatorAddress(),
 			PreviousBlockHash: "",
 			Messages:          make(map[string]*models.Tx),
 		},
@@ -323,70 +337,45 @@ func (s *InternalService) createInitialBlock(address string) (block *models.Bloc
 	block.BlockHash = blockHash
 	block.Block.BlockHash = blockHash
 
-	btcResp, err := utils.SignMessage(block, address, s.BTCkeys.Private)
-	if err != nil {
-		return nil, err
-	}
-	block.Block.SenderSignature = btcResp.Signature
-
-	s.GlobalService.Logger.Sugar().Debugf("First block created : %+v\n", block) //DEBUG
+	// initial block is only the parent of block 1, it is not saved and not sent, so it is not signed
+	// block 1 is signed once by formAndSaveNewBlock, signer with double sign guard refuses the second block of the height
 
 	return block, nil
 
 }
 
 // get messages with votes = 0
-func (s *InternalService) getZeroVotedTransactions(storageToken string) ([]*models.TransactionMessage, error) {
-	err, result := s.Storage.Get("MessagesPool", bson.M{"votes.0": 0}, bson.M{}, storageToken)
+func (s *InternalService) getZeroVotedTransactions() ([]*models.TransactionMessage, error) {
+	transactions, err := s.Storage.PendingTxs()
 	if err != nil {
 		s.GlobalService.Logger.Error("process - round = 0 - get messages with 0 votes", zap.Error(err))
 		return nil, err
 	}
 
-	if len(result) == 2 {
+	if len(transactions) == 0 {
 		err = errors.New("no 0 voted messages found")
 		s.GlobalService.Logger.Error("process - round = 0 - get messages with 0 votes", zap.Error(err))
 		return nil, err
 	}
 
-	data, err := utils.ExtractResult(result)
-	if err != nil {
-		Service.GlobalService.Logger.Error("process - getZeroVotedTransactions - extract data from response", zap.String("data", string(result)), zap.Error(err))
-		return nil, err
-	}
-
-	transactions := make([]*models.TransactionMessage, 0)
-
-	err = json.Unmarshal(data, &transactions)
-	if err != nil {
-		s.GlobalService.Logger.Error("handlers - process - round = 0 - unmarshal result of messages with votes = 0", zap.Error(err))
-		return nil, err
-	}
-
 	s.GlobalService.Logger.Sugar().Debugf("Got transactions with votes = 0 : %+v", transactions) //DEBUG
 
 	return transactions, nil
 }
 
-// validate/execute each message, update message and hash and vote for valid messages
-func (s *InternalService) validateExecuteTransactionMsg(msg *models.TransactionMessage, saiBTCaddress, storageToken string) error {
+// execute message with validated signature, update message and hash and vote for it
+func (s *InternalService) executeTransactionMsg(msg *models.TransactionMessage) error {
 	s.GlobalService.Logger.Sugar().Debugf("Handling transaction : %+v", msg) //DEBUG
 
-	err := utils.ValidateSignature(msg, saiBTCaddress, msg.Tx.SenderAddress, msg.Tx.SenderSignature)
-	if err != nil {
-		s.GlobalService.Logger.Error("process - ValidateExecuteTransactionMsg - validate tx msg signature", zap.Error(err))
-		return err
-	}
 	// dummy vm result values after executing at vm
+	msg.VmProcessed = true
 	msg.VmResult = true
 	msg.VmResponse = "vmResponse"
 
 	msg.Votes[0]++
-	filter := bson.M{"message_hash": msg.MessageHash}
-	update := bson.M{"votes": msg.Votes, "vm_processed": true, "vm_result": msg.VmResult, "vm_response": msg.VmResponse}
-	err, _ = s.Storage.Update("MessagesPool", filter, update, storageToken)
+	err := s.Storage.UpdateTxExecution(msg)
 	if err != nil {
-		Service.GlobalService.Logger.Error("process - ValidateExecuteTransactionMsg - update transactions in storage", zap.Error(err))
+		s.GlobalService.Logger.Error("process - executeTransactionMsg - update transactions in storage", zap.Error(err))
 		return err
 	}
 	return nil
@@ -404,127 +393,79 @@ func checkConsensusMsgSender(validators []string, msg *models.ConsensusMessage)
 }
 
 // get consensus messages for the round
-func (s *InternalService) getConsensusMsgForTheRound(round, blockNumber int, storageToken string) ([]*models.ConsensusMessage, error) {
-	err, result := s.Storage.Get("ConsensusPool", bson.M{"round": round, "block_number": blockNumber}, bson.M{}, storageToken)
+func (s *InternalService) getConsensusMsgForTheRound(round, blockNumber int) ([]*models.ConsensusMessage, error) {
+	msgs, err := s.Storage.ConsensusMsgs(blockNumber, round)
 	if err != nil {
 		s.GlobalService.Logger.Error("process - round != 0 - get messages for specified round", zap.Error(err))
 		return nil, err
 	}
 
-	if len(result) == 2 {
+	if len(msgs) == 0 {
 		err = fmt.Errorf("no consensusMsg found for round : %d", round)
 		s.GlobalService.Logger.Error("process - get consensusMsg for round", zap.Int("round", round), zap.Error(err))
 		return nil, err
 	}
 
-	data, err := utils.ExtractResult(result)
-	if err != nil {
-		Service.GlobalService.Logger.Error("process - getConsensusMsgForTheRound - extract data from response", zap.Error(err))
-		return nil, err
-	}
-
-	msgs := make([]*models.ConsensusMessage, 0)
-
-	err = json.Unmarshal(data, &msgs)
-	if err != nil {
-		s.GlobalService.Logger.Error("process - round != 0 - unmarshal result of consensus messages for specified round", zap.Error(err))
-		return nil, err
-	}
-
 	return msgs, nil
 }
 
-// broadcast messages to connected nodes
-func (s *InternalService) broadcastMsg(msg interface{}, saiP2Paddress string) error {
-	param := url.Values{}
-	data, err := json.Marshal(msg)
-
-	if err != nil {
-		s.GlobalService.Logger.Error("process - round != 0 - broadcastMsg - marshal msg", zap.Error(err))
-		return err
-	}
-
-	param.Add("message", string(data))
-	postRequest, err := http.NewRequest("POST", saiP2Paddress, bytes.NewBufferString(param.Encode()))
-	if err != nil {
-		s.GlobalService.Logger.Error("process - round != 0 - broadcastMsg - create post request", zap.Error(err))
-		return err
-	}
-
-	postRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	client := http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	resp, err := client.Do(postRequest)
-	if err != nil {
-		s.GlobalService.Logger.Error("process - round != 0 - broadcastMsg - send post request ", zap.String("host", saiP2Paddress), zap.Error(err))
-		return err
-	}
-
-	defer resp.Body.Close()
-
-	// if resp.StatusCode != 200 {
-	// 	s.GlobalService.Logger.Sugar().Errorf("process - round != 0 - broadcastMsg - send post request to host : %s wrong status code : %d", saiP2Paddress, resp.StatusCode)
-	// 	return fmt.Errorf("Wrong status code : %d", resp.StatusCode)
-	// }
-
-	s.GlobalService.Logger.Sugar().Debugf("broadcasting - success, message : %+v", msg) // DEBUG                                                       //DEBUG
-	return nil
-}
-
 // form and save new block
-func (s *InternalService) formAndSaveNewBlock(previousBlock *models.BlockConsensusMessage, saiBTCaddress, storageToken string, txMsgs []*models.TransactionMessage) (*models.BlockConsensusMessage, error) {
-	newBlock := &models.BlockConsensusMessage{
-		Type: models.BlockConsensusMsgType,
-		Block: &models.Block{
-			Number:            previousBlock.Block.Number,
-			PreviousBlockHash: previousBlock.BlockHash,
-			SenderAddress:     s.BTCkeys.Address,
-			Messages:          make(map[string]*models.Tx),
-		},
-	}
-
-	for _, tx := range txMsgs {
-		newBlock.Block.Messages[tx.MessageHash] = tx.Tx
-	}
+// block, which was signed at the height before (failed saving or restart), is proposed again instead of the new one
+func (s *InternalService) formAndSaveNewBlock(previousBlock *models.BlockConsensusMessage, txMsgs []*models.TransactionMessage) (*models.BlockConsensusMessage, error) {
+	newBlock := s.signedBlock(previousBlock.Block.Number, previousBlock.BlockHash)
+	if newBlock != nil {
+		s.GlobalService.Logger.Warn("process - block was already signed at this height, it is proposed again", zap.Int("height", newBlock.Block.Number), zap.String("hash", newBlock.BlockHash))
+	} else {
+		newBlock = &models.BlockConsensusMessage{
+			Type: models.BlockConsensusMsgType,
+			Block: &models.Block{
+				ChainID:           s.chainID(),
+				Number:            previousBlock.Block.Number,
+				PreviousBlockHash: previousBlock.BlockHash,
+				SenderAddress:     s.validatorAddress(),
+				Messages:          make(map[string]*models.Tx),
+			},
+		}
 
-	blockHash, err := newBlock.Block.GetHash()
-	if err != nil {
-		s.GlobalService.Logger.Error("process - round != 0 - form and save new block - count hash of new block", zap.Error(err))
-		return nil, err
-	}
-	newBlock.BlockHash = blockHash
-	newBlock.Block.BlockHash = blockHash
+		for _, tx := range txMsgs {
+			newBlock.Block.Messages[tx.MessageHash] = tx.Tx
+		}
 
-	btcResp, err := utils.SignMessage(newBlock, saiBTCaddress, s.BTCkeys.Private)
+		blockHash, err := newBlock.Block.GetHash()
+		if err != nil {
+			s.GlobalService.Logger.Error("process - round != 0 - form and save new block - count hash of new block", zap.Error(err))
+			return nil, err
+		}
+		newBlock.BlockHash = blockHash
+		newBlock.Block.BlockHash = blockHash
 
-	if err != nil {
-		s.GlobalService.Logger.Error("process - round != 0 - form and save new block - sign message", zap.Error(err))
-		return nil, err
+		signature, err := s.signBlock(newBlock)
+		if err != nil {
+			s.GlobalService.Logger.Error("process - round != 0 - form and save new block - sign message", zap.Error(err))
+			return nil, err
 
+		}
+		newBlock.Block.SenderSignature = signature
 	}
 
 	newBlock.Votes = +1
-	newBlock.Block.SenderSignature = btcResp.Signature
-	newBlock.Signatures = append(newBlock.Signatures, btcResp.Signature)
+	newBlock.Signatures = []string{newBlock.Block.SenderSignature}
 
-	err, _ = s.Storage.Put(blockchainCollection, newBlock, storageToken)
+	err := s.saveBlock(newBlock)
 	if err != nil {
 		s.GlobalService.Logger.Error("process - round != 0 - form and save new block - put block to blockchain collection", zap.Error(err))
 		return nil, err
 	}
 
-	for _, tx := range txMsgs {
-		err, _ := s.Storage.Update("MessagesPool", bson.M{"message_hash": tx.MessageHash}, bson.M{"block_hash": newBlock.BlockHash, "block_number": newBlock.Block.Number}, storageToken)
+	for hash := range newBlock.Block.Messages {
+		err := s.Storage.CommitTx(hash, newBlock.BlockHash, newBlock.Block.Number)
 		if err != nil {
 			s.GlobalService.Logger.Error("process - round != 0 - form and save new block - update tx blockhash", zap.Error(err))
 			return nil, err
 		}
 	}
 
-	err = s.updateTxMsgZeroVotes(storageToken)
+	err = s.updateTxMsgZeroVotes()
 	if err != nil {
 		s.GlobalService.Logger.Error("process - round != 0 - form and save new block - clear messages", zap.Error(err))
 		return nil, err
@@ -536,80 +477,42 @@ func (s *InternalService) formAndSaveNewBlock(previousBlock *models.BlockConsens
 }
 
 // update votes to zero for transaction message
-func (s *InternalService) updateTxMsgZeroVotes(storageToken string) error {
-	criteria := bson.M{"votes.0": bson.M{"$gte": 1}, "block_hash": ""}
-	update := bson.M{"votes": bson.A{0, 0, 0, 0, 0, 0, 0}}
-
-	_, result := s.Storage.Get("MessagesPool", criteria, bson.M{}, storageToken)
-	s.GlobalService.Logger.Sugar().Debugf("BEFORE UPDATING ON CLEAR RESULT : %s", string(result))
-
-	err, _ := s.Storage.Update("MessagesPool", criteria, update, storageToken)
+func (s *InternalService) updateTxMsgZeroVotes() error {
+	err := s.Storage.ResetVotes()
 	if err != nil {
 		s.GlobalService.Logger.Error("handlers - process - round != 0 - get messages for specified round", zap.Error(err))
 		return err
 	}
-
-	criteria2 := bson.M{"block_hash": ""}
-	_, result2 := s.Storage.Get("MessagesPool", criteria2, bson.M{}, storageToken)
-	s.GlobalService.Logger.Sugar().Debugf("AFTER UPDATING ON CLEAR RESULT : %s", string(result2))
-
 	return nil
 }
 
 // update votes for transaction message
-func (s *InternalService) updateTxMsgVotes(hash, storageToken string, round int) error {
-	// DEBUG votes updating
-	criteria := bson.M{"message_hash": hash}
-	_, result := s.Storage.Get("MessagesPool", criteria, bson.M{}, storageToken)
-	s.GlobalService.Logger.Sugar().Debugf("BEFORE UPDATING ON ROUND : %d, RESULT : %s", round, string(result))
-	/////
-
-	criteria = bson.M{"message_hash": hash}
-	update := bson.M{"$inc": bson.M{"votes." + strconv.Itoa(round): 1}}
-	err, _ := s.Storage.Upsert("MessagesPool", criteria, update, storageToken)
+func (s *InternalService) updateTxMsgVotes(hash string, round int) error {
+	err := s.Storage.IncrementVote(hash, round)
 	if err != nil {
 		s.GlobalService.Logger.Error("handlers - process - round != 0 - get messages for specified round", zap.Error(err))
 		return err
 	}
-
-	// DEBUG votes updating
-	criteria = bson.M{"message_hash": hash}
-	_, result = s.Storage.Get("MessagesPool", criteria, bson.M{}, storageToken)
-	s.GlobalService.Logger.Sugar().Debugf("AFTER UPDATING ON ROUND : %d, RESULT : %s", round, string(result))
-	/////
+	s.GlobalService.Logger.Sugar().Debugf("votes were updated on round : %d, message : %s", round, hash) //DEBUG
 	return nil
 }
 
 // get messages with certain number of votes
-func (s *InternalService) getTxMsgsWithCertainNumberOfVotes(storageToken string, round int) ([]*models.TransactionMessage, error) {
-	requiredVotes := math.Ceil(float64(len(s.TrustedValidators)) * float64(round) * 10 / 100)
-	filterGte := bson.M{"votes." + strconv.Itoa(round): bson.M{"$gte": requiredVotes}}
+func (s *InternalService) getTxMsgsWithCertainNumberOfVotes(round int) ([]*models.TransactionMessage, error) {
+	requiredVotes := int(math.Ceil(float64(len(s.TrustedValidators)) * float64(round) * 10 / 100))
 	filteredTx := make([]*models.TransactionMessage, 0)
-	txMsgs := make([]*models.TransactionMessage, 0)
 
-	err, result := s.Storage.Get("MessagesPool", filterGte, bson.M{}, storageToken)
+	txMsgs, err := s.Storage.TxsWithVotes(round, requiredVotes)
 	if err != nil {
-		s.GlobalService.Logger.Error("handlers - process - round != 0 - get tx messages with specified votes count", zap.Float64("votes count", requiredVotes), zap.Error(err))
+		s.GlobalService.Logger.Error("handlers - process - round != 0 - get tx messages with specified votes count", zap.Int("votes count", requiredVotes), zap.Error(err))
 		return nil, err
 	}
 
-	if len(result) == 2 {
-		s.GlobalService.Logger.Error("process - get tx msgs with certain number of votes - emtpy result", zap.String("required votes", strconv.Itoa(int(requiredVotes))))
+	if len(txMsgs) == 0 {
+		s.GlobalService.Logger.Error("process - get tx msgs with certain number of votes - emtpy result", zap.String("required votes", strconv.Itoa(requiredVotes)))
 		return filteredTx, nil
 	}
 
-	data, err := utils.ExtractResult(result)
-	if err != nil {
-		Service.GlobalService.Logger.Error("process - getZeroVotedTransactions - extract data from response", zap.String("result", string(result)), zap.Error(err))
-		return nil, err
-	}
-
-	err = json.Unmarshal(data, &txMsgs)
-	if err != nil {
-		s.GlobalService.Logger.Error("process - round != 0 - unmarshal result of consensus messages for specified round", zap.Error(err))
-		return nil, err
-	}
-
 	for _, tx := range txMsgs {
 		if tx.BlockHash == "" {
 			filteredTx = append(filteredTx, tx)
@@ -618,49 +521,44 @@ func (s *InternalService) getTxMsgsWithCertainNumberOfVotes(storageToken string,
 	return filteredTx, nil
 }
 
-func (s *InternalService) GetBTCkeys(fileStr, saiBTCaddress string) (*models.BtcKeys, error) {
-	file, err := os.OpenFile(fileStr, os.O_CREATE|os.O_RDWR, 0666)
+// SendTx creates tx message signed by node key, broadcasts and handles it
+func (s *InternalService) SendTx(txMsg *models.TxMessage) error {
+	txMsgBytes, err := json.Marshal(txMsg)
 	if err != nil {
-		s.GlobalService.Logger.Error("processing - open key btc file", zap.Error(err))
-		return nil, err
+		s.GlobalService.Logger.Error("handlers - tx  -  marshal tx msg", zap.Error(err))
+		return fmt.Errorf("handlers - tx  -  marshal tx msg: %w", err)
+	}
+	transactionMessage := &models.TransactionMessage{
+		Tx: &models.Tx{
+			ChainID:       s.chainID(),
+			SenderAddress: s.currentSigner().Address(),
+			Message:       string(txMsgBytes),
+		},
 	}
 
-	data, err := ioutil.ReadFile(fileStr)
+	hash, err := transactionMessage.Tx.GetHash()
 	if err != nil {
-		s.GlobalService.Logger.Error("processing - read key btc file", zap.Error(err))
-		return nil, err
+		s.GlobalService.Logger.Error("handlers  - tx - count tx message hash", zap.Error(err))
+		return fmt.Errorf("handlers  - tx - count tx message hash: %w", err)
 	}
-	btcKeys := models.BtcKeys{}
+	transactionMessage.Tx.MessageHash = hash
 
-	err = json.Unmarshal(data, &btcKeys)
+	signature, err := s.signMsg(transactionMessage)
 	if err != nil {
-		s.GlobalService.Logger.Error("get btc keys - error unmarshal from file", zap.Error(err))
-		btcKeys, body, err := utils.GetBtcKeys(saiBTCaddress)
-		if err != nil {
-			s.GlobalService.Logger.Error("processing - get btc keys", zap.Error(err))
-			return nil, err
-		}
-		_, err = file.Write(body)
-		if err != nil {
-			s.GlobalService.Logger.Error("processing - write btc keys to file", zap.Error(err))
-			return nil, err
-		}
-		return btcKeys, nil
-	} else {
-		err = btcKeys.Validate()
-		if err != nil {
-			btcKeys, body, err := utils.GetBtcKeys(saiBTCaddress)
-			if err != nil {
-				s.GlobalService.Logger.Fatal("processing - get btc keys", zap.Error(err))
-				return nil, err
-			}
-			_, err = file.Write(body)
-			if err != nil {
-				s.GlobalService.Logger.Fatal("processing - write btc keys to file", zap.Error(err))
-				return nil, err
-			}
-			return btcKeys, nil
-		}
-		return &btcKeys, nil
+		s.GlobalService.Logger.Error("handlers  - tx - sign tx message", zap.Error(err))
+		return fmt.Errorf("handlers  - tx - sign tx message: %w", err)
+	}
+	transactionMessage.Tx.SenderSignature = signature
+
+	err = s.broadcastMsg(transactionMessage.Tx)
+	if err != nil {
+		s.GlobalService.Logger.Error("listenFromSaiP2P  - handle tx msg - broadcast tx", zap.Error(err))
 	}
+
+	err = s.enqueue(transactionMessage.Tx)
+	if err != nil {
+		s.GlobalService.Logger.Error("handlers  - tx - queue tx message", zap.Error(err))
+		return fmt.Errorf("handlers  - tx - queue tx message: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/storage"
+	"go.uber.org/zap"
+)
+
+// types of recorded events
+const (
+	recordStart   = "start"   // node was started, header of recording session
+	recordMessage = "message" // inbound message of HandleMessage
+	recordTimer   = "timer"   // consensus timer was fired
+)
+
+// one line of recording file
+type recordEvent struct {
+	Time     time.Time              `json:"time"`
+	Type     string                 `json:"type"`
+	Start    *recordHeader          `json:"start,omitempty"`
+	Message  map[string]interface{} `json:"message,omitempty"`
+	Height   int                    `json:"height,omitempty"`
+	Round    int                    `json:"round,omitempty"`
+	Duration time.Duration          `json:"duration,omitempty"`
+}
+
+// state of the node at the start of recording, replay starts from it
+type recordHeader struct {
+	ChainID           string                        `json:"chain_id"`
+	Address           string                        `json:"address"`
+	TrustedValidators []string                      `json:"trusted_validators"`
+	RoundDuration     time.Duration                 `json:"round_duration"`
+	LastBlock         *models.BlockConsensusMessage `json:"last_block,omitempty"`
+}
+
+// writes inbound messages and timer events of the node to the file (json lines)
+// every start of the node appends new session to the file
+type recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// open recording file from record_path config key, empty path disables recording
+func (s *InternalService) openRecorder() error {
+	path := s.GlobalService.GetConfig("record_path", "").(string)
+	if path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open record file : %w", err)
+	}
+
+	header := &recordHeader{
+		ChainID:       s.chainID(),
+		Address:       s.validatorAddress(),
+		RoundDuration: s.roundDuration(),
+	}
+	trustedValidators, _ := s.GlobalService.Configuration["trusted_validators"].([]interface{})
+	for _, validator := range trustedValidators {
+		header.TrustedValidators = append(header.TrustedValidators, validator.(string))
+	}
+	header.LastBlock, err = s.Storage.LastBlock()
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		file.Close()
+		return fmt.Errorf("get last block : %w", err)
+	}
+
+	s.recorder = &recorder{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}
+	s.record(&recordEvent{
+		Type:  recordStart,
+		Start: header,
+	})
+	s.GlobalService.Logger.Info("recorder - recording consensus traffic", zap.String("file", path))
+	return nil
+}
+
+func (s *InternalService) record(event *recordEvent) {
+	if s.recorder == nil {
+		return
+	}
+	event.Time = s.clock.Now()
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	err := s.recorder.encoder.Encode(event)
+	if err != nil {
+		s.GlobalService.Logger.Error("recorder - write event", zap.String("type", event.Type), zap.Error(err))
+	}
+}
+
+func (s *InternalService) closeRecorder() {
+	if s.recorder == nil {
+		return
+	}
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	err := s.recorder.file.Close()
+	if err != nil {
+		s.GlobalService.Logger.Error("recorder - close", zap.Error(err))
+	}
+}
+
+func (s *InternalService) recordMessage(m map[string]interface{}) {
+	s.record(&recordEvent{
+		Type:    recordMessage,
+		Message: m,
+	})
+}
+
+// timer is recorded with step of consensus loop, replay compares it with the step of replayed node
+func (s *InternalService) recordTimer(d time.Duration) {
+	s.record(&recordEvent{
+		Type:     recordTimer,
+		Height:   s.step.Height,
+		Round:    s.step.Round,
+		Duration: d,
+	})
+}
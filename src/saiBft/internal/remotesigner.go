@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"github.com/iamthe1whoknocks/saiService"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRemoteSignerAddress = "unix:///tmp/bft-signer.sock"
+	defaultSignerStateFile     = "signer_state.json"
+)
+
+func (s *InternalService) isRemoteSigner() bool {
+	return s.GlobalService.GetConfig("signer", nativeSignerType).(string) == remoteSignerType
+}
+
+// connect to remote signer, node gets only public address of signer key
+func (s *InternalService) newRemoteSigner() (*signer.RemoteSigner, *models.BtcKeys, error) {
+	address := s.GlobalService.GetConfig("remote_signer.address", defaultRemoteSignerAddress).(string)
+	tlsConfig, err := s.remoteSignerTLS(false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	remote, err := signer.NewRemoteSigner(address, tlsConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := &models.BtcKeys{
+		Address: remote.Address(),
+		Type:    signer.KeyType(remote.Address()),
+	}
+	return remote, keys, nil
+}
+
+// mutual tls is used if remote_signer.tls_cert is set
+func (s *InternalService) remoteSignerTLS(server bool) (*tls.Config, error) {
+	cert := s.GlobalService.GetConfig("remote_signer.tls_cert", "").(string)
+	if cert == "" {
+		return nil, nil
+	}
+	key := s.GlobalService.GetConfig("remote_signer.tls_key", "").(string)
+	ca := s.GlobalService.GetConfig("remote_signer.tls_ca", "").(string)
+	return signer.LoadTLSConfig(cert, key, ca, server)
+}
+
+// ServeSigner runs signer process (bft signer), which keeps validator key and refuses double signing
+// node connects to it with signer: "remote"
+func ServeSigner(svc *saiService.Service) {
+	keysFile := svc.GetConfig("remote_signer.keys_file", btcKeyFile).(string)
+	keys, err := Service.readBTCkeys(keysFile)
+	if err != nil {
+		svc.Logger.Fatal("signer - read keys", zap.String("file", keysFile), zap.Error(err))
+	}
+
+	nativeSigner, err := newNativeSigner(keys)
+	if err != nil {
+		svc.Logger.Fatal("signer - create signer", zap.Error(err))
+	}
+	if nativeSigner.Address() != keys.Address {
+		svc.Logger.Fatal("signer - create signer", zap.Error(fmt.Errorf("address of private key %s does not match address from keys %s", nativeSigner.Address(), keys.Address)))
+	}
+
+	stateFile := svc.GetConfig("remote_signer.state_file", defaultSignerStateFile).(string)
+	guard, err := signer.NewDoubleSignGuard(stateFile)
+	if err != nil {
+		svc.Logger.Fatal("signer - load state", zap.Error(err))
+	}
+
+	tlsConfig, err := Service.remoteSignerTLS(true)
+	if err != nil {
+		svc.Logger.Fatal("signer - load tls", zap.Error(err))
+	}
+	address := svc.GetConfig("remote_signer.address", defaultRemoteSignerAddress).(string)
+	listener, err := signer.Listen(address, tlsConfig)
+	if err != nil {
+		svc.Logger.Fatal("signer - listen", zap.String("address", address), zap.Error(err))
+	}
+
+	svc.Logger.Info("signer - started", zap.String("address", address), zap.String("key", keys.Address))
+	err = signer.NewServer(nativeSigner, guard, svc.Logger.Sugar().Errorf).Serve(listener)
+	if err != nil {
+		svc.Logger.Fatal("signer - serve", zap.Error(err))
+	}
+}
@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"github.com/iamthe1whoknocks/bft/storage"
+	"github.com/iamthe1whoknocks/bft/transport"
+	"github.com/iamthe1whoknocks/saiService"
+	"go.uber.org/zap"
+)
+
+// time of replayed node is the time of recorded events
+// consensus timer fires, when recorded timer event is replayed
+type replayClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	wake   chan struct{}
+	parked chan struct{} // consensus loop waits for the timer
+}
+
+func newReplayClock(now time.Time) *replayClock {
+	return &replayClock{
+		now:    now,
+		wake:   make(chan struct{}),
+		parked: make(chan struct{}),
+	}
+}
+
+func (c *replayClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *replayClock) Sleep(ctx context.Context, d time.Duration) {
+	c.parked <- struct{}{}
+	<-c.wake
+}
+
+func (c *replayClock) set(now time.Time) {
+	c.mu.Lock()
+	if now.After(c.now) {
+		c.now = now
+	}
+	c.mu.Unlock()
+}
+
+// fire the timer and wait until consensus loop waits for the next one
+func (c *replayClock) fire() {
+	c.wake <- struct{}{}
+	<-c.parked
+}
+
+// replayed node has no peers, messages sent by it are decisions of the node
+type replayTransport struct {
+	clock *replayClock
+	out   io.Writer
+}
+
+func (t *replayTransport) Broadcast(msg interface{}) error {
+	printStep(t.out, t.clock.Now(), "send", describeMsg(msg))
+	return nil
+}
+
+func (t *replayTransport) SendTo(peer string, msg interface{}) error {
+	return t.Broadcast(msg)
+}
+
+func (t *replayTransport) Request(peer string, request interface{}) ([]byte, error) {
+	return nil, transport.ErrNoPeers
+}
+
+func (t *replayTransport) Peers() ([]string, error) {
+	return []string{}, nil
+}
+
+// Replay feeds recording file through consensus of in-memory node and prints decisions of the node step by step
+// bft replay <file> [session], sessions are numbered from 1 in order of node starts
+func Replay(svc *saiService.Service, args []string) {
+	if len(args) == 0 {
+		svc.Logger.Fatal("replay - recording file is not provided, usage : bft replay <file> [session]")
+	}
+	session := 1
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			svc.Logger.Fatal("replay - wrong session number", zap.String("session", args[1]))
+		}
+		session = n
+	}
+
+	sessions, err := readRecording(args[0])
+	if err != nil {
+		svc.Logger.Fatal("replay - read recording", zap.Error(err))
+	}
+	if session > len(sessions) {
+		svc.Logger.Fatal("replay - session not found", zap.Int("session", session), zap.Int("sessions", len(sessions)))
+	}
+	events := sessions[session-1]
+	fmt.Printf("replaying session %d of %d, %d events\n", session, len(sessions), len(events)-1)
+
+	err = replay(svc.Logger, events, os.Stdout)
+	if err != nil {
+		svc.Logger.Fatal("replay", zap.Error(err))
+	}
+}
+
+// events of recording file split by sessions, each session starts with header
+func readRecording(path string) ([][]*recordEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sessions := make([][]*recordEvent, 0)
+	decoder := json.NewDecoder(file)
+	for {
+		event := &recordEvent{}
+		err := decoder.Decode(event)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			// last line could be incomplete if node was killed
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, fmt.Errorf("decode event : %w", err)
+		}
+		if event.Type == recordStart {
+			sessions = append(sessions, []*recordEvent{event})
+			continue
+		}
+		if len(sessions) == 0 {
+			return nil, errors.New("recording does not start with header")
+		}
+		sessions[len(sessions)-1] = append(sessions[len(sessions)-1], event)
+	}
+	if len(sessions) == 0 {
+		return nil, errors.New("recording is empty")
+	}
+	return sessions, nil
+}
+
+// replay events of one session, first event is the header
+// node signs by generated key, so signatures and hashes of signed messages differ from recorded ones
+func replay(logger *zap.Logger, events []*recordEvent, out io.Writer) error {
+	header := events[0].Start
+	validators := make([]interface{}, 0, len(header.TrustedValidators))
+	for _, validator := range header.TrustedValidators {
+		validators = append(validators, validator)
+	}
+	svc := &saiService.Service{
+		Name: "bft-replay",
+		Configuration: map[string]interface{}{
+			"chain_id":           header.ChainID,
+			"trusted_validators": validators,
+			"validator_address":  header.Address,
+			"sleep":              int(math.Ceil(header.RoundDuration.Seconds())),
+			"sleep_ms":           int(header.RoundDuration / time.Millisecond),
+			"storage_type":       memoryStorageType,
+			"signer":             nativeSignerType,
+			"wal_path":           "",
+		},
+		Logger: logger,
+	}
+
+	keys, err := signer.GenerateEd25519Keys()
+	if err != nil {
+		return err
+	}
+	store := storage.NewMemoryStore()
+	if header.LastBlock != nil {
+		err = store.PutBlock(header.LastBlock)
+		if err != nil {
+			return fmt.Errorf("put last block : %w", err)
+		}
+	}
+
+	clock := newReplayClock(events[0].Time)
+	node := newInternalService()
+	node.GlobalService = svc
+	node.clock = clock
+	err = node.setup(&NodeOptions{
+		Storage: store,
+		Keys:    keys,
+		Transport: func(handler transport.Handler) transport.Transport {
+			return &replayTransport{clock: clock, out: out}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create node : %w", err)
+	}
+
+	// messages are handled by replay loop instead of listener, consensus loop is stopped at each timer meanwhile
+	go node.Processing()
+	<-clock.parked
+
+	for _, event := range events[1:] {
+		clock.set(event.Time)
+		switch event.Type {
+		case recordMessage:
+			msg, err := node.decodeMessage(event.Message)
+			if err != nil {
+				printStep(out, event.Time, "reject", err.Error())
+				continue
+			}
+			printStep(out, event.Time, "receive", describeMsg(msg))
+			node.handleQueuedMsg(msg)
+		case recordTimer:
+			step := fmt.Sprintf("height %d round %d", node.step.Height, node.step.Round)
+			if node.step.Height != event.Height || node.step.Round != event.Round {
+				step += fmt.Sprintf(", diverged : recorded height %d round %d", event.Height, event.Round)
+			}
+			printStep(out, event.Time, "timer", step)
+			clock.fire()
+		}
+	}
+
+	blocks, err := store.Blocks(1, math.MaxInt32)
+	if err != nil {
+		return fmt.Errorf("get blocks : %w", err)
+	}
+	fmt.Fprintf(out, "\nblockchain after replay, height %d round %d :\n", node.step.Height, node.step.Round)
+	for _, block := range blocks {
+		fmt.Fprintf(out, "  %d %s txs %d votes %d\n", block.Block.Number, block.BlockHash, len(block.Block.Messages), block.Votes)
+	}
+	return nil
+}
+
+func printStep(out io.Writer, t time.Time, kind, details string) {
+	fmt.Fprintf(out, "%s  %-8s %s\n", t.Format("15:04:05.000"), kind, details)
+}
+
+func describeMsg(msg interface{}) string {
+	switch m := msg.(type) {
+	case *models.ConsensusMessage:
+		return fmt.Sprintf("consensus from %s height %d round %d txs %v", m.SenderAddress, m.BlockNumber, m.Round, m.Messages)
+	case *models.BlockConsensusMessage:
+		if m.Block == nil {
+			return "block without body"
+		}
+		return fmt.Sprintf("block %d from %s hash %s prev %s txs %d", m.Block.Number, m.Block.SenderAddress, m.BlockHash, m.Block.PreviousBlockHash, len(m.Block.Messages))
+	case *models.Tx:
+		return fmt.Sprintf("tx %s from %s", m.MessageHash, m.SenderAddress)
+	case *models.SnapshotManifest:
+		return fmt.Sprintf("snapshot %d hash %s signatures %d", m.Height, m.Hash, len(m.Signatures))
+	case *models.PeerRequest:
+		return fmt.Sprintf("request %s payload %s", m.RequestID, m.Payload)
+	case *models.PeerResponse:
+		return fmt.Sprintf("response %s", m.RequestID)
+	default:
+		return fmt.Sprintf("%T", msg)
+	}
+}
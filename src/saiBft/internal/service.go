@@ -1,10 +1,15 @@
 package internal
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"sync"
 
 	"github.com/iamthe1whoknocks/bft/models"
-	"github.com/iamthe1whoknocks/bft/utils"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"github.com/iamthe1whoknocks/bft/storage"
+	"github.com/iamthe1whoknocks/bft/transport"
 	"github.com/iamthe1whoknocks/saiService"
 	"go.uber.org/zap"
 )
@@ -12,21 +17,121 @@ import (
 // here we add all implemented handlers, create name of service and register config
 // moved from handlers to service because of initialization problems
 func Init(svc *saiService.Service) {
-	storage := NewDB()
-	Service.Storage = storage
-
-	btckeys, err := Service.GetBTCkeys("btc_keys.json", Service.GlobalService.Configuration["saiBTC_address"].(string))
+	err := Service.setup(&NodeOptions{})
 	if err != nil {
-		svc.Logger.Fatal("main - init - open btc keys", zap.Error(err))
+		svc.Logger.Fatal("main - init", zap.Error(err))
 	}
-	Service.BTCkeys = btckeys
-
-	svc.Logger.Sugar().Debugf("btc keys : %+v\n", Service.BTCkeys) //DEBUG
 
 	Service.Handler[GetMissedBlocks.Name] = GetMissedBlocks
 	Service.Handler[HandleTxFromCli.Name] = HandleTxFromCli
 	Service.Handler[HandleMessage.Name] = HandleMessage
 	Service.Handler[CreateBTCKeys.Name] = CreateBTCKeys
+	Service.Handler[RotateKey.Name] = RotateKey
+	Service.Handler[GetSnapshot.Name] = GetSnapshot
+	Service.Handler[GetSnapshotChunk.Name] = GetSnapshotChunk
+	Service.Handler[GetInboundStats.Name] = GetInboundStats
+}
+
+// NodeOptions replace parts of the node, which are created from config otherwise
+// used to run several nodes in one process (simulation)
+type NodeOptions struct {
+	Storage   storage.Store
+	Keys      *models.BtcKeys                                     // keys of native signer
+	Transport func(handler transport.Handler) transport.Transport // transport, which passes messages to the handler
+}
+
+// NewNode creates node with own config, handlers are not registered
+func NewNode(svc *saiService.Service, opts *NodeOptions) (*InternalService, error) {
+	s := newInternalService()
+	s.GlobalService = svc
+	err := s.setup(opts)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// create storage, keys, signer and transport of the node
+func (s *InternalService) setup(opts *NodeOptions) error {
+	err := s.validateChainID()
+	if err != nil {
+		return err
+	}
+
+	s.ctx, s.cancel = context.WithCancel(s.GlobalService.Context())
+	s.inbound = s.newInboundPipeline()
+
+	s.Storage = opts.Storage
+	if s.Storage == nil {
+		s.Storage = s.NewDB()
+	}
+
+	err = s.openWAL()
+	if err != nil {
+		return fmt.Errorf("open wal : %w", err)
+	}
+
+	rotations, err := s.Storage.KeyRotations()
+	if err != nil {
+		return fmt.Errorf("get key rotations : %w", err)
+	}
+	s.keyRegistry = newKeyRegistry(rotations)
+
+	switch {
+	case opts.Keys != nil:
+		s.BTCkeys = opts.Keys
+		nodeSigner, verifier, err := s.NewSigner(opts.Keys)
+		if err != nil {
+			return fmt.Errorf("create signer : %w", err)
+		}
+		s.setSigner(nodeSigner)
+		s.Verifier = verifier
+	case s.isRemoteSigner():
+		// private key is kept by signer process
+		remote, btckeys, err := s.newRemoteSigner()
+		if err != nil {
+			return fmt.Errorf("connect to remote signer : %w", err)
+		}
+		s.BTCkeys = btckeys
+		s.setSigner(remote)
+		s.Verifier, err = s.newVerifier()
+		if err != nil {
+			return fmt.Errorf("create verifier : %w", err)
+		}
+	default:
+		btckeys, err := s.GetBTCkeys(btcKeyFile)
+		if err != nil {
+			return fmt.Errorf("open btc keys : %w", err)
+		}
+		s.BTCkeys = btckeys
+
+		nodeSigner, verifier, err := s.NewSigner(btckeys)
+		if err != nil {
+			return fmt.Errorf("create signer : %w", err)
+		}
+		s.setSigner(nodeSigner)
+		s.Verifier = verifier
+	}
+
+	s.byzantine, err = s.newByzantine()
+	if err != nil {
+		return err
+	}
+
+	if opts.Transport != nil {
+		s.Transport = opts.Transport(&transportHandler{s: s})
+	} else {
+		s.Transport, err = s.newTransport()
+		if err != nil {
+			return fmt.Errorf("create transport : %w", err)
+		}
+	}
+
+	err = s.openRecorder()
+	if err != nil {
+		return err
+	}
+	return nil
 }
 
 type InternalService struct {
@@ -36,14 +141,89 @@ type InternalService struct {
 	Mutex                *sync.RWMutex
 	ConnectedSaiP2pNodes map[string]*models.SaiP2pNode
 	BTCkeys              *models.BtcKeys
-	MsgQueue             chan interface{}
-	Storage              utils.Database
+	signerMu             sync.RWMutex
+	nodeSigner           signer.Signer // replaced on key rotation, read by currentSigner
+	Verifier             signer.Verifier
+	Storage              storage.Store
+	Transport            transport.Transport
+	keystorePass         []byte
+	keyRegistry          *keyRegistry
+	inbound              *inboundPipeline // queues of messages from transport
+	byzantine            *byzantine       // faulty validator mode, nil for honest node
+	wal                  *consensusWAL    // nil if write-ahead log is disabled
+	recorder             *recorder        // nil if recording is disabled
+	clock                clock
+	step                 consensusStep   // current step of consensus loop
+	ctx                  context.Context // cancelled when the node is stopped
+	cancel               context.CancelFunc
+	ioCtx                context.Context // cancelled when shutdown timeout expires, aborts storage and transport calls
+	abort                context.CancelFunc
+	running              sync.WaitGroup // consensus loop and inbound workers
 }
 
 // global handler for registering handlers
-var Service = &InternalService{
-	Handler:              saiService.Handler{},
-	Mutex:                new(sync.RWMutex),
-	ConnectedSaiP2pNodes: make(map[string]*models.SaiP2pNode),
-	MsgQueue:             make(chan interface{}),
+var Service = newInternalService()
+
+func newInternalService() *InternalService {
+	s := &InternalService{
+		Handler:              saiService.Handler{},
+		Mutex:                new(sync.RWMutex),
+		ConnectedSaiP2pNodes: make(map[string]*models.SaiP2pNode),
+		clock:                realClock{},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.ioCtx, s.abort = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *InternalService) stopped() bool {
+	return s.ctx.Err() != nil
+}
+
+// Stop stops consensus loop and inbound workers of the node, current step is finished
+func (s *InternalService) Stop() {
+	s.cancel()
+}
+
+// Shutdown stops the node and releases its resources in order :
+// consensus loop and inbound workers are stopped, then transport, signer, wal, recorder and storage are closed
+// storage and transport calls are aborted if the node is not stopped before ctx is done
+func (s *InternalService) Shutdown(ctx context.Context) {
+	s.Stop()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.GlobalService.Logger.Error("shutdown - consensus step was not finished in time, aborting")
+		s.abort()
+		<-stopped
+	}
+	s.abort()
+
+	if closer, ok := s.Transport.(io.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			s.GlobalService.Logger.Error("shutdown - close transport", zap.Error(err))
+		}
+	}
+	if closer, ok := s.currentSigner().(io.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			s.GlobalService.Logger.Error("shutdown - close signer", zap.Error(err))
+		}
+	}
+	s.closeWAL()
+	s.closeRecorder()
+	if s.Storage != nil {
+		err := s.Storage.Close()
+		if err != nil {
+			s.GlobalService.Logger.Error("shutdown - close storage", zap.Error(err))
+		}
+	}
+	s.GlobalService.Logger.Info("shutdown - node stopped")
 }
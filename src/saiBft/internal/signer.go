@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"github.com/iamthe1whoknocks/bft/utils"
+)
+
+const (
+	nativeSignerType = "native"
+	saiBTCSignerType = "saiBTC"
+	remoteSignerType = "remote"
+
+	defaultSignatureCacheSize = 100000
+)
+
+// create signer and verifier
+// ed25519 keys are always used natively, for btc keys backend is chosen by signer config key:
+// native signer keeps private key in process, saiBTC is left for compatibility
+// verified signatures are cached, signature_cache_size = 0 disables the cache
+func (s *InternalService) NewSigner(keys *models.BtcKeys) (signer.Signer, signer.Verifier, error) {
+	if keys.Type != "" && keys.Type != signer.KeyType(keys.Address) {
+		return nil, nil, fmt.Errorf("key type %s does not match address %s", keys.Type, keys.Address)
+	}
+
+	nodeSigner, err := s.newNodeSigner(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if nodeSigner.Address() != keys.Address {
+		return nil, nil, fmt.Errorf("address of private key %s does not match address from keys %s", nodeSigner.Address(), keys.Address)
+	}
+
+	verifier, err := s.newVerifier()
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodeSigner, verifier, nil
+}
+
+// verifier of btc and ed25519 signatures
+func (s *InternalService) newVerifier() (signer.Verifier, error) {
+	btcVerifier, err := s.newBtcVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	var verifier signer.Verifier = signer.NewKeyTypeVerifier(btcVerifier)
+	cacheSize := s.GlobalService.GetConfig("signature_cache_size", defaultSignatureCacheSize).(int)
+	if cacheSize > 0 {
+		verifier = signer.NewCachingVerifier(verifier, cacheSize)
+	}
+	return verifier, nil
+}
+
+func (s *InternalService) newNodeSigner(keys *models.BtcKeys) (signer.Signer, error) {
+	if signer.KeyType(keys.Address) == signer.KeyTypeEd25519 {
+		return newNativeSigner(keys)
+	}
+
+	signerType := s.GlobalService.GetConfig("signer", nativeSignerType).(string)
+	switch signerType {
+	case nativeSignerType:
+		return newNativeSigner(keys)
+	case saiBTCSignerType:
+		saiBtcAddress, ok := s.GlobalService.Configuration["saiBTC_address"].(string)
+		if !ok {
+			return nil, fmt.Errorf("wrong type of saiBTC_address value in config")
+		}
+		return signer.NewSaiBtcSigner(saiBtcAddress, keys), nil
+	case remoteSignerType:
+		return nil, fmt.Errorf("remote signer does not use local keys")
+	default:
+		return nil, fmt.Errorf("invalid signer type provided, type : %s", signerType)
+	}
+}
+
+// signer which keeps private key in process
+func newNativeSigner(keys *models.BtcKeys) (signer.Signer, error) {
+	if signer.KeyType(keys.Address) == signer.KeyTypeEd25519 {
+		return signer.NewEd25519Signer(keys.Private)
+	}
+	return signer.NewBtcSigner(keys.Private)
+}
+
+func (s *InternalService) newBtcVerifier() (signer.Verifier, error) {
+	signerType := s.GlobalService.GetConfig("signer", nativeSignerType).(string)
+	switch signerType {
+	case nativeSignerType, remoteSignerType:
+		return signer.NewBtcVerifier(), nil
+	case saiBTCSignerType:
+		saiBtcAddress, ok := s.GlobalService.Configuration["saiBTC_address"].(string)
+		if !ok {
+			return nil, fmt.Errorf("wrong type of saiBTC_address value in config")
+		}
+		return signer.NewSaiBtcVerifier(saiBtcAddress), nil
+	default:
+		return nil, fmt.Errorf("invalid signer type provided, type : %s", signerType)
+	}
+}
+
+// generate new keys of the type (btc or ed25519)
+// btc keys are generated at saiBTC if it is chosen as signer
+func (s *InternalService) generateBTCkeys(keyType string) (*models.BtcKeys, error) {
+	var (
+		keys *models.BtcKeys
+		err  error
+	)
+	switch {
+	case keyType == signer.KeyTypeEd25519:
+		keys, err = signer.GenerateEd25519Keys()
+	case keyType != signer.KeyTypeBtc:
+		return nil, fmt.Errorf("unknown key type : %s", keyType)
+	case s.GlobalService.GetConfig("signer", nativeSignerType).(string) == saiBTCSignerType:
+		saiBtcAddress, ok := s.GlobalService.Configuration["saiBTC_address"].(string)
+		if !ok {
+			return nil, fmt.Errorf("wrong type of saiBTC_address value in config")
+		}
+		keys, _, err = utils.GetBtcKeys(saiBtcAddress)
+	default:
+		keys, err = signer.GenerateBtcKeys()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// signer of the node, it is replaced on key rotation while consensus loop, inbound workers and handlers sign
+func (s *InternalService) currentSigner() signer.Signer {
+	s.signerMu.RLock()
+	defer s.signerMu.RUnlock()
+	return s.nodeSigner
+}
+
+// replace signer of the node, previous signer is returned
+func (s *InternalService) setSigner(nodeSigner signer.Signer) signer.Signer {
+	s.signerMu.Lock()
+	defer s.signerMu.Unlock()
+	previous := s.nodeSigner
+	s.nodeSigner = nodeSigner
+	return previous
+}
+
+// sign message by node key
+// signer, which protects from double signing, gets the message and computes payload and consensus step itself
+func (s *InternalService) signMsg(msg interface{}) (string, error) {
+	nodeSigner := s.currentSigner()
+	if messageSigner, ok := nodeSigner.(signer.MessageSigner); ok {
+		return messageSigner.SignMessage(msg)
+	}
+
+	payload, err := models.SignPayload(msg)
+	if err != nil {
+		return "", err
+	}
+	return nodeSigner.Sign(payload)
+}
+
+// validate signature of message sender
+func (s *InternalService) validateSignature(msg interface{}, address, signature string) error {
+	payload, err := models.SignPayload(msg)
+	if err != nil {
+		return err
+	}
+	return s.Verifier.Verify(payload, address, signature)
+}
+
+// validate signatures of transactions concurrently by verify_workers goroutines
+// result errors have the same order as transactions
+func (s *InternalService) validateTxSignatures(txs []*models.TransactionMessage) []error {
+	errs := make([]error, len(txs))
+	items := make([]*signer.VerifyItem, 0, len(txs))
+	indexes := make([]int, 0, len(txs))
+	for i, tx := range txs {
+		payload, err := models.SignPayload(tx)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		items = append(items, &signer.VerifyItem{
+			Payload:   payload,
+			Address:   tx.Tx.SenderAddress,
+			Signature: tx.Tx.SenderSignature,
+		})
+		indexes = append(indexes, i)
+	}
+
+	workers := s.GlobalService.GetConfig("verify_workers", runtime.NumCPU()).(int)
+	for i, err := range signer.VerifyBatch(s.Verifier, items, workers) {
+		errs[indexes[i]] = err
+	}
+	return errs
+}
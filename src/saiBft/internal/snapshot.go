@@ -0,0 +1,594 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSnapshotChunkSize = 64 * 1024
+)
+
+var (
+	errNoSnapshot       = errors.New("snapshot was not found")
+	errSnapshotMismatch = errors.New("snapshot manifest hash mismatch")
+)
+
+// take snapshot of application state every snapshot_interval blocks
+func (s *InternalService) snapshotIfNeeded(block *models.BlockConsensusMessage) {
+	interval := s.GlobalService.GetConfig("snapshot_interval", 0).(int)
+	if interval <= 0 || block.Block.Number%interval != 0 {
+		return
+	}
+
+	manifest, err := s.takeSnapshot(block)
+	if err != nil {
+		s.GlobalService.Logger.Error("snapshot - take snapshot", zap.Int("height", block.Block.Number), zap.Error(err))
+		return
+	}
+
+	err = s.broadcastMsg(manifest)
+	if err != nil {
+		s.GlobalService.Logger.Error("snapshot - broadcast snapshot manifest", zap.Int("height", block.Block.Number), zap.Error(err))
+	}
+}
+
+// take snapshot of application state at the block height
+// 1. encode committed transactions up to the block
+// 2. split state into hashed chunks and save them
+// 3. create and sign manifest
+func (s *InternalService) takeSnapshot(block *models.BlockConsensusMessage) (*models.SnapshotManifest, error) {
+	state, err := s.getSnapshotState(block.Block.Number)
+	if err != nil {
+		return nil, fmt.Errorf("get snapshot state : %w", err)
+	}
+
+	chunkSize := s.GlobalService.GetConfig("snapshot_chunk_size", defaultSnapshotChunkSize).(int)
+	chunks := splitSnapshotState(block.Block.Number, state, chunkSize)
+
+	manifest := &models.SnapshotManifest{
+		Type:      models.SnapshotMsgType,
+		ChainID:   s.chainID(),
+		Height:    block.Block.Number,
+		BlockHash: block.BlockHash,
+		StateHash: hashSnapshotState(state),
+	}
+	for _, chunk := range chunks {
+		manifest.ChunkHashes = append(manifest.ChunkHashes, chunk.Hash)
+	}
+
+	manifest.Hash, err = manifest.GetHash()
+	if err != nil {
+		return nil, fmt.Errorf("hash snapshot manifest : %w", err)
+	}
+
+	signature, err := s.signMsg(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("sign snapshot manifest : %w", err)
+	}
+	manifest.Signatures = append(manifest.Signatures, &models.SnapshotSignature{
+		Address:   s.validatorAddress(),
+		Signature: signature,
+	})
+
+	err = s.saveSnapshotChunks(chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.saveSnapshotManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	s.GlobalService.Logger.Sugar().Debugf("snapshot was taken, height : %d, chunks : %d", manifest.Height, len(chunks)) //DEBUG
+
+	return manifest, nil
+}
+
+// committed transaction of the snapshot state
+// only fields, which are the same at all validators, are the part of the state
+// votes and vm results are local for every node, otherwise chunks of validators would differ
+type snapshotTx struct {
+	Tx          *models.Tx `json:"message"`
+	MessageHash string     `json:"message_hash"`
+	BlockHash   string     `json:"block_hash"`
+	BlockNumber int        `json:"block_number"`
+}
+
+// application state at the height - committed transactions ordered by block number and hash
+func (s *InternalService) getSnapshotState(height int) ([]byte, error) {
+	txMsgs, err := s.Storage.CommittedTxs(height)
+	if err != nil {
+		return nil, err
+	}
+
+	state := make([]*snapshotTx, 0, len(txMsgs))
+	for _, tx := range txMsgs {
+		state = append(state, &snapshotTx{
+			Tx:          tx.Tx,
+			MessageHash: tx.MessageHash,
+			BlockHash:   tx.BlockHash,
+			BlockNumber: tx.BlockNumber,
+		})
+	}
+
+	sort.Slice(state, func(i, j int) bool {
+		if state[i].BlockNumber != state[j].BlockNumber {
+			return state[i].BlockNumber < state[j].BlockNumber
+		}
+		return state[i].MessageHash < state[j].MessageHash
+	})
+
+	return json.Marshal(state)
+}
+
+// split state to chunks with the provided size
+func splitSnapshotState(height int, state []byte, chunkSize int) []*models.SnapshotChunk {
+	if chunkSize <= 0 {
+		chunkSize = defaultSnapshotChunkSize
+	}
+
+	chunks := make([]*models.SnapshotChunk, 0)
+	for i := 0; i*chunkSize < len(state); i++ {
+		end := (i + 1) * chunkSize
+		if end > len(state) {
+			end = len(state)
+		}
+		chunk := &models.SnapshotChunk{
+			Height: height,
+			Index:  i,
+			Data:   state[i*chunkSize : end],
+		}
+		chunk.Hash = chunk.GetHash()
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func hashSnapshotState(state []byte) string {
+	hash := sha256.Sum256(state)
+	return hex.EncodeToString(hash[:])
+}
+
+// save snapshot chunks, chunks which already exist are skipped
+func (s *InternalService) saveSnapshotChunks(chunks []*models.SnapshotChunk) error {
+	for _, chunk := range chunks {
+		_, err := s.Storage.SnapshotChunk(chunk.Height, chunk.Index)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("get snapshot chunk : %w", err)
+		}
+
+		err = s.Storage.PutSnapshotChunk(chunk)
+		if err != nil {
+			return fmt.Errorf("put snapshot chunk : %w", err)
+		}
+	}
+	return nil
+}
+
+// save snapshot manifest or add signatures to the existing one
+func (s *InternalService) saveSnapshotManifest(manifest *models.SnapshotManifest) error {
+	existing, err := s.getSnapshotManifest(manifest.Height)
+	if err != nil {
+		if !errors.Is(err, errNoSnapshot) {
+			return err
+		}
+		err = s.Storage.PutSnapshot(manifest)
+		if err != nil {
+			return fmt.Errorf("put snapshot manifest : %w", err)
+		}
+		return nil
+	}
+
+	if existing.Hash != manifest.Hash {
+		return fmt.Errorf("%w, height : %d, local : %s, got : %s", errSnapshotMismatch, manifest.Height, existing.Hash, manifest.Hash)
+	}
+
+	signatures := existing.Signatures
+	updated := false
+	for _, sig := range manifest.Signatures {
+		if hasSnapshotSignature(signatures, sig.Address) {
+			continue
+		}
+		signatures = append(signatures, sig)
+		updated = true
+	}
+
+	if !updated {
+		return nil
+	}
+
+	err = s.Storage.UpdateSnapshotSignatures(manifest.Height, manifest.Hash, signatures)
+	if err != nil {
+		return fmt.Errorf("update snapshot manifest signatures : %w", err)
+	}
+	return nil
+}
+
+func hasSnapshotSignature(signatures []*models.SnapshotSignature, address string) bool {
+	for _, sig := range signatures {
+		if sig.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// get snapshot manifest for the height, height = 0 means the latest snapshot
+func (s *InternalService) getSnapshotManifest(height int) (*models.SnapshotManifest, error) {
+	manifest, err := s.Storage.Snapshot(height)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, errNoSnapshot
+		}
+		return nil, fmt.Errorf("get snapshot manifest : %w", err)
+	}
+	return manifest, nil
+}
+
+// get snapshot chunk by height and index
+func (s *InternalService) getSnapshotChunk(height, index int) (*models.SnapshotChunk, error) {
+	chunk, err := s.Storage.SnapshotChunk(height, index)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, errNoSnapshot
+		}
+		return nil, fmt.Errorf("get snapshot chunk : %w", err)
+	}
+	return chunk, nil
+}
+
+// handle snapshot manifest, which was signed by another validator
+func (s *InternalService) handleSnapshotMsg(msg *models.SnapshotManifest) error {
+	hash, err := msg.GetHash()
+	if err != nil {
+		return err
+	}
+	if hash != msg.Hash {
+		return fmt.Errorf("wrong snapshot manifest hash, counted : %s, got : %s", hash, msg.Hash)
+	}
+
+	signatures := s.validSnapshotSignatures(msg)
+	if len(signatures) == 0 {
+		return errors.New("snapshot manifest has no valid signatures from trusted validators")
+	}
+	msg.Signatures = signatures
+
+	return s.saveSnapshotManifest(msg)
+}
+
+// signatures of the manifest from trusted validators, which are valid
+func (s *InternalService) validSnapshotSignatures(manifest *models.SnapshotManifest) []*models.SnapshotSignature {
+	signatures := make([]*models.SnapshotSignature, 0)
+	for _, sig := range manifest.Signatures {
+		if hasSnapshotSignature(signatures, sig.Address) {
+			continue
+		}
+		if !s.isTrustedValidator(sig.Address) {
+			continue
+		}
+		err := s.validateValidatorSignature(manifest, sig.Address, manifest.Height, sig.Signature)
+		if err != nil {
+			s.GlobalService.Logger.Error("snapshot - validate manifest signature", zap.String("validator", sig.Address), zap.Error(err))
+			continue
+		}
+		signatures = append(signatures, sig)
+	}
+	return signatures
+}
+
+func (s *InternalService) isTrustedValidator(address string) bool {
+	for _, validator := range s.TrustedValidators {
+		if validator == address {
+			return true
+		}
+	}
+	return false
+}
+
+// check that the manifest is consistent and signed by enough trusted validators
+func (s *InternalService) verifySnapshotManifest(manifest *models.SnapshotManifest) error {
+	err := manifest.Validate()
+	if err != nil {
+		return err
+	}
+	err = s.checkChainID(manifest.ChainID)
+	if err != nil {
+		return err
+	}
+
+	hash, err := manifest.GetHash()
+	if err != nil {
+		return err
+	}
+	if hash != manifest.Hash {
+		return fmt.Errorf("wrong snapshot manifest hash, counted : %s, got : %s", hash, manifest.Hash)
+	}
+
+	required := math.Ceil(float64(len(s.TrustedValidators)) * 7 / 10)
+	signatures := s.validSnapshotSignatures(manifest)
+	if float64(len(signatures)) < required {
+		return fmt.Errorf("not enough snapshot manifest signatures, required : %v, got : %d", required, len(signatures))
+	}
+	return nil
+}
+
+// run fast sync if node has no blocks yet
+func (s *InternalService) fastSyncIfNeeded() {
+	empty, err := s.isBlockchainEmpty()
+	if err != nil {
+		s.GlobalService.Logger.Error("fast sync - check blockchain", zap.Error(err))
+		return
+	}
+	if !empty {
+		return
+	}
+
+	err = s.fastSync()
+	if err != nil {
+		s.GlobalService.Logger.Error("fast sync - sync from snapshot, blocks will be synced from the beginning", zap.Error(err))
+	}
+}
+
+// fast sync - restore state from the latest snapshot of connected nodes and sync blocks after it
+func (s *InternalService) fastSync() error {
+	nodes, err := s.Transport.Peers()
+	if err != nil {
+		return fmt.Errorf("get connected nodes : %w", err)
+	}
+
+	var (
+		manifest      *models.SnapshotManifest
+		manifestNodes []string
+	)
+	for _, node := range nodes {
+		m, err := s.requestSnapshot(node, 0)
+		if err != nil {
+			s.GlobalService.Logger.Error("fast sync - get snapshot manifest", zap.String("node", node), zap.Error(err))
+			continue
+		}
+		err = s.verifySnapshotManifest(m)
+		if err != nil {
+			s.GlobalService.Logger.Error("fast sync - verify snapshot manifest", zap.String("node", node), zap.Error(err))
+			continue
+		}
+		switch {
+		case manifest == nil || m.Height > manifest.Height:
+			manifest = m
+			manifestNodes = []string{node}
+		case m.Hash == manifest.Hash:
+			manifestNodes = append(manifestNodes, node)
+		}
+	}
+
+	if manifest == nil {
+		return errNoSnapshot
+	}
+
+	header, err := s.getSnapshotHeader(manifest, manifestNodes)
+	if err != nil {
+		return err
+	}
+
+	chunks, state, err := s.fetchSnapshotChunks(manifest, manifestNodes)
+	if err != nil {
+		return err
+	}
+
+	err = s.restoreSnapshot(manifest, header, chunks, state)
+	if err != nil {
+		return err
+	}
+
+	s.GlobalService.Logger.Sugar().Debugf("state was restored from snapshot, height : %d", manifest.Height) //DEBUG
+
+	return s.syncBlocksAfter(header, manifestNodes)
+}
+
+// get block header of the snapshot from connected nodes and verify it
+// block should be signed by trusted validator and match the fast_sync_trust_hash if it is set
+func (s *InternalService) getSnapshotHeader(manifest *models.SnapshotManifest, nodes []string) (*models.BlockConsensusMessage, error) {
+	trustHash := s.GlobalService.GetConfig("fast_sync_trust_hash", "").(string)
+	if trustHash != "" && trustHash != manifest.BlockHash {
+		return nil, fmt.Errorf("snapshot block hash does not match trusted hash, trusted : %s, got : %s", trustHash, manifest.BlockHash)
+	}
+
+	for _, node := range nodes {
+		blocks, err := s.requestBlocks(node, manifest.Height, manifest.Height)
+		if err != nil {
+			s.GlobalService.Logger.Error("fast sync - get snapshot block", zap.String("node", node), zap.Error(err))
+			continue
+		}
+		for _, block := range blocks {
+			if block.Block == nil || block.Block.Number != manifest.Height {
+				continue
+			}
+			err = s.verifySyncedBlock(block)
+			if err != nil {
+				s.GlobalService.Logger.Error("fast sync - verify snapshot block", zap.String("node", node), zap.Error(err))
+				continue
+			}
+			if block.BlockHash != manifest.BlockHash {
+				continue
+			}
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("verified block for snapshot height %d was not found", manifest.Height)
+}
+
+// check block hash and signatures of validators
+// block should be signed by 7/10 of trusted validators, as it is required by consensus
+func (s *InternalService) verifySyncedBlock(block *models.BlockConsensusMessage) error {
+	err := s.checkChainID(block.Block.ChainID)
+	if err != nil {
+		return err
+	}
+	hash, err := block.Block.GetHash()
+	if err != nil {
+		return err
+	}
+	if hash != block.BlockHash {
+		return fmt.Errorf("wrong block hash, counted : %s, got : %s", hash, block.BlockHash)
+	}
+
+	required := math.Ceil(float64(len(s.TrustedValidators)) * 7 / 10)
+	signed := s.blockSigners(block)
+	if float64(signed) < required {
+		return fmt.Errorf("not enough block signatures, required : %v, got : %d", required, signed)
+	}
+	return nil
+}
+
+// number of trusted validators, which signed the block
+// every validator signs the block with its own address as the sender, signatures are not bound to addresses
+func (s *InternalService) blockSigners(block *models.BlockConsensusMessage) int {
+	signed := 0
+	for _, validator := range s.TrustedValidators {
+		signedBlock := *block.Block
+		signedBlock.SenderAddress = validator
+		msg := &models.BlockConsensusMessage{Block: &signedBlock}
+		for _, signature := range block.Signatures {
+			if s.validateValidatorSignature(msg, validator, block.Block.Number, signature) == nil {
+				signed++
+				break
+			}
+		}
+	}
+	return signed
+}
+
+// get all snapshot chunks from connected nodes, check chunk hashes and state hash
+func (s *InternalService) fetchSnapshotChunks(manifest *models.SnapshotManifest, nodes []string) ([]*models.SnapshotChunk, []byte, error) {
+	chunks := make([]*models.SnapshotChunk, 0, len(manifest.ChunkHashes))
+	state := make([]byte, 0)
+
+	for i, hash := range manifest.ChunkHashes {
+		var chunk *models.SnapshotChunk
+		// spread chunk requests between nodes, try next node if chunk is invalid
+		for j := 0; j < len(nodes) && chunk == nil; j++ {
+			node := nodes[(i+j)%len(nodes)]
+			c, err := s.requestSnapshotChunk(node, manifest.Height, i)
+			if err != nil {
+				s.GlobalService.Logger.Error("fast sync - get snapshot chunk", zap.String("node", node), zap.Int("index", i), zap.Error(err))
+				continue
+			}
+			if c.GetHash() != hash {
+				s.GlobalService.Logger.Error("fast sync - wrong snapshot chunk hash", zap.String("node", node), zap.Int("index", i))
+				continue
+			}
+			chunk = c
+		}
+		if chunk == nil {
+			return nil, nil, fmt.Errorf("snapshot chunk %d was not found", i)
+		}
+		chunks = append(chunks, chunk)
+		state = append(state, chunk.Data...)
+	}
+
+	if hashSnapshotState(state) != manifest.StateHash {
+		return nil, nil, errors.New("wrong snapshot state hash")
+	}
+	return chunks, state, nil
+}
+
+// restore application state from snapshot
+func (s *InternalService) restoreSnapshot(manifest *models.SnapshotManifest, header *models.BlockConsensusMessage, chunks []*models.SnapshotChunk, state []byte) error {
+	txMsgs := make([]*snapshotTx, 0)
+	err := json.Unmarshal(state, &txMsgs)
+	if err != nil {
+		return fmt.Errorf("unmarshal snapshot state : %w", err)
+	}
+
+	// state is ordered by block number, so key rotations are applied in the same order as they were committed
+	committed := make(map[string]*models.Tx)
+	for i, tx := range txMsgs {
+		err = s.Storage.PutTx(&models.TransactionMessage{
+			Tx:          tx.Tx,
+			MessageHash: tx.MessageHash,
+			BlockHash:   tx.BlockHash,
+			BlockNumber: tx.BlockNumber,
+		})
+		if err != nil {
+			return fmt.Errorf("restore snapshot - put tx : %w", err)
+		}
+		committed[tx.MessageHash] = tx.Tx
+		if i == len(txMsgs)-1 || txMsgs[i+1].BlockNumber != tx.BlockNumber {
+			s.applyKeyRotations(tx.BlockNumber, committed)
+			committed = make(map[string]*models.Tx)
+		}
+	}
+
+	err = s.saveBlock(header)
+	if err != nil {
+		return fmt.Errorf("restore snapshot - put block : %w", err)
+	}
+
+	err = s.saveSnapshotChunks(chunks)
+	if err != nil {
+		return err
+	}
+
+	return s.saveSnapshotManifest(manifest)
+}
+
+// sync blocks after the snapshot block, each block should be linked to the previous one
+func (s *InternalService) syncBlocksAfter(header *models.BlockConsensusMessage, nodes []string) error {
+	for _, node := range nodes {
+		blocks, err := s.requestBlocks(node, header.Block.Number+1, math.MaxInt32)
+		if err != nil {
+			s.GlobalService.Logger.Error("fast sync - get blocks after snapshot", zap.String("node", node), zap.Error(err))
+			continue
+		}
+
+		sort.Slice(blocks, func(i, j int) bool {
+			return blocks[i].Block.Number < blocks[j].Block.Number
+		})
+
+		previous := header
+		for _, block := range blocks {
+			if block.Block.Number != previous.Block.Number+1 || block.Block.PreviousBlockHash != previous.BlockHash {
+				break
+			}
+			err = s.verifySyncedBlock(block)
+			if err != nil {
+				s.GlobalService.Logger.Error("fast sync - verify block", zap.String("node", node), zap.Int("number", block.Block.Number), zap.Error(err))
+				break
+			}
+			err = s.saveBlock(block)
+			if err != nil {
+				return fmt.Errorf("fast sync - put block : %w", err)
+			}
+			previous = block
+		}
+
+		s.GlobalService.Logger.Sugar().Debugf("fast sync - blocks were synced up to : %d", previous.Block.Number) //DEBUG
+		return nil
+	}
+	return errors.New("fast sync - blocks after snapshot were not synced")
+}
+
+// check if blockchain collection has no blocks
+func (s *InternalService) isBlockchainEmpty() (bool, error) {
+	_, err := s.Storage.LastBlock()
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
@@ -0,0 +1,309 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"github.com/iamthe1whoknocks/bft/transport"
+)
+
+// small chunks, so the state is split to several chunks
+var snapshotTestConfig = map[string]interface{}{
+	"snapshot_chunk_size": 64,
+}
+
+type snapshotTestChain struct {
+	network    *transport.LoopbackNetwork
+	validators []*models.BtcKeys
+	nodes      []*InternalService
+	header     *models.BlockConsensusMessage
+	txs        []*models.TransactionMessage
+	manifest   *models.SnapshotManifest
+}
+
+func committedTx(t *testing.T, message string, block *models.BlockConsensusMessage) *models.TransactionMessage {
+	t.Helper()
+	tx := &models.Tx{
+		ChainID:       testChainID,
+		SenderAddress: block.Block.SenderAddress,
+		Message:       message,
+	}
+	hash, err := tx.GetHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.MessageHash = hash
+	block.Block.Messages[hash] = tx
+	return &models.TransactionMessage{
+		Tx:          tx,
+		MessageHash: hash,
+		BlockHash:   block.BlockHash,
+		BlockNumber: block.Block.Number,
+	}
+}
+
+// three of four validators have the same blocks and committed txs, vm results of txs are local for every validator
+// every validator takes snapshot at block 2 and signatures of manifests are exchanged
+func newSnapshotTestChain(t *testing.T) *snapshotTestChain {
+	t.Helper()
+	c := &snapshotTestChain{
+		network:    transport.NewLoopbackNetwork(1),
+		validators: generateKeys(t, 4),
+	}
+	for _, k := range c.validators[:3] {
+		c.nodes = append(c.nodes, newTestNode(t, c.network, k, c.validators, snapshotTestConfig))
+	}
+	signers := c.validators[:3]
+
+	// txs are a part of block hash, so blocks are signed after txs are added
+	block1 := signedBlock(t, 1, initialBlockHash(t, c.nodes[0]), nil, signers...)
+	tx1 := committedTx(t, "tx 1", block1)
+	block1 = signedBlock(t, 1, block1.Block.PreviousBlockHash, block1.Block.Messages, signers...)
+	tx1.BlockHash = block1.BlockHash
+
+	block2 := signedBlock(t, 2, block1.BlockHash, nil, signers...)
+	tx2 := committedTx(t, "tx 2", block2)
+	tx3 := committedTx(t, "tx 3", block2)
+	block2 = signedBlock(t, 2, block1.BlockHash, block2.Block.Messages, signers...)
+	tx2.BlockHash = block2.BlockHash
+	tx3.BlockHash = block2.BlockHash
+
+	c.header = block2
+	c.txs = []*models.TransactionMessage{tx1, tx2, tx3}
+
+	manifests := make([]*models.SnapshotManifest, 0, len(c.nodes))
+	for i, node := range c.nodes {
+		putBlocks(t, node, block1, block2)
+		for _, tx := range c.txs {
+			local := *tx
+			local.Votes = [7]uint64{uint64(i)}
+			local.VmProcessed = true
+			local.VmResult = i%2 == 0
+			local.VmResponse = fmt.Sprintf("response of node %d", i)
+			err := node.Storage.PutTx(&local)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		manifest, err := node.takeSnapshot(block2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(manifests) > 0 && manifest.Hash != manifests[0].Hash {
+			t.Fatalf("snapshot hash of node %d = %s, want %s", i, manifest.Hash, manifests[0].Hash)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	for i, node := range c.nodes {
+		for j, manifest := range manifests {
+			if i == j {
+				continue
+			}
+			err := node.handleSnapshotMsg(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	manifest, err := c.nodes[0].getSnapshotManifest(block2.Block.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.manifest = manifest
+	return c
+}
+
+func (c *snapshotTestChain) peers() []string {
+	peers := make([]string, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		peers = append(peers, node.validatorAddress())
+	}
+	return peers
+}
+
+func signManifest(t *testing.T, manifest *models.SnapshotManifest, k *models.BtcKeys) *models.SnapshotSignature {
+	t.Helper()
+	payload, err := models.SignPayload(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeSigner, err := signer.NewEd25519Signer(k.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := nodeSigner.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.SnapshotSignature{Address: k.Address, Signature: signature}
+}
+
+// snapshot is taken by validators, verified and restored by the new node
+func TestSnapshotFastSync(t *testing.T) {
+	c := newSnapshotTestChain(t)
+	if len(c.manifest.ChunkHashes) < 2 {
+		t.Fatalf("snapshot chunks = %d, want several chunks", len(c.manifest.ChunkHashes))
+	}
+	if len(c.manifest.Signatures) != len(c.nodes) {
+		t.Fatalf("snapshot signatures = %d, want %d", len(c.manifest.Signatures), len(c.nodes))
+	}
+
+	s := newTestNode(t, c.network, nil, c.validators, snapshotTestConfig)
+	err := s.fastSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := blockHashes(t, s)
+	want := []string{c.header.BlockHash}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks after fast sync = %v, want %v", got, want)
+	}
+	for _, want := range c.txs {
+		tx, err := s.Storage.TxByHash(want.MessageHash)
+		if err != nil {
+			t.Fatalf("tx %s was not restored : %v", want.Tx.Message, err)
+		}
+		if tx.BlockHash != want.BlockHash || tx.BlockNumber != want.BlockNumber {
+			t.Errorf("tx %s block = %d %s, want %d %s", want.Tx.Message, tx.BlockNumber, tx.BlockHash, want.BlockNumber, want.BlockHash)
+		}
+		if tx.VmProcessed {
+			t.Errorf("vm result of tx %s was restored from snapshot", want.Tx.Message)
+		}
+	}
+	manifest, err := s.getSnapshotManifest(c.header.Block.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Hash != c.manifest.Hash {
+		t.Errorf("restored snapshot hash = %s, want %s", manifest.Hash, c.manifest.Hash)
+	}
+}
+
+func TestVerifySnapshotManifest(t *testing.T) {
+	c := newSnapshotTestChain(t)
+	s := newTestNode(t, c.network, nil, c.validators, snapshotTestConfig)
+	untrusted := generateKeys(t, 1)[0]
+
+	tests := []struct {
+		name    string
+		change  func(m *models.SnapshotManifest)
+		wantErr bool
+	}{
+		{
+			name:   "signed by enough validators",
+			change: func(m *models.SnapshotManifest) {},
+		},
+		{
+			name: "wrong hash",
+			change: func(m *models.SnapshotManifest) {
+				m.Hash = c.header.BlockHash
+			},
+			wantErr: true,
+		},
+		{
+			name: "state hash does not match hash",
+			change: func(m *models.SnapshotManifest) {
+				m.StateHash = hashSnapshotState([]byte("other state"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "not enough signatures",
+			change: func(m *models.SnapshotManifest) {
+				m.Signatures = m.Signatures[:2]
+			},
+			wantErr: true,
+		},
+		{
+			name: "same signature several times",
+			change: func(m *models.SnapshotManifest) {
+				m.Signatures = []*models.SnapshotSignature{m.Signatures[0], m.Signatures[0], m.Signatures[0]}
+			},
+			wantErr: true,
+		},
+		{
+			name: "signature of untrusted node",
+			change: func(m *models.SnapshotManifest) {
+				m.Signatures = append(m.Signatures[:2], signManifest(t, m, untrusted))
+			},
+			wantErr: true,
+		},
+		{
+			name: "signature of validator with another address",
+			change: func(m *models.SnapshotManifest) {
+				sig := *m.Signatures[2]
+				sig.Address = c.validators[3].Address
+				m.Signatures = append(m.Signatures[:2], &sig)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := *c.manifest
+			manifest.Signatures = append([]*models.SnapshotSignature{}, c.manifest.Signatures...)
+			tt.change(&manifest)
+
+			err := s.verifySnapshotManifest(&manifest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error : %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// chunk with wrong hash is requested from the next node
+func TestFetchSnapshotChunks(t *testing.T) {
+	c := newSnapshotTestChain(t)
+
+	// node returns changed chunks of the snapshot
+	bad := newTestNode(t, c.network, nil, c.validators, snapshotTestConfig)
+	err := bad.Storage.PutSnapshot(c.manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []byte
+	for i := range c.manifest.ChunkHashes {
+		chunk, err := c.nodes[0].getSnapshotChunk(c.manifest.Height, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, chunk.Data...)
+		chunk.Data = bytes.ToUpper(chunk.Data)
+		err = bad.Storage.PutSnapshotChunk(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestNode(t, c.network, nil, c.validators, snapshotTestConfig)
+	_, _, err = s.fetchSnapshotChunks(c.manifest, []string{bad.validatorAddress()})
+	if err == nil {
+		t.Error("changed snapshot chunks were accepted")
+	}
+	chunks, state, err := s.fetchSnapshotChunks(c.manifest, append([]string{bad.validatorAddress()}, c.peers()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(state, want) {
+		t.Errorf("state = %s, want %s", state, want)
+	}
+	if len(chunks) != len(c.manifest.ChunkHashes) {
+		t.Errorf("chunks = %d, want %d", len(chunks), len(c.manifest.ChunkHashes))
+	}
+
+	// state hash is checked, even if chunk hashes match
+	manifest := *c.manifest
+	manifest.StateHash = hashSnapshotState([]byte("other state"))
+	_, _, err = s.fetchSnapshotChunks(&manifest, c.peers())
+	if err == nil {
+		t.Error("state with wrong hash was accepted")
+	}
+}
@@ -3,22 +3,55 @@ package internal
 import (
 	"log"
 
-	"github.com/iamthe1whoknocks/bft/utils"
+	"github.com/iamthe1whoknocks/bft/storage"
 )
 
-func NewDB() utils.Database {
-	url, ok := Service.GlobalService.Configuration["storage_url"].(string)
+const (
+	saiStorageType     = "saiStorage"
+	boltStorageType    = "bolt"
+	memoryStorageType  = "memory"
+	defaultStoragePath = "data/bft.db"
+)
+
+// create storage, which is chosen by storage_type config key
+func (s *InternalService) NewDB() storage.Store {
+	storageType := s.GlobalService.GetConfig("storage_type", saiStorageType).(string)
+
+	switch storageType {
+	case saiStorageType:
+		return s.newSaiStorage()
+	case boltStorageType:
+		path := s.GlobalService.GetConfig("storage_path", defaultStoragePath).(string)
+		store, err := storage.NewBoltStore(path)
+		if err != nil {
+			log.Fatalf("configuration : open bolt storage : %s", err.Error())
+		}
+		return store
+	case memoryStorageType:
+		return storage.NewMemoryStore()
+	default:
+		log.Fatalf("configuration : invalid storage type provided, type : %s", storageType)
+	}
+	return nil
+}
+
+func (s *InternalService) newSaiStorage() storage.Store {
+	url, ok := s.GlobalService.Configuration["storage_url"].(string)
+	if !ok {
+		log.Fatalf("configuration : invalid storage url provided, url : %s", s.GlobalService.Configuration["storage_url"])
+	}
+	email, ok := s.GlobalService.Configuration["storage_email"].(string)
 	if !ok {
-		log.Fatalf("configuration : invalid storage url provided, url : %s", Service.GlobalService.Configuration["storage_url"])
+		log.Fatalf("configuration : invalid storage email provided, email : %s", s.GlobalService.Configuration["storage_email"])
 	}
-	email, ok := Service.GlobalService.Configuration["storage_email"].(string)
+	password, ok := s.GlobalService.Configuration["storage_password"].(string)
 	if !ok {
-		log.Fatalf("configuration : invalid storage email provided, email : %s", Service.GlobalService.Configuration["storage_email"])
+		log.Fatalf("configuration : invalid storage password provided, password : %s", s.GlobalService.Configuration["storage_email"])
 	}
-	password, ok := Service.GlobalService.Configuration["storage_password"].(string)
+	token, ok := s.GlobalService.Configuration["storage_token"].(string)
 	if !ok {
-		log.Fatalf("configuration : invalid storage password provided, password : %s", Service.GlobalService.Configuration["storage_email"])
+		log.Fatalf("configuration : invalid storage token provided, token : %s", s.GlobalService.Configuration["storage_token"])
 	}
 
-	return utils.Storage(url, email, password)
+	return storage.NewSaiStorage(s.ioCtx, url, email, password, token)
 }
@@ -2,19 +2,19 @@ package internal
 
 import (
 	"github.com/iamthe1whoknocks/bft/models"
-	"github.com/iamthe1whoknocks/bft/utils"
 	"go.uber.org/zap"
 )
 
 // unput data for testing purposes
 
 // save test tx (for testing purposes)
-func (s *InternalService) saveTestTx(saiBtcAddress, storageToken, saiP2PAddress string) {
+func (s *InternalService) saveTestTx() {
 	testTxMsg := &models.TransactionMessage{
 		Votes: [7]uint64{},
 		Tx: &models.Tx{
 			Type:          models.TransactionMsgType,
-			SenderAddress: s.BTCkeys.Address,
+			ChainID:       s.chainID(),
+			SenderAddress: s.currentSigner().Address(),
 			Message:       "test tx message",
 		},
 	}
@@ -27,18 +27,18 @@ func (s *InternalService) saveTestTx(saiBtcAddress, storageToken, saiP2PAddress
 	testTxMsg.Tx.MessageHash = testTxHash
 	testTxMsg.MessageHash = testTxHash
 
-	resp, err := utils.SignMessage(testTxMsg, saiBtcAddress, s.BTCkeys.Private)
+	signature, err := s.signMsg(testTxMsg)
 	if err != nil {
 		s.GlobalService.Logger.Fatal("processing - sign test tx error", zap.Error(err))
 	}
-	testTxMsg.Tx.SenderSignature = resp.Signature
+	testTxMsg.Tx.SenderSignature = signature
 
-	err, _ = s.Storage.Put("MessagesPool", testTxMsg, storageToken)
+	err = s.Storage.PutTx(testTxMsg)
 	if err != nil {
 		s.GlobalService.Logger.Fatal("processing - put test tx msg", zap.Error(err))
 	}
 
-	bcErr := s.broadcastMsg(testTxMsg.Tx, saiP2PAddress)
+	bcErr := s.broadcastMsg(testTxMsg.Tx)
 	if bcErr != nil {
 		s.GlobalService.Logger.Fatal("processing - broadcast test tx msg", zap.Error(err))
 	}
@@ -46,9 +46,10 @@ func (s *InternalService) saveTestTx(saiBtcAddress, storageToken, saiP2PAddress
 }
 
 // save test consensusMsg (for testing purposes)
-func (s *InternalService) saveTestConsensusMsg(saiBtcAddress, storageToken, senderAddress string) {
+func (s *InternalService) saveTestConsensusMsg(senderAddress string) {
 	testConsensusMsg := &models.ConsensusMessage{
 		Type:          models.ConsensusMsgType,
+		ChainID:       s.chainID(),
 		SenderAddress: senderAddress,
 		BlockNumber:   3,
 		Round:         7,
@@ -62,13 +63,13 @@ func (s *InternalService) saveTestConsensusMsg(saiBtcAddress, storageToken, send
 
 	testConsensusMsg.Hash = testConsensusHash
 
-	resp, err := utils.SignMessage(testConsensusMsg, saiBtcAddress, s.BTCkeys.Private)
+	signature, err := s.signMsg(testConsensusMsg)
 	if err != nil {
 		s.GlobalService.Logger.Fatal("processing - sign test consensus error", zap.Error(err))
 	}
-	testConsensusMsg.Signature = resp.Signature
+	testConsensusMsg.Signature = signature
 
-	err, _ = s.Storage.Put("ConsensusPool", testConsensusMsg, storageToken)
+	err = s.Storage.PutConsensusMsg(testConsensusMsg)
 	if err != nil {
 		s.GlobalService.Logger.Fatal("processing - put test consensus msg", zap.Error(err))
 	}
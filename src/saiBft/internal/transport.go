@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/storage"
+	"github.com/iamthe1whoknocks/bft/transport"
+	"go.uber.org/zap"
+)
+
+const (
+	saiP2pTransportType = "saiP2p"
+	gossipTransportType = "gossip"
+
+	defaultGossipListen        = ":9100"
+	defaultRequestTimeout      = 10 // seconds
+	defaultMaxBlocksPerRequest = 100
+)
+
+// create transport by transport config key
+// saiP2p - messages are sent via saiP2p service, gossip - native tcp gossip between nodes
+func (s *InternalService) newTransport() (transport.Transport, error) {
+	transportType := s.GlobalService.GetConfig("transport", saiP2pTransportType).(string)
+	switch transportType {
+	case saiP2pTransportType:
+		saiP2pAddress, ok := s.GlobalService.Configuration["saiP2P_address"].(string)
+		if !ok {
+			return nil, fmt.Errorf("wrong type of saiP2P_address value in config")
+		}
+		saiP2pProxyAddress, ok := s.GlobalService.Configuration["saiProxy_address"].(string)
+		if !ok {
+			return nil, fmt.Errorf("wrong type of saiProxy_address value in config")
+		}
+		replyTo := s.GlobalService.GetConfig("saiP2P_public_address", "").(string)
+		if replyTo == "" {
+			s.GlobalService.Logger.Warn("transport - saiP2P_public_address is not set, blocks and snapshots can't be requested from other nodes")
+		}
+		return transport.NewSaiP2p(s.ioCtx, &transport.SaiP2pConfig{
+			Address:        saiP2pAddress,
+			ProxyAddress:   saiP2pProxyAddress,
+			ReplyTo:        replyTo,
+			RequestTimeout: s.requestTimeout(),
+		}), nil
+	case gossipTransportType:
+		// GetConfig doesn't return lists, so seeds are taken from gossip section directly
+		gossipConfig, _ := s.GlobalService.Configuration["gossip"].(map[string]interface{})
+		seedsInterface, _ := gossipConfig["seeds"].([]interface{})
+		seeds := make([]string, 0, len(seedsInterface))
+		for _, seed := range seedsInterface {
+			seeds = append(seeds, seed.(string))
+		}
+		config := &transport.GossipConfig{
+			Listen:         s.GlobalService.GetConfig("gossip.listen", defaultGossipListen).(string),
+			Advertise:      s.GlobalService.GetConfig("gossip.advertise", "").(string),
+			Seeds:          seeds,
+			MaxPeers:       s.GlobalService.GetConfig("gossip.max_peers", 0).(int),
+			RequestTimeout: s.requestTimeout(),
+		}
+		return transport.NewGossip(config, &transportHandler{s: s}, s.GlobalService.Logger), nil
+	default:
+		return nil, fmt.Errorf("invalid transport type provided, type : %s", transportType)
+	}
+}
+
+// time to wait for response of direct request
+func (s *InternalService) requestTimeout() time.Duration {
+	return time.Duration(s.GlobalService.GetConfig("request_timeout", defaultRequestTimeout).(int)) * time.Second
+}
+
+// number of blocks, which node sends in response to one request
+func (s *InternalService) maxBlocksPerRequest() int {
+	maxBlocks := s.GlobalService.GetConfig("max_blocks_per_request", defaultMaxBlocksPerRequest).(int)
+	if maxBlocks < 1 {
+		return defaultMaxBlocksPerRequest
+	}
+	return maxBlocks
+}
+
+// StartTransport starts transport, which listens for peers itself (gossip)
+func (s *InternalService) StartTransport() {
+	starter, ok := s.Transport.(transport.Starter)
+	if !ok {
+		return
+	}
+	err := starter.Start()
+	if err != nil {
+		s.GlobalService.Logger.Fatal("transport - start", zap.Error(err))
+	}
+}
+
+// passes messages and requests from transport to the node
+type transportHandler struct {
+	s *InternalService
+}
+
+func (h *transportHandler) HandleMessage(data []byte) error {
+	m := make(map[string]interface{})
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return fmt.Errorf("unmarshal message : %w", err)
+	}
+	_, err = h.s.handleMessage(m)
+	return err
+}
+
+func (h *transportHandler) HandleRequest(data []byte) ([]byte, error) {
+	return h.s.handleRequest(data)
+}
+
+// answer direct request of connected node : snapshot manifest, snapshot chunk or blocks
+func (s *InternalService) handleRequest(data []byte) ([]byte, error) {
+	request := &models.SnapshotRequest{}
+	err := json.Unmarshal(data, request)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal request : %w", err)
+	}
+
+	var response interface{}
+	switch request.Type {
+	case models.GetSnapshotMsgType:
+		response, err = s.getSnapshotManifest(request.Height)
+	case models.GetSnapshotChunkMsgType:
+		response, err = s.getSnapshotChunk(request.Height, request.Index)
+	case models.GetHeightMsgType:
+		response, err = s.height()
+	case models.GetBlocksMsgType:
+		syncRequest := &models.SyncRequest{}
+		err = json.Unmarshal(data, syncRequest)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal sync request : %w", err)
+		}
+		from := syncRequest.From
+		if from < 1 {
+			from = 1
+		}
+		// requester gets the rest of blocks by next requests
+		to := syncRequest.Number
+		if maxBlocks := s.maxBlocksPerRequest(); to-from+1 > maxBlocks {
+			to = from + maxBlocks - 1
+		}
+		response, err = s.Storage.Blocks(from, to)
+	default:
+		return nil, fmt.Errorf("unknown request type : %q", request.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(response)
+}
+
+// answer direct request of the node, which came as message (saiP2p)
+func (s *InternalService) answerRequest(request *models.PeerRequest) error {
+	responder, ok := s.Transport.(transport.Responder)
+	if !ok {
+		return errors.New("transport doesn't answer requests by messages")
+	}
+	resp := &models.PeerResponse{
+		Type:      models.ResponseMsgType,
+		RequestID: request.RequestID,
+	}
+	data, err := s.handleRequest(request.Payload)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Payload = data
+	}
+	return responder.Respond(request, resp)
+}
+
+// pass response message to the request, which waits for it
+func (s *InternalService) handleResponse(resp *models.PeerResponse) {
+	responder, ok := s.Transport.(transport.Responder)
+	if !ok || !responder.HandleResponse(resp) {
+		s.GlobalService.Logger.Debug("transport - response without request", zap.String("request_id", resp.RequestID)) // DEBUG
+	}
+}
+
+// number of the last block of the node, 0 if there are no blocks
+func (s *InternalService) height() (*models.HeightResponse, error) {
+	block, err := s.Storage.LastBlock()
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return &models.HeightResponse{}, nil
+		}
+		return nil, err
+	}
+	return &models.HeightResponse{Height: block.Block.Number}, nil
+}
+
+// connected nodes, which have blocks up to height, all connected nodes if transport doesn't know heights of the peers
+func (s *InternalService) peersAtHeight(height int) ([]string, error) {
+	if heightPeers, ok := s.Transport.(transport.HeightPeers); ok {
+		return heightPeers.PeersAtHeight(height)
+	}
+	return s.Transport.Peers()
+}
+
+// broadcast message to all nodes
+func (s *InternalService) broadcastMsg(msg interface{}) error {
+	// faulty validator sends changed messages itself
+	sent, err := s.misbehave(msg)
+	if !sent {
+		err = s.Transport.Broadcast(msg)
+	}
+	if err != nil {
+		s.GlobalService.Logger.Error("process - broadcastMsg", zap.Error(err))
+		return err
+	}
+	s.GlobalService.Logger.Sugar().Debugf("broadcasting - success, message : %+v", msg) // DEBUG
+	return nil
+}
+
+// get blocks from the node, only blocks with number >= from are requested
+// node answers limited number of blocks (max_blocks_per_request), so blocks are requested till node has no next blocks
+func (s *InternalService) requestBlocks(node string, from, blockNumber int) ([]*models.BlockConsensusMessage, error) {
+	if from < 1 {
+		from = 1
+	}
+	blocks := make([]*models.BlockConsensusMessage, 0)
+	for from <= blockNumber {
+		respData, err := s.Transport.Request(node, &models.SyncRequest{
+			Type:   models.GetBlocksMsgType,
+			Number: blockNumber,
+			From:   from,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("chain - requestBlocks : %w", err)
+		}
+
+		page := make([]*models.BlockConsensusMessage, 0)
+		err = json.Unmarshal(respData, &page)
+		if err != nil {
+			return nil, fmt.Errorf("chain - requestBlocks - unmarshal response : %w", err)
+		}
+
+		next := from
+		for _, block := range page {
+			if block.Block == nil || block.Block.Number < from || block.Block.Number > blockNumber {
+				continue
+			}
+			blocks = append(blocks, block)
+			if block.Block.Number >= next {
+				next = block.Block.Number + 1
+			}
+		}
+		if next == from {
+			break
+		}
+		from = next
+	}
+	return blocks, nil
+}
+
+// get snapshot manifest from the node
+// height = 0 requests the latest snapshot of the node
+func (s *InternalService) requestSnapshot(node string, height int) (*models.SnapshotManifest, error) {
+	respData, err := s.Transport.Request(node, &models.SnapshotRequest{
+		Type:   models.GetSnapshotMsgType,
+		Height: height,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot - requestSnapshot : %w", err)
+	}
+
+	manifest := &models.SnapshotManifest{}
+	err = json.Unmarshal(respData, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot - requestSnapshot - unmarshal response : %w", err)
+	}
+	return manifest, nil
+}
+
+// get snapshot chunk from the node
+func (s *InternalService) requestSnapshotChunk(node string, height, index int) (*models.SnapshotChunk, error) {
+	respData, err := s.Transport.Request(node, &models.SnapshotRequest{
+		Type:   models.GetSnapshotChunkMsgType,
+		Height: height,
+		Index:  index,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot - requestSnapshotChunk : %w", err)
+	}
+
+	chunk := &models.SnapshotChunk{}
+	err = json.Unmarshal(respData, chunk)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot - requestSnapshotChunk - unmarshal response : %w", err)
+	}
+	return chunk, nil
+}
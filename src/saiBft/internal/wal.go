@@ -0,0 +1,320 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/wal"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDataDir = "data"
+	defaultWALPath = "consensus.wal"
+)
+
+var errBlockAlreadySigned = errors.New("another block was already signed at this height")
+
+// consensus steps of not finished heights, restored from write-ahead log on start
+type consensusWAL struct {
+	mu      sync.Mutex
+	log     *wal.WAL
+	votes   map[string]*models.ConsensusMessage   // votes of the node by height/round
+	blocks  map[int]*models.BlockConsensusMessage // blocks proposed by the node by height
+	counted map[string]int                        // heights of counted votes by height/round/sender
+}
+
+func voteKey(height, round int) string {
+	return strconv.Itoa(height) + "/" + strconv.Itoa(round)
+}
+
+func countedKey(height, round int, sender string) string {
+	return voteKey(height, round) + "/" + sender
+}
+
+// relative path of node file is resolved against data_dir, so it doesn't depend on working dir of the node
+func (s *InternalService) dataPath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	dir, err := filepath.Abs(s.GlobalService.GetConfig("data_dir", defaultDataDir).(string))
+	if err != nil {
+		return "", fmt.Errorf("resolve data_dir : %w", err)
+	}
+	return filepath.Join(dir, path), nil
+}
+
+// open write-ahead log and restore consensus state from it, empty wal_path disables the log
+// remote signer refuses other vote for the round signed before restart, so node without the log can't vote after restart
+func (s *InternalService) openWAL() error {
+	path := s.GlobalService.GetConfig("wal_path", defaultWALPath).(string)
+	if path == "" {
+		if s.isRemoteSigner() {
+			return errors.New("wal_path is required with remote signer")
+		}
+		return nil
+	}
+	path, err := s.dataPath(path)
+	if err != nil {
+		return err
+	}
+	log, entries, err := wal.Open(path)
+	if err != nil {
+		return err
+	}
+	s.wal = &consensusWAL{
+		log:     log,
+		votes:   make(map[string]*models.ConsensusMessage),
+		blocks:  make(map[int]*models.BlockConsensusMessage),
+		counted: make(map[string]int),
+	}
+
+	// consensus messages are restored to the storage, if they were lost (memory storage)
+	restored := make([]*models.ConsensusMessage, 0)
+	for _, entry := range entries {
+		switch entry.Type {
+		case wal.EntryVote, wal.EntryReceived:
+			msg := &models.ConsensusMessage{}
+			err := json.Unmarshal(entry.Data, msg)
+			if err != nil {
+				return fmt.Errorf("wal - unmarshal consensus message : %w", err)
+			}
+			if entry.Type == wal.EntryVote {
+				s.wal.votes[voteKey(msg.BlockNumber, msg.Round)] = msg
+			}
+			restored = append(restored, msg)
+		case wal.EntryBlock:
+			msg := &models.BlockConsensusMessage{}
+			err := json.Unmarshal(entry.Data, msg)
+			if err != nil {
+				return fmt.Errorf("wal - unmarshal block : %w", err)
+			}
+			s.wal.blocks[msg.Block.Number] = msg
+		case wal.EntryCounted:
+			sender := ""
+			err := json.Unmarshal(entry.Data, &sender)
+			if err != nil {
+				return fmt.Errorf("wal - unmarshal counted sender : %w", err)
+			}
+			s.wal.counted[countedKey(entry.Height, entry.Round, sender)] = entry.Height
+		}
+	}
+	err = s.restoreConsensusMsgs(restored)
+	if err != nil {
+		return err
+	}
+
+	s.GlobalService.Logger.Info("wal - opened", zap.String("path", path))
+	s.GlobalService.Logger.Debug("wal - replayed", zap.Int("entries", len(entries)), zap.Int("votes", len(s.wal.votes)), zap.Int("blocks", len(s.wal.blocks))) // DEBUG
+	return nil
+}
+
+// put consensus messages, which are missing in the storage
+func (s *InternalService) restoreConsensusMsgs(msgs []*models.ConsensusMessage) error {
+	stored := make(map[string]map[string]bool)
+	for _, msg := range msgs {
+		key := voteKey(msg.BlockNumber, msg.Round)
+		hashes, ok := stored[key]
+		if !ok {
+			hashes = make(map[string]bool)
+			storedMsgs, err := s.Storage.ConsensusMsgs(msg.BlockNumber, msg.Round)
+			if err != nil {
+				return fmt.Errorf("wal - get consensus messages : %w", err)
+			}
+			for _, m := range storedMsgs {
+				hashes[m.Hash+m.SenderAddress] = true
+			}
+			stored[key] = hashes
+		}
+		if hashes[msg.Hash+msg.SenderAddress] {
+			continue
+		}
+		err := s.Storage.PutConsensusMsg(msg)
+		if err != nil {
+			return fmt.Errorf("wal - restore consensus message : %w", err)
+		}
+		hashes[msg.Hash+msg.SenderAddress] = true
+	}
+	return nil
+}
+
+// round to continue the height after restart, the node already voted in previous rounds
+func (s *InternalService) resumeRound(height int) int {
+	if s.wal == nil {
+		return 0
+	}
+	s.wal.mu.Lock()
+	defer s.wal.mu.Unlock()
+	round := 0
+	for _, vote := range s.wal.votes {
+		if vote.BlockNumber == height && vote.Round > round {
+			round = vote.Round
+		}
+	}
+	if round > maxRoundNumber {
+		round = maxRoundNumber
+	}
+	return round
+}
+
+// sign consensus message of the node, vote is written to the log before it is sent
+// if the node already voted for the height and round, previous vote is returned instead of signing another one
+func (s *InternalService) signVote(msg *models.ConsensusMessage) (*models.ConsensusMessage, error) {
+	if s.wal != nil {
+		s.wal.mu.Lock()
+		vote, ok := s.wal.votes[voteKey(msg.BlockNumber, msg.Round)]
+		s.wal.mu.Unlock()
+		if ok {
+			if vote.Hash != msg.Hash {
+				s.GlobalService.Logger.Warn("wal - already voted at this round, previous vote is used", zap.Int("height", msg.BlockNumber), zap.Int("round", msg.Round))
+			}
+			return vote, nil
+		}
+	}
+
+	signature, err := s.signMsg(msg)
+	if err != nil {
+		return nil, err
+	}
+	msg.Signature = signature
+
+	if s.wal != nil {
+		err = s.wal.log.Append(wal.EntryVote, msg.BlockNumber, msg.Round, msg)
+		if err != nil {
+			return nil, err
+		}
+		s.wal.mu.Lock()
+		s.wal.votes[voteKey(msg.BlockNumber, msg.Round)] = msg
+		s.wal.mu.Unlock()
+	}
+	return msg, nil
+}
+
+// sign block proposed by the node, block is written to the log before it is saved and sent
+// another block for the same height is not signed
+func (s *InternalService) signBlock(msg *models.BlockConsensusMessage) (string, error) {
+	if s.wal != nil {
+		s.wal.mu.Lock()
+		block, ok := s.wal.blocks[msg.Block.Number]
+		s.wal.mu.Unlock()
+		if ok {
+			if block.BlockHash != msg.BlockHash {
+				return "", fmt.Errorf("%w : height %d", errBlockAlreadySigned, msg.Block.Number)
+			}
+			return block.Block.SenderSignature, nil
+		}
+	}
+
+	signature, err := s.signMsg(msg)
+	if err != nil {
+		return "", err
+	}
+
+	if s.wal != nil {
+		signed := *msg
+		block := *msg.Block
+		block.SenderSignature = signature
+		signed.Block = &block
+		err = s.wal.log.Append(wal.EntryBlock, msg.Block.Number, 0, &signed)
+		if err != nil {
+			return "", err
+		}
+		s.wal.mu.Lock()
+		s.wal.blocks[msg.Block.Number] = &signed
+		s.wal.mu.Unlock()
+	}
+	return signature, nil
+}
+
+// block signed by the node at the height on top of the previous block, nil if the node didn't sign it
+// block is logged when it is signed, so it is found after failed saving and after restart
+func (s *InternalService) signedBlock(height int, previousHash string) *models.BlockConsensusMessage {
+	if s.wal == nil {
+		return nil
+	}
+	s.wal.mu.Lock()
+	block, ok := s.wal.blocks[height]
+	s.wal.mu.Unlock()
+	if !ok || block.Block.PreviousBlockHash != previousHash {
+		return nil
+	}
+	signed := *block
+	signedBlock := *block.Block
+	signed.Block = &signedBlock
+	return &signed
+}
+
+// mark votes of consensus message as counted, false if votes of the sender were already counted at the round
+// mark is written before votes are incremented, so resumed round doesn't count the same votes twice
+func (s *InternalService) markVotesCounted(msg *models.ConsensusMessage) bool {
+	if s.wal == nil {
+		return true
+	}
+	key := countedKey(msg.BlockNumber, msg.Round, msg.SenderAddress)
+	s.wal.mu.Lock()
+	defer s.wal.mu.Unlock()
+	if _, ok := s.wal.counted[key]; ok {
+		return false
+	}
+	err := s.wal.log.Append(wal.EntryCounted, msg.BlockNumber, msg.Round, msg.SenderAddress)
+	if err != nil {
+		s.GlobalService.Logger.Error("wal - append counted votes", zap.Error(err))
+	}
+	s.wal.counted[key] = msg.BlockNumber
+	return true
+}
+
+// log consensus message of other node
+func (s *InternalService) walReceived(msg *models.ConsensusMessage) {
+	if s.wal == nil {
+		return
+	}
+	err := s.wal.log.Append(wal.EntryReceived, msg.BlockNumber, msg.Round, msg)
+	if err != nil {
+		s.GlobalService.Logger.Error("wal - append received message", zap.Error(err))
+	}
+}
+
+func (s *InternalService) closeWAL() {
+	if s.wal == nil {
+		return
+	}
+	err := s.wal.log.Close()
+	if err != nil {
+		s.GlobalService.Logger.Error("wal - close", zap.Error(err))
+	}
+}
+
+// forget steps of finished heights
+func (s *InternalService) truncateWAL(height int) {
+	if s.wal == nil {
+		return
+	}
+	err := s.wal.log.Truncate(height)
+	if err != nil {
+		s.GlobalService.Logger.Error("wal - truncate", zap.Error(err))
+		return
+	}
+	s.wal.mu.Lock()
+	defer s.wal.mu.Unlock()
+	for key, vote := range s.wal.votes {
+		if vote.BlockNumber < height {
+			delete(s.wal.votes, key)
+		}
+	}
+	for number := range s.wal.blocks {
+		if number < height {
+			delete(s.wal.blocks, number)
+		}
+	}
+	for key, number := range s.wal.counted {
+		if number < height {
+			delete(s.wal.counted, key)
+		}
+	}
+}
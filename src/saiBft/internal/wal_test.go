@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/transport"
+)
+
+func newWALTestNode(t *testing.T) *InternalService {
+	t.Helper()
+	validators := generateKeys(t, 4)
+	return newTestNode(t, transport.NewLoopbackNetwork(1), nil, validators, map[string]interface{}{
+		"data_dir": t.TempDir(),
+		"wal_path": "consensus.wal",
+	})
+}
+
+func testTx(t *testing.T, s *InternalService, message string) *models.TransactionMessage {
+	t.Helper()
+	tx := &models.Tx{
+		ChainID:       testChainID,
+		SenderAddress: s.validatorAddress(),
+		Message:       message,
+	}
+	hash, err := tx.GetHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.MessageHash = hash
+	msg := &models.TransactionMessage{MessageHash: hash, Tx: tx}
+	err = s.Storage.PutTx(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func testVote(t *testing.T, sender string, height, round int, messages ...string) *models.ConsensusMessage {
+	t.Helper()
+	msg := &models.ConsensusMessage{
+		Type:          models.ConsensusMsgType,
+		ChainID:       testChainID,
+		SenderAddress: sender,
+		BlockNumber:   height,
+		Round:         round,
+		Messages:      messages,
+	}
+	hash, err := msg.GetHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Hash = hash
+	return msg
+}
+
+// block was signed, but it was not saved, next try at the height with other transactions proposes the signed block
+func TestFormBlockAfterFailedSave(t *testing.T) {
+	s := newWALTestNode(t)
+	previous, err := s.createInitialBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txA := testTx(t, s, "a")
+	txB := testTx(t, s, "b")
+
+	signed := &models.BlockConsensusMessage{
+		Type: models.BlockConsensusMsgType,
+		Block: &models.Block{
+			ChainID:           testChainID,
+			Number:            previous.Block.Number,
+			PreviousBlockHash: previous.BlockHash,
+			SenderAddress:     s.validatorAddress(),
+			Messages:          map[string]*models.Tx{txA.MessageHash: txA.Tx},
+		},
+	}
+	signed.BlockHash, err = signed.Block.GetHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.signBlock(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := s.formAndSaveNewBlock(previous, []*models.TransactionMessage{txB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.BlockHash != signed.BlockHash {
+		t.Fatalf("block hash = %s, want signed block %s", block.BlockHash, signed.BlockHash)
+	}
+
+	for _, tt := range []struct {
+		tx        *models.TransactionMessage
+		blockHash string
+	}{
+		{tx: txA, blockHash: signed.BlockHash},
+		{tx: txB, blockHash: ""},
+	} {
+		tx, err := s.Storage.TxByHash(tt.tx.MessageHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.BlockHash != tt.blockHash {
+			t.Errorf("block hash of tx %s = %q, want %q", tx.Tx.Message, tx.BlockHash, tt.blockHash)
+		}
+	}
+}
+
+// votes, blocks and counted votes of not finished height are restored after restart
+func TestWALRestore(t *testing.T) {
+	s := newWALTestNode(t)
+	vote, err := s.signVote(testVote(t, s.validatorAddress(), 1, 2, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := testVote(t, "validator", 1, 2, "a")
+	if !s.markVotesCounted(received) {
+		t.Fatal("votes of the sender were counted before")
+	}
+
+	s.closeWAL()
+	err = s.openWAL()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if round := s.resumeRound(1); round != 2 {
+		t.Errorf("resumed round = %d, want 2", round)
+	}
+	if s.markVotesCounted(received) {
+		t.Error("votes of the sender are counted twice at the round")
+	}
+	other, err := s.signVote(testVote(t, s.validatorAddress(), 1, 2, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Hash != vote.Hash || other.Signature != vote.Signature {
+		t.Errorf("other vote was signed at the round, hash : %s, want %s", other.Hash, vote.Hash)
+	}
+	msgs, err := s.Storage.ConsensusMsgs(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Errorf("restored consensus messages = %d, want 1", len(msgs))
+	}
+
+	// height is finished
+	s.truncateWAL(2)
+	s.closeWAL()
+	err = s.openWAL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round := s.resumeRound(1); round != 0 {
+		t.Errorf("resumed round of finished height = %d, want 0", round)
+	}
+	if !s.markVotesCounted(received) {
+		t.Error("counted votes of finished height are kept")
+	}
+}
@@ -0,0 +1,196 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	version   = 1
+	kdfScrypt = "scrypt"
+	aesGCM    = "aes-256-gcm"
+
+	// scrypt parameters of new keystores, ~64MB of memory for key derivation
+	scryptN      = 1 << 16
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltSize     = 32
+
+	// limits of scrypt parameters read from keystore file, damaged file could require too much memory or time
+	maxScryptMemory = 512 << 20 // 128 * n * r bytes
+	maxScryptP      = 16
+)
+
+var (
+	ErrWrongPassphrase = errors.New("keystore - wrong passphrase")
+)
+
+// File is the encrypted keystore, only private key is encrypted
+// address and public key stay readable to find out whose keys are stored
+type File struct {
+	Version int    `json:"version"`
+	Type    string `json:"type,omitempty"`
+	Address string `json:"address"`
+	Public  string `json:"public"`
+	Crypto  Crypto `json:"crypto"`
+}
+
+type Crypto struct {
+	KDF        string       `json:"kdf"`
+	KDFParams  ScryptParams `json:"kdfparams"`
+	Cipher     string       `json:"cipher"`
+	Nonce      string       `json:"nonce"`
+	Ciphertext string       `json:"ciphertext"`
+}
+
+type ScryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+// IsEncrypted reports whether data is an encrypted keystore, otherwise it is plaintext keys
+func IsEncrypted(data []byte) bool {
+	file := File{}
+	err := json.Unmarshal(data, &file)
+	return err == nil && file.Crypto.Ciphertext != ""
+}
+
+// Encrypt encrypts private key by the key derived from passphrase
+func Encrypt(keys *models.BtcKeys, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, fmt.Errorf("generate salt : %w", err)
+	}
+
+	file := &File{
+		Version: version,
+		Type:    keys.Type,
+		Address: keys.Address,
+		Public:  keys.Public,
+		Crypto: Crypto{
+			KDF: kdfScrypt,
+			KDFParams: ScryptParams{
+				N:    scryptN,
+				R:    scryptR,
+				P:    scryptP,
+				Salt: hex.EncodeToString(salt),
+			},
+			Cipher: aesGCM,
+		},
+	}
+
+	aead, err := file.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("generate nonce : %w", err)
+	}
+
+	file.Crypto.Nonce = hex.EncodeToString(nonce)
+	file.Crypto.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, []byte(keys.Private), file.additionalData()))
+
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// Decrypt decrypts keystore data, returns ErrWrongPassphrase if passphrase does not fit
+func Decrypt(data []byte, passphrase []byte) (*models.BtcKeys, error) {
+	file := &File{}
+	err := json.Unmarshal(data, file)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal keystore : %w", err)
+	}
+	if file.Version != version {
+		return nil, fmt.Errorf("unsupported keystore version : %d", file.Version)
+	}
+
+	aead, err := file.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hex.DecodeString(file.Crypto.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, errors.New("keystore - wrong nonce")
+	}
+	ciphertext, err := hex.DecodeString(file.Crypto.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("decode ciphertext : %w", err)
+	}
+
+	private, err := aead.Open(nil, nonce, ciphertext, file.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return &models.BtcKeys{
+		Type:    file.Type,
+		Private: string(private),
+		Public:  file.Public,
+		Address: file.Address,
+	}, nil
+}
+
+// cipher with the key derived from passphrase
+func (f *File) aead(passphrase []byte) (cipher.AEAD, error) {
+	if f.Crypto.KDF != kdfScrypt {
+		return nil, fmt.Errorf("unsupported keystore kdf : %s", f.Crypto.KDF)
+	}
+	if f.Crypto.Cipher != aesGCM {
+		return nil, fmt.Errorf("unsupported keystore cipher : %s", f.Crypto.Cipher)
+	}
+
+	params := f.Crypto.KDFParams
+	err := params.validate()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("decode salt : %w", err)
+	}
+
+	key, err := scrypt.Key(passphrase, salt, params.N, params.R, params.P, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("derive key : %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p ScryptParams) validate() error {
+	if p.N < 2 || p.N&(p.N-1) != 0 {
+		return fmt.Errorf("keystore - wrong scrypt n : %d", p.N)
+	}
+	if p.R < 1 || p.P < 1 || p.P > maxScryptP {
+		return fmt.Errorf("keystore - wrong scrypt r : %d, p : %d", p.R, p.P)
+	}
+	if p.N > maxScryptMemory/128/p.R {
+		return fmt.Errorf("keystore - scrypt n : %d, r : %d require more than %d bytes", p.N, p.R, maxScryptMemory)
+	}
+	return nil
+}
+
+// public part of keystore is authenticated, so it can not be replaced
+func (f *File) additionalData() []byte {
+	return []byte(f.Type + "|" + f.Address + "|" + f.Public)
+}
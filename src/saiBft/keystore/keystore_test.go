@@ -0,0 +1,152 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+var testKeys = &models.BtcKeys{
+	Type:    "ed25519",
+	Private: "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+	Public:  "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+	Address: "ed25519-test-address",
+}
+
+var testPassphrase = []byte("correct horse battery staple")
+
+func encryptTestKeys(t *testing.T) []byte {
+	t.Helper()
+	data, err := Encrypt(testKeys, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// change keystore file and encode it back
+func changeFile(t *testing.T, data []byte, change func(file *File)) []byte {
+	t.Helper()
+	file := &File{}
+	err := json.Unmarshal(data, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(file)
+	changed, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changed
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	data := encryptTestKeys(t)
+	if !IsEncrypted(data) {
+		t.Fatal("encrypted keystore is not recognized")
+	}
+	plain, err := json.Marshal(testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsEncrypted(plain) {
+		t.Fatal("plaintext keys are recognized as keystore")
+	}
+
+	keys, err := Decrypt(data, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, testKeys) {
+		t.Errorf("decrypted keys = %+v, want %+v", keys, testKeys)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	data := encryptTestKeys(t)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase []byte
+		wantErr    error
+	}{
+		{
+			name:       "wrong passphrase",
+			data:       data,
+			passphrase: []byte("wrong"),
+			wantErr:    ErrWrongPassphrase,
+		},
+		{
+			name: "tampered ciphertext",
+			data: changeFile(t, data, func(file *File) {
+				ciphertext := []byte(file.Crypto.Ciphertext)
+				if ciphertext[0] == 'a' {
+					ciphertext[0] = 'b'
+				} else {
+					ciphertext[0] = 'a'
+				}
+				file.Crypto.Ciphertext = string(ciphertext)
+			}),
+			passphrase: testPassphrase,
+			wantErr:    ErrWrongPassphrase,
+		},
+		{
+			name: "replaced address",
+			data: changeFile(t, data, func(file *File) {
+				file.Address = "other-address"
+			}),
+			passphrase: testPassphrase,
+			wantErr:    ErrWrongPassphrase,
+		},
+		{
+			name: "scrypt n is not power of two",
+			data: changeFile(t, data, func(file *File) {
+				file.Crypto.KDFParams.N = 3
+			}),
+			passphrase: testPassphrase,
+		},
+		{
+			name: "scrypt requires too much memory",
+			data: changeFile(t, data, func(file *File) {
+				file.Crypto.KDFParams.N = 1 << 30
+			}),
+			passphrase: testPassphrase,
+		},
+		{
+			name: "huge scrypt r",
+			data: changeFile(t, data, func(file *File) {
+				file.Crypto.KDFParams.R = 1 << 30
+			}),
+			passphrase: testPassphrase,
+		},
+		{
+			name: "huge scrypt p",
+			data: changeFile(t, data, func(file *File) {
+				file.Crypto.KDFParams.P = 1 << 20
+			}),
+			passphrase: testPassphrase,
+		},
+		{
+			name: "unsupported version",
+			data: changeFile(t, data, func(file *File) {
+				file.Version = version + 1
+			}),
+			passphrase: testPassphrase,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := Decrypt(tt.data, tt.passphrase)
+			if err == nil {
+				t.Fatalf("keys were decrypted : %+v", keys)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Passphrase reads passphrase from env variable, then from file, then asks it interactively
+// empty envName or path skips the source
+func Passphrase(envName, path, prompt string) ([]byte, error) {
+	if envName != "" {
+		if value, ok := os.LookupEnv(envName); ok && value != "" {
+			return []byte(value), nil
+		}
+	}
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase file : %w", err)
+		}
+		passphrase := bytes.TrimRight(data, "\r\n")
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("passphrase file %s is empty", path)
+		}
+		return passphrase, nil
+	}
+
+	return Prompt(prompt)
+}
+
+// Prompt asks passphrase at terminal without echo
+func Prompt(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("keystore passphrase is not provided and stdin is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase : %w", err)
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty keystore passphrase")
+	}
+	return passphrase, nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/iamthe1whoknocks/bft/internal"
 	"github.com/iamthe1whoknocks/saiService"
 )
@@ -12,6 +14,18 @@ func main() {
 
 	svc.RegisterConfig("config.yml")
 
+	// bft signer - run remote signer instead of node
+	if len(os.Args) > 1 && os.Args[1] == "signer" {
+		internal.ServeSigner(svc)
+		return
+	}
+
+	// bft replay <file> [session] - replay recorded consensus traffic on in-memory node
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		internal.Replay(svc, os.Args[2:])
+		return
+	}
+
 	internal.Service.GlobalService.RegisterHandlers(internal.Service.Handler)
 
 	internal.Init(svc)
@@ -19,9 +33,13 @@ func main() {
 	internal.Service.GlobalService.RegisterInitTask(internal.Service.Init)
 
 	internal.Service.GlobalService.RegisterTasks([]func(){
+		internal.Service.StartTransport,
 		internal.Service.Process,
 	})
 
+	// node is stopped after http, ws and socket servers of saiService on SIGINT, SIGTERM
+	internal.Service.GlobalService.RegisterShutdownTask(internal.Service.Shutdown)
+
 	internal.Service.GlobalService.Start()
 
 }
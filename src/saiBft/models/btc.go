@@ -1,9 +1,18 @@
 package models
 
-import valid "github.com/asaskevich/govalidator"
+import (
+	"fmt"
 
-// btc keys got from saiBTC
+	valid "github.com/asaskevich/govalidator"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "[REDACTED]"
+
+// node keys, btc ones are got from saiBTC or generated natively
+// empty type means btc keys
 type BtcKeys struct {
+	Type    string `json:"Type,omitempty"`
 	Private string `json:"Private" valid:",required"`
 	Public  string `json:"Public" valid:",required"`
 	Address string `json:"Address" valid:",required"`
@@ -15,6 +24,23 @@ func (m *BtcKeys) Validate() error {
 	return err
 }
 
+// keys are printed without private key, so it never gets to logs
+func (m BtcKeys) String() string {
+	return fmt.Sprintf("{Type:%s Private:%s Public:%s Address:%s}", m.Type, redacted, m.Public, m.Address)
+}
+
+func (m BtcKeys) GoString() string {
+	return m.String()
+}
+
+func (m BtcKeys) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("type", m.Type)
+	enc.AddString("private", redacted)
+	enc.AddString("public", m.Public)
+	enc.AddString("address", m.Address)
+	return nil
+}
+
 // validate signature response from saiBTC
 type ValidateSignatureResponse struct {
 	Address   string `json:"address"`
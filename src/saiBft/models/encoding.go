@@ -0,0 +1,149 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+)
+
+// EncodingVersion is the first byte of canonical encoding of hashed and signed messages
+// encoding (version 2) :
+// version byte, type tag byte, chain id, then fields in fixed order
+// string - uvarint length and utf-8 bytes, int - 8 bytes big endian, list - uvarint count and items
+// block transactions are sorted by message hash
+// hash is hex encoded sha256 of the encoding, signature signs domain tag, chain id and the hex hash (see SignPayload)
+// test vectors are in docs/encoding.md
+const EncodingVersion byte = 2
+
+// type tags of canonical encoding
+const (
+	encodingTagTx byte = iota + 1
+	encodingTagConsensus
+	encodingTagBlock
+	encodingTagBlockSignature
+	encodingTagSnapshotManifest
+	encodingTagKeyRotation
+)
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func newEncoder(tag byte, chainID string) *encoder {
+	e := &encoder{}
+	e.buf.WriteByte(EncodingVersion)
+	e.buf.WriteByte(tag)
+	e.string(chainID)
+	return e
+}
+
+func (e *encoder) string(s string) {
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(s)))
+	e.buf.Write(length[:n])
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) int(i int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(int64(i)))
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) count(n int) {
+	var length [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(length[:], uint64(n))
+	e.buf.Write(length[:l])
+}
+
+func (e *encoder) strings(list []string) {
+	e.count(len(list))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+func (e *encoder) bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// hex encoded sha256 of canonical encoding
+func hashEncoding(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Encode returns canonical encoding of tx : sender address, message
+func (m *Tx) Encode() []byte {
+	e := newEncoder(encodingTagTx, m.ChainID)
+	e.string(m.SenderAddress)
+	e.string(m.Message)
+	return e.bytes()
+}
+
+// Encode returns canonical encoding of consensus message : sender address, block number, round, messages
+func (m *ConsensusMessage) Encode() []byte {
+	e := newEncoder(encodingTagConsensus, m.ChainID)
+	e.string(m.SenderAddress)
+	e.int(m.BlockNumber)
+	e.int(m.Round)
+	e.strings(m.Messages)
+	return e.bytes()
+}
+
+// Encode returns canonical encoding of block : number, previous block hash,
+// transactions sorted by message hash (message hash, sender address, message, sender signature)
+// sender of the block is not encoded, every validator forms the same block
+func (m *Block) Encode() []byte {
+	e := newEncoder(encodingTagBlock, m.ChainID)
+	e.int(m.Number)
+	e.string(m.PreviousBlockHash)
+
+	hashes := make([]string, 0, len(m.Messages))
+	for hash := range m.Messages {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	e.count(len(hashes))
+	for _, hash := range hashes {
+		tx := m.Messages[hash]
+		if tx == nil {
+			tx = &Tx{}
+		}
+		e.string(hash)
+		e.string(tx.SenderAddress)
+		e.string(tx.Message)
+		e.string(tx.SenderSignature)
+	}
+	return e.bytes()
+}
+
+// encoding of block, which is signed by block sender : block hash, sender address
+func (m *Block) encodeSigned() []byte {
+	e := newEncoder(encodingTagBlockSignature, m.ChainID)
+	e.string(hashEncoding(m.Encode()))
+	e.string(m.SenderAddress)
+	return e.bytes()
+}
+
+// Encode returns canonical encoding of snapshot manifest : height, block hash, chunk hashes, state hash
+func (m *SnapshotManifest) Encode() []byte {
+	e := newEncoder(encodingTagSnapshotManifest, m.ChainID)
+	e.int(m.Height)
+	e.string(m.BlockHash)
+	e.strings(m.ChunkHashes)
+	e.string(m.StateHash)
+	return e.bytes()
+}
+
+// Encode returns canonical encoding of key rotation : validator, new address, height
+func (m *KeyRotation) Encode() []byte {
+	e := newEncoder(encodingTagKeyRotation, m.ChainID)
+	e.string(m.Validator)
+	e.string(m.NewAddress)
+	e.int(m.Height)
+	return e.bytes()
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// test vectors of docs/encoding.md, clients of other languages are checked against them
+// if a vector changes, encoding is incompatible with existing hashes and signatures and needs a new version byte
+const (
+	vectorSeed    = "0101010101010101010101010101010101010101010101010101010101010101"
+	vectorAddress = "ed25519:8a88e3dd7409f195fd52db2d3cba5d72ca6709bf1d94121bf3748801b40f6f5c"
+	vectorChainID = "bft-devnet"
+)
+
+func vectorTx() *Tx {
+	return &Tx{
+		ChainID:         vectorChainID,
+		SenderAddress:   vectorAddress,
+		Message:         `{"method":"transfer","params":["a","b","10"]}`,
+		MessageHash:     "da038bf3bf556ae34ee6208a597971c1fdac9e9e50b461d4b82b8cb8553c7f42",
+		SenderSignature: "Tbd7vIBj3oXShbhVzOpQiEQKDl0E3D/TsGW6hoyByvv0gQM8Wzz/dqMMUVGvBt1Z2KaXD8JNwKLAvhlu3rsIAw==",
+	}
+}
+
+func vectorConsensusMsg() *ConsensusMessage {
+	return &ConsensusMessage{
+		ChainID:       vectorChainID,
+		SenderAddress: vectorAddress,
+		BlockNumber:   2,
+		Round:         1,
+		Messages:      []string{"da038bf3bf556ae34ee6208a597971c1fdac9e9e50b461d4b82b8cb8553c7f42"},
+	}
+}
+
+func TestEncodingVectors(t *testing.T) {
+	seed, err := hex.DecodeString(vectorSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	if address := "ed25519:" + hex.EncodeToString(key.Public().(ed25519.PublicKey)); address != vectorAddress {
+		t.Fatalf("address = %s, want %s", address, vectorAddress)
+	}
+
+	block := &Block{
+		ChainID:           vectorChainID,
+		Number:            2,
+		PreviousBlockHash: strings.Repeat("0", 64),
+		SenderAddress:     vectorAddress,
+		Messages:          map[string]*Tx{"da038bf3bf556ae34ee6208a597971c1fdac9e9e50b461d4b82b8cb8553c7f42": vectorTx()},
+	}
+	emptyBlock := &Block{
+		ChainID: vectorChainID,
+		Number:  1,
+	}
+
+	tests := []struct {
+		name      string
+		encoding  []byte
+		want      string // hex of encoding
+		hash      string
+		signed    interface{} // message for signed payload, nil if the vector has no signature
+		payload   string
+		signature string
+	}{
+		{
+			name:      "tx",
+			encoding:  vectorTx().Encode(),
+			want:      "02010a6266742d6465766e657448656432353531393a386138386533646437343039663139356664353264623264336362613564373263613637303962663164393431323162663337343838303162343066366635632d7b226d6574686f64223a227472616e73666572222c22706172616d73223a5b2261222c2262222c223130225d7d",
+			hash:      "da038bf3bf556ae34ee6208a597971c1fdac9e9e50b461d4b82b8cb8553c7f42",
+			signed:    vectorTx(),
+			payload:   "bft-tx/bft-devnet/da038bf3bf556ae34ee6208a597971c1fdac9e9e50b461d4b82b8cb8553c7f42",
+			signature: "Tbd7vIBj3oXShbhVzOpQiEQKDl0E3D/TsGW6hoyByvv0gQM8Wzz/dqMMUVGvBt1Z2KaXD8JNwKLAvhlu3rsIAw==",
+		},
+		{
+			name:      "consensus message",
+			encoding:  vectorConsensusMsg().Encode(),
+			want:      "02020a6266742d6465766e657448656432353531393a3861383865336464373430396631393566643532646232643363626135643732636136373039626631643934313231626633373438383031623430663666356300000000000000020000000000000001014064613033386266336266353536616533346565363230386135393739373163316664616339653965353062343631643462383262386362383535336337663432",
+			hash:      "c84ec49e1d9aceab7071dc4e114ffd56c097f56789251d26372d301a6ef541aa",
+			signed:    vectorConsensusMsg(),
+			payload:   "bft-consensus/bft-devnet/c84ec49e1d9aceab7071dc4e114ffd56c097f56789251d26372d301a6ef541aa",
+			signature: "INhepKZF7B5ogkwo1alHXmKr70GCOKvwJijIlAJEBZ/HyNV1tbZs5gV+cRbCqSeFwlr1TJiBcVrP4BE/tIOnBQ==",
+		},
+		{
+			name:      "block",
+			encoding:  block.Encode(),
+			want:      "02030a6266742d6465766e65740000000000000002403030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303001406461303338626633626635353661653334656536323038613539373937316331666461633965396535306234363164346238326238636238353533633766343248656432353531393a386138386533646437343039663139356664353264623264336362613564373263613637303962663164393431323162663337343838303162343066366635632d7b226d6574686f64223a227472616e73666572222c22706172616d73223a5b2261222c2262222c223130225d7d58546264377649426a336f5853686268567a4f70516945514b446c304533442f5473475736686f79427976763067514d38577a7a2f64714d4d555647764274315a324b615844384a4e774b4c4176686c753372734941773d3d",
+			hash:      "99714daa191fb064395573b00941479ee6eb6825c33fb0316af4b1741a7eeefc",
+			signed:    &BlockConsensusMessage{Block: block},
+			payload:   "bft-block/bft-devnet/4eedf5b1b03a546c738b3ae97a8805a99924aaca85f72035614703fe9c3ac272",
+			signature: "TDo2UrIIUbI+8BUJqYNWFR2/2jY7hD+QAZ2xqh6PFGK4AE9hBT6xzKhQCtUi1b7nJ8txNwVXeOfx7b9/vzjZAw==",
+		},
+		{
+			name:     "block signature",
+			encoding: block.encodeSigned(),
+			want:     "02040a6266742d6465766e6574403939373134646161313931666230363433393535373362303039343134373965653665623638323563333366623033313661663462313734316137656565666348656432353531393a38613838653364643734303966313935666435326462326433636261356437326361363730396266316439343132316266333734383830316234306636663563",
+			hash:     "4eedf5b1b03a546c738b3ae97a8805a99924aaca85f72035614703fe9c3ac272",
+		},
+		{
+			name:     "empty block",
+			encoding: emptyBlock.Encode(),
+			want:     "02030a6266742d6465766e657400000000000000010000",
+			hash:     "56b13fddd59469aa8a7fb5fbaf8c5b71ca1eb6e0f31f03db3ae24e1a88c34962",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if encoding := hex.EncodeToString(tt.encoding); encoding != tt.want {
+				t.Errorf("encoding = %s, want %s", encoding, tt.want)
+			}
+			if hash := hashEncoding(tt.encoding); hash != tt.hash {
+				t.Errorf("hash = %s, want %s", hash, tt.hash)
+			}
+			if tt.signed == nil {
+				return
+			}
+			payload, err := SignPayload(tt.signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(payload) != tt.payload {
+				t.Errorf("signed payload = %s, want %s", payload, tt.payload)
+			}
+			if signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)); signature != tt.signature {
+				t.Errorf("signature = %s, want %s", signature, tt.signature)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	valid "github.com/asaskevich/govalidator"
+)
+
+// method of tx message, which rotates validator key
+// tx is sent and signed by the current validator key, params[0] is json encoded KeyRotation
+const KeyRotationMethod = "rotateKey"
+
+// KeyRotation authorises new key of the validator, validator keeps its identity (address from trusted validators)
+type KeyRotation struct {
+	ChainID      string `json:"chain_id" valid:",required"`
+	Validator    string `json:"validator" valid:",required"`
+	NewAddress   string `json:"new_address" valid:",required"`
+	Height       int    `json:"height" valid:",required"`        // new key signs blocks starting from the height
+	NewSignature string `json:"new_signature" valid:",required"` // signature of the new key, proves that key is owned
+	OldAddress   string `json:"old_address,omitempty"`           // key, which authorised rotation, filled when rotation is applied
+	BlockNumber  int    `json:"block_number,omitempty"`          // block, which committed rotation
+}
+
+// Validate key rotation
+func (m *KeyRotation) Validate() error {
+	_, err := valid.ValidateStruct(m)
+	return err
+}
+
+// KeyRotationFromTx returns key rotation from tx message, nil if tx is not a key rotation
+func KeyRotationFromTx(tx *Tx) (*KeyRotation, error) {
+	txMsg := &TxMessage{}
+	err := json.Unmarshal([]byte(tx.Message), txMsg)
+	if err != nil || txMsg.Method != KeyRotationMethod {
+		return nil, nil
+	}
+	if len(txMsg.Params) != 1 {
+		return nil, errors.New("key rotation tx should have exactly one param")
+	}
+
+	rotation := &KeyRotation{}
+	err = json.Unmarshal([]byte(txMsg.Params[0]), rotation)
+	if err != nil {
+		return nil, err
+	}
+	return rotation, rotation.Validate()
+}
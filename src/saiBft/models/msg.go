@@ -1,10 +1,6 @@
 package models
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
-
 	valid "github.com/asaskevich/govalidator"
 )
 
@@ -23,6 +19,7 @@ type P2pMsg struct {
 // Consensus message
 type ConsensusMessage struct {
 	Type          string   `json:"type" valid:",required"`
+	ChainID       string   `json:"chain_id" valid:",required"`
 	SenderAddress string   `json:"sender_address" valid:",required"`
 	BlockNumber   int      `json:"block_number" valid:",required"`
 	Round         int      `json:"round" valid:",required"`
@@ -39,19 +36,7 @@ func (m *ConsensusMessage) Validate() error {
 
 // Hashing consensus message
 func (m *ConsensusMessage) GetHash() (string, error) {
-	b, err := json.Marshal(&ConsensusMessage{
-		Type:          m.Type,
-		SenderAddress: m.SenderAddress,
-		BlockNumber:   m.BlockNumber,
-		Round:         m.Round,
-		Messages:      m.Messages,
-	})
-	if err != nil {
-		return "", err
-	}
-
-	hash := sha256.Sum256(b)
-	return hex.EncodeToString(hash[:]), nil
+	return hashEncoding(m.Encode()), nil
 }
 
 // BlockConsensus message
@@ -65,6 +50,7 @@ type BlockConsensusMessage struct {
 }
 
 type Block struct {
+	ChainID           string         `json:"chain_id" valid:",required"`
 	Number            int            `json:"number" valid:",required"`
 	PreviousBlockHash string         `json:"prev_block_hash" valid:",required"`
 	SenderAddress     string         `json:"sender_address" valid:",required"`
@@ -81,17 +67,7 @@ func (m *BlockConsensusMessage) Validate() error {
 
 // Hashing block  message
 func (m *Block) GetHash() (string, error) {
-	b, err := json.Marshal(&Block{
-		Number:            m.Number,
-		PreviousBlockHash: m.PreviousBlockHash,
-		Messages:          m.Messages,
-	})
-	if err != nil {
-		return "", err
-	}
-
-	hash := sha256.Sum256(b)
-	return hex.EncodeToString(hash[:]), nil
+	return hashEncoding(m.Encode()), nil
 }
 
 // Transaction message
@@ -109,6 +85,7 @@ type TransactionMessage struct {
 // transaction struct
 type Tx struct {
 	Type            string `json:"type" valid:",required"`
+	ChainID         string `json:"chain_id" valid:",required"`
 	SenderAddress   string `json:"sender_address" valid:",required"`
 	Message         string `json:"message" valid:",required"`
 	SenderSignature string `json:"sender_signature" valid:",required"`
@@ -129,16 +106,7 @@ func (m *TransactionMessage) Validate() error {
 
 // Hashing block  message
 func (m *Tx) GetHash() (string, error) {
-	b, err := json.Marshal(&Tx{
-		SenderAddress: m.SenderAddress,
-		Message:       m.Message,
-	})
-	if err != nil {
-		return "", err
-	}
-
-	hash := sha256.Sum256(b)
-	return hex.EncodeToString(hash[:]), nil
+	return hashEncoding(m.Encode()), nil
 }
 
 type GetBlockMsg struct {
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+
+	valid "github.com/asaskevich/govalidator"
+)
+
+// direct request between nodes over saiP2p, response is sent back as separate message with the same request id
+const (
+	RequestMsgType  = "request"
+	ResponseMsgType = "response"
+)
+
+type PeerRequest struct {
+	Type      string          `json:"type" valid:",required"`
+	RequestID string          `json:"request_id" valid:",required"`
+	ReplyTo   string          `json:"reply_to" valid:",required"` // saiP2p address of the requester, response is sent only to it
+	Payload   json.RawMessage `json:"payload" valid:",required"`
+}
+
+// Validate peer request
+func (m *PeerRequest) Validate() error {
+	_, err := valid.ValidateStruct(m)
+	return err
+}
+
+type PeerResponse struct {
+	Type      string          `json:"type" valid:",required"`
+	RequestID string          `json:"request_id" valid:",required"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Error     string          `json:"error,omitempty"` // request was not handled
+}
+
+// Validate peer response
+func (m *PeerResponse) Validate() error {
+	_, err := valid.ValidateStruct(m)
+	return err
+}
@@ -5,10 +5,23 @@ type SaiP2pNode struct {
 	Address string `json:"address"`
 }
 
+const (
+	// request of the last block number of the node, saiP2pProxy keeps heights of connected nodes
+	GetHeightMsgType = "getHeight"
+	// request of blocks of the node
+	GetBlocksMsgType = "getBlocks"
+)
+
 type SyncRequest struct {
-	Number int `json:"block_number"`
+	Type   string `json:"type,omitempty"` // getBlocks, empty in requests to saiP2pProxy
+	Number int    `json:"block_number"`
+	From   int    `json:"from,omitempty"` // if set, only blocks with number >= From are requested
 }
 
 type SyncResponse struct {
 	Addresses []string `json:"addresses"`
 }
+
+type HeightResponse struct {
+	Height int `json:"height"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// domain tags of signed payloads, signature of one message type is not valid for another type
+const (
+	SignDomainTx               = "bft-tx"
+	SignDomainConsensus        = "bft-consensus"
+	SignDomainBlock            = "bft-block"
+	SignDomainSnapshotManifest = "bft-snapshot"
+	SignDomainKeyRotation      = "bft-key-rotation"
+)
+
+// SignPayload returns the part of the message which is signed by the sender :
+// domain tag, chain id and hex encoded hash of canonical encoding of the message (see EncodingVersion), separated by '/'
+// example : bft-tx/bft-devnet/6f0c4414650cd90d68c074344af517e818a2db327a18f1e60efdec59f2245652
+// it must stay the same for signer and verifier, otherwise signatures made by other nodes become invalid
+func SignPayload(msg interface{}) ([]byte, error) {
+	var (
+		domain  string
+		chainID string
+		encoded []byte
+	)
+	switch m := msg.(type) {
+	case *BlockConsensusMessage:
+		domain, chainID, encoded = SignDomainBlock, m.Block.ChainID, m.Block.encodeSigned()
+	case *ConsensusMessage:
+		domain, chainID, encoded = SignDomainConsensus, m.ChainID, m.Encode()
+	case *TransactionMessage:
+		domain, chainID, encoded = SignDomainTx, m.Tx.ChainID, m.Tx.Encode()
+	case *Tx:
+		domain, chainID, encoded = SignDomainTx, m.ChainID, m.Encode()
+	case *SnapshotManifest:
+		domain, chainID, encoded = SignDomainSnapshotManifest, m.ChainID, m.Encode()
+	case *KeyRotation:
+		domain, chainID, encoded = SignDomainKeyRotation, m.ChainID, m.Encode()
+	default:
+		return nil, fmt.Errorf("unknown type of message, incoming type : %+v", reflect.TypeOf(msg))
+	}
+	return []byte(domain + "/" + chainID + "/" + hashEncoding(encoded)), nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	valid "github.com/asaskevich/govalidator"
+)
+
+const (
+	SnapshotMsgType         = "snapshot"
+	GetSnapshotMsgType      = "getSnapshot"
+	GetSnapshotChunkMsgType = "getSnapshotChunk"
+)
+
+// Snapshot manifest, describes application state at certain block height
+type SnapshotManifest struct {
+	Type        string               `json:"type" valid:",required"`
+	ChainID     string               `json:"chain_id" valid:",required"`
+	Height      int                  `json:"height" valid:",required"`
+	BlockHash   string               `json:"block_hash" valid:",required"`
+	ChunkHashes []string             `json:"chunk_hashes" valid:",required"`
+	StateHash   string               `json:"state_hash" valid:",required"`
+	Hash        string               `json:"hash" valid:",required"`
+	Signatures  []*SnapshotSignature `json:"signatures"`
+}
+
+// validator signature of snapshot manifest
+type SnapshotSignature struct {
+	Address   string `json:"address"`
+	Signature string `json:"signature"`
+}
+
+// Validate snapshot manifest
+func (m *SnapshotManifest) Validate() error {
+	_, err := valid.ValidateStruct(m)
+	return err
+}
+
+// Hashing snapshot manifest
+func (m *SnapshotManifest) GetHash() (string, error) {
+	return hashEncoding(m.Encode()), nil
+}
+
+// part of the snapshot state
+type SnapshotChunk struct {
+	Height int    `json:"height"`
+	Index  int    `json:"index"`
+	Hash   string `json:"hash"`
+	Data   []byte `json:"data"`
+}
+
+// Hashing snapshot chunk data
+func (c *SnapshotChunk) GetHash() string {
+	hash := sha256.Sum256(c.Data)
+	return hex.EncodeToString(hash[:])
+}
+
+// get snapshot manifest or chunk from connected node
+// Height = 0 means the latest snapshot
+type SnapshotRequest struct {
+	Type   string `json:"type"`
+	Height int    `json:"height"`
+	Index  int    `json:"index"`
+}
@@ -0,0 +1,43 @@
+package signer
+
+import "sync"
+
+// VerifyItem is a single signature to check in the batch
+type VerifyItem struct {
+	Payload   []byte
+	Address   string
+	Signature string
+}
+
+// VerifyBatch checks signatures concurrently by no more than workers goroutines
+// result errors have the same order as items, nil means the signature is valid
+func VerifyBatch(v Verifier, items []*VerifyItem, workers int) []error {
+	errs := make([]error, len(items))
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	indexes := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				item := items[idx]
+				errs[idx] = v.Verify(item.Payload, item.Address, item.Signature)
+			}
+		}()
+	}
+
+	for idx := range items {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
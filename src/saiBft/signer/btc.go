@@ -0,0 +1,150 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+// prefix of bitcoin signed message, the same is used by saiBTC
+const btcMessageMagic = "Bitcoin Signed Message:\n"
+
+// BtcSigner signs payloads in process as bitcoin signed messages
+// signatures are compatible with saiBTC ones
+type BtcSigner struct {
+	key        *btcec.PrivateKey
+	compressed bool
+	address    string
+}
+
+// NewBtcSigner creates signer from WIF encoded private key
+func NewBtcSigner(privateKey string) (*BtcSigner, error) {
+	wif, err := btcutil.DecodeWIF(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode private key : %w", err)
+	}
+
+	address, err := btcAddress(wif.SerializePubKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &BtcSigner{
+		key:        wif.PrivKey,
+		compressed: wif.CompressPubKey,
+		address:    address,
+	}, nil
+}
+
+func (s *BtcSigner) Address() string {
+	return s.address
+}
+
+func (s *BtcSigner) Sign(payload []byte) (string, error) {
+	hash, err := btcMessageHash(payload)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := ecdsa.SignCompact(s.key, hash, s.compressed)
+	if err != nil {
+		return "", fmt.Errorf("sign message : %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// BtcVerifier recovers public key from signature and compares its address with the sender one
+type BtcVerifier struct{}
+
+func NewBtcVerifier() *BtcVerifier {
+	return &BtcVerifier{}
+}
+
+func (v *BtcVerifier) Verify(payload []byte, address, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("decode signature : %w", err)
+	}
+
+	hash, err := btcMessageHash(payload)
+	if err != nil {
+		return err
+	}
+
+	pubKey, compressed, err := ecdsa.RecoverCompact(sig, hash)
+	if err != nil {
+		return fmt.Errorf("%w : recover public key : %s", ErrInvalidSignature, err)
+	}
+
+	serialized := pubKey.SerializeUncompressed()
+	if compressed {
+		serialized = pubKey.SerializeCompressed()
+	}
+
+	recovered, err := btcAddress(serialized)
+	if err != nil {
+		return err
+	}
+
+	if recovered != address {
+		return fmt.Errorf("%w : signed by %s, expected %s", ErrInvalidSignature, recovered, address)
+	}
+	return nil
+}
+
+// GenerateBtcKeys creates new key pair in the same format as saiBTC does
+func GenerateBtcKeys() (*models.BtcKeys, error) {
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("generate private key : %w", err)
+	}
+
+	wif, err := btcutil.NewWIF(key, &chaincfg.MainNetParams, true)
+	if err != nil {
+		return nil, fmt.Errorf("encode private key : %w", err)
+	}
+
+	address, err := btcAddress(wif.SerializePubKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BtcKeys{
+		Type:    KeyTypeBtc,
+		Private: wif.String(),
+		Public:  hex.EncodeToString(wif.SerializePubKey()),
+		Address: address,
+	}, nil
+}
+
+// double sha256 of magic prefix and payload, both prefixed by varint length
+func btcMessageHash(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := wire.WriteVarString(&buf, 0, btcMessageMagic)
+	if err != nil {
+		return nil, err
+	}
+	err = wire.WriteVarBytes(&buf, 0, payload)
+	if err != nil {
+		return nil, err
+	}
+	return chainhash.DoubleHashB(buf.Bytes()), nil
+}
+
+// P2PKH mainnet address of public key
+func btcAddress(pubKey []byte) (string, error) {
+	address, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(pubKey), &chaincfg.MainNetParams)
+	if err != nil {
+		return "", fmt.Errorf("create address : %w", err)
+	}
+	return address.EncodeAddress(), nil
+}
@@ -0,0 +1,57 @@
+package signer
+
+import (
+	"errors"
+	"testing"
+)
+
+// bitcoin signed message vector of Bitcoin Core signmessagewithprivkey (test/functional/rpc_signmessage.py)
+// signatures are deterministic (RFC 6979), so native signer must produce exactly the same signature
+// address is the mainnet P2PKH address of the key, saiBTC and btcAddress use mainnet addresses
+const (
+	vectorPrivateKey = "cUeKHd5orzT3mz8P9pxyREHfsWtVfgsfDjiZZBcjUBAaGk1BTj7N"
+	vectorAddress    = "19pTScE8LZfwRNasdjXrgFWkVqMRcU99GK"
+	vectorMessage    = "This is just a test message"
+	vectorSignature  = "INbVnW4e6PeRmsv2Qgu8NuopvrVjkcxob+sX8OcZG0SALhWybUjzMLPdAsXI46YZGb0KQTRii+wWIQzRpG/U+S0="
+)
+
+func TestBtcSignerVector(t *testing.T) {
+	signer, err := NewBtcSigner(vectorPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Address() != vectorAddress {
+		t.Errorf("address = %s, want %s", signer.Address(), vectorAddress)
+	}
+	signature, err := signer.Sign([]byte(vectorMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature != vectorSignature {
+		t.Errorf("signature = %s, want %s", signature, vectorSignature)
+	}
+}
+
+func TestBtcVerifierVector(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		address   string
+		signature string
+		wantErr   error
+	}{
+		{name: "valid", message: vectorMessage, address: vectorAddress, signature: vectorSignature},
+		{name: "other message", message: vectorMessage + ".", address: vectorAddress, signature: vectorSignature, wantErr: ErrInvalidSignature},
+		{name: "other address", message: vectorMessage, address: "15ycVNQF21PzUBFuKXgpKdekFxoRkH4LFT", signature: vectorSignature, wantErr: ErrInvalidSignature},
+		{name: "broken signature", message: vectorMessage, address: vectorAddress, signature: "AAAA" + vectorSignature[4:], wantErr: ErrInvalidSignature},
+	}
+	verifier := NewBtcVerifier()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.Verify([]byte(tt.message), tt.address, tt.signature)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
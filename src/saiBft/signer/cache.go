@@ -0,0 +1,77 @@
+package signer
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// CachingVerifier remembers successful verifications, so the same signature
+// (tx from p2p, the same tx at round 0, the same tx inside the block) is checked only once
+// failed verifications are not cached, because error could be caused by unavailable backend
+type CachingVerifier struct {
+	next  Verifier
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List // front is the most recently used key
+}
+
+func NewCachingVerifier(next Verifier, size int) *CachingVerifier {
+	return &CachingVerifier{
+		next:  next,
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (v *CachingVerifier) Verify(payload []byte, address, signature string) error {
+	key := cacheKey(payload, address, signature)
+	if v.contains(key) {
+		return nil
+	}
+
+	err := v.next.Verify(payload, address, signature)
+	if err != nil {
+		return err
+	}
+
+	v.add(key)
+	return nil
+}
+
+func (v *CachingVerifier) contains(key string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	elem, ok := v.items[key]
+	if ok {
+		v.order.MoveToFront(elem)
+	}
+	return ok
+}
+
+func (v *CachingVerifier) add(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if elem, ok := v.items[key]; ok {
+		v.order.MoveToFront(elem)
+		return
+	}
+
+	v.items[key] = v.order.PushFront(key)
+	for v.order.Len() > v.size {
+		oldest := v.order.Back()
+		v.order.Remove(oldest)
+		delete(v.items, oldest.Value.(string))
+	}
+}
+
+// (payload hash, signer, signature)
+func cacheKey(payload []byte, address, signature string) string {
+	hash := sha256.Sum256(payload)
+	return hex.EncodeToString(hash[:]) + "|" + address + "|" + signature
+}
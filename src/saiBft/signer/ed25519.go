@@ -0,0 +1,103 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+// Ed25519Signer signs raw payloads by ed25519 key
+// address is "ed25519:" + hex encoded public key, private key is hex encoded 32 bytes seed,
+// so signatures can be made by any standard ed25519 library
+type Ed25519Signer struct {
+	key     ed25519.PrivateKey
+	address string
+}
+
+// NewEd25519Signer creates signer from hex encoded seed
+func NewEd25519Signer(privateKey string) (*Ed25519Signer, error) {
+	seed, err := hex.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode private key : %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("wrong private key size : %d, expected : %d", len(seed), ed25519.SeedSize)
+	}
+
+	key := ed25519.NewKeyFromSeed(seed)
+	return &Ed25519Signer{
+		key:     key,
+		address: ed25519Address(key.Public().(ed25519.PublicKey)),
+	}, nil
+}
+
+func (s *Ed25519Signer) Address() string {
+	return s.address
+}
+
+func (s *Ed25519Signer) Sign(payload []byte) (string, error) {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload)), nil
+}
+
+// Ed25519Verifier takes public key from the address
+type Ed25519Verifier struct{}
+
+func NewEd25519Verifier() *Ed25519Verifier {
+	return &Ed25519Verifier{}
+}
+
+func (v *Ed25519Verifier) Verify(payload []byte, address, signature string) error {
+	pubKey, err := ed25519PublicKey(address)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("decode signature : %w", err)
+	}
+
+	if !ed25519.Verify(pubKey, payload, sig) {
+		return fmt.Errorf("%w : address %s", ErrInvalidSignature, address)
+	}
+	return nil
+}
+
+// GenerateEd25519Keys creates new ed25519 key pair
+func GenerateEd25519Keys() (*models.BtcKeys, error) {
+	pubKey, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate ed25519 key : %w", err)
+	}
+
+	return &models.BtcKeys{
+		Type:    KeyTypeEd25519,
+		Private: hex.EncodeToString(key.Seed()),
+		Public:  hex.EncodeToString(pubKey),
+		Address: ed25519Address(pubKey),
+	}, nil
+}
+
+func ed25519Address(pubKey ed25519.PublicKey) string {
+	return ed25519AddressPrefix + hex.EncodeToString(pubKey)
+}
+
+func ed25519PublicKey(address string) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(address, ed25519AddressPrefix) {
+		return nil, fmt.Errorf("not an ed25519 address : %s", address)
+	}
+
+	pubKey, err := hex.DecodeString(strings.TrimPrefix(address, ed25519AddressPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("decode ed25519 address : %w", err)
+	}
+	if len(pubKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("wrong ed25519 public key size : %d", len(pubKey))
+	}
+	return pubKey, nil
+}
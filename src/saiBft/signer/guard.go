@@ -0,0 +1,149 @@
+package signer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// signed steps older than last signed height - guardHistory are forgotten
+const guardHistory = 1000
+
+// DoubleSignGuard remembers signed steps, state is saved to file before signature is returned,
+// so restart of the signer does not allow double signing
+type DoubleSignGuard struct {
+	mu     sync.Mutex
+	path   string
+	signed map[string]*signedStep
+	height int // last signed height
+}
+
+type signedStep struct {
+	Step        *Step  `json:"step"`
+	PayloadHash string `json:"payload_hash"`
+	Signature   string `json:"signature"`
+}
+
+// NewDoubleSignGuard loads signed steps from the file, empty path keeps state in memory only
+func NewDoubleSignGuard(path string) (*DoubleSignGuard, error) {
+	g := &DoubleSignGuard{
+		path:   path,
+		signed: make(map[string]*signedStep),
+	}
+	if path == "" {
+		return g, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return g, nil
+		}
+		return nil, fmt.Errorf("read signer state : %w", err)
+	}
+
+	steps := make([]*signedStep, 0)
+	err = json.Unmarshal(data, &steps)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal signer state : %w", err)
+	}
+	for _, step := range steps {
+		g.signed[stepKey(step.Step)] = step
+		if step.Step.Height > g.height {
+			g.height = step.Step.Height
+		}
+	}
+	return g, nil
+}
+
+// Sign signs payload by sign func if the step was not signed yet
+// the same payload for the same step gets the same signature, different payload is refused
+func (g *DoubleSignGuard) Sign(step *Step, payload []byte, sign func() (string, error)) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	hash := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(hash[:])
+
+	key := stepKey(step)
+	if signed, ok := g.signed[key]; ok {
+		if signed.PayloadHash == payloadHash {
+			return signed.Signature, nil
+		}
+		return "", fmt.Errorf("%w : %s at height %d round %d was already signed", ErrDoubleSign, step.Kind, step.Height, step.Round)
+	}
+	if step.Height < g.height-guardHistory {
+		return "", fmt.Errorf("%w : height %d is too old, last signed height is %d", ErrDoubleSign, step.Height, g.height)
+	}
+
+	signature, err := sign()
+	if err != nil {
+		return "", err
+	}
+
+	g.signed[key] = &signedStep{
+		Step:        step,
+		PayloadHash: payloadHash,
+		Signature:   signature,
+	}
+	if step.Height > g.height {
+		g.height = step.Height
+		g.prune()
+	}
+
+	err = g.save()
+	if err != nil {
+		delete(g.signed, key)
+		return "", err
+	}
+	return signature, nil
+}
+
+func (g *DoubleSignGuard) prune() {
+	for key, signed := range g.signed {
+		if signed.Step.Height < g.height-guardHistory {
+			delete(g.signed, key)
+		}
+	}
+}
+
+func (g *DoubleSignGuard) save() error {
+	if g.path == "" {
+		return nil
+	}
+
+	steps := make([]*signedStep, 0, len(g.signed))
+	for _, signed := range g.signed {
+		steps = append(steps, signed)
+	}
+	data, err := json.Marshal(steps)
+	if err != nil {
+		return fmt.Errorf("marshal signer state : %w", err)
+	}
+
+	tmp := g.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("open signer state : %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write signer state : %w", err)
+	}
+	return os.Rename(tmp, g.path)
+}
+
+func stepKey(step *Step) string {
+	return fmt.Sprintf("%s/%d/%d", step.Kind, step.Height, step.Round)
+}
@@ -0,0 +1,40 @@
+package signer
+
+import "strings"
+
+// key types, type of the key is a part of the address
+// btc addresses have no prefix to stay compatible with existing ones
+const (
+	KeyTypeBtc     = "btc"
+	KeyTypeEd25519 = "ed25519"
+
+	ed25519AddressPrefix = KeyTypeEd25519 + ":"
+)
+
+// KeyType returns type of the key, which the address belongs to
+func KeyType(address string) string {
+	if strings.HasPrefix(address, ed25519AddressPrefix) {
+		return KeyTypeEd25519
+	}
+	return KeyTypeBtc
+}
+
+// KeyTypeVerifier dispatches verification by key type of the signer address
+type KeyTypeVerifier struct {
+	verifiers map[string]Verifier
+}
+
+// NewKeyTypeVerifier creates verifier which checks btc signatures by btcVerifier (native or saiBTC)
+// and ed25519 signatures natively
+func NewKeyTypeVerifier(btcVerifier Verifier) *KeyTypeVerifier {
+	return &KeyTypeVerifier{
+		verifiers: map[string]Verifier{
+			KeyTypeBtc:     btcVerifier,
+			KeyTypeEd25519: NewEd25519Verifier(),
+		},
+	}
+}
+
+func (v *KeyTypeVerifier) Verify(payload []byte, address, signature string) error {
+	return v.verifiers[KeyType(address)].Verify(payload, address, signature)
+}
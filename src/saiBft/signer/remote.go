@@ -0,0 +1,349 @@
+package signer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+// remote signer protocol : json request and response per line
+const (
+	remoteMethodAddress = "address"
+	remoteMethodSign    = "sign"
+
+	remoteTimeout = 10 * time.Second
+)
+
+// sign request has either canonical message of the type or raw payload
+// signer computes payload and step of the message itself, raw payloads of consensus messages and blocks are refused
+type remoteRequest struct {
+	Method  string          `json:"method"`
+	Type    string          `json:"type,omitempty"`
+	Message json.RawMessage `json:"message,omitempty"`
+	Payload []byte          `json:"payload,omitempty"` // base64 in json
+}
+
+type remoteResponse struct {
+	Address   string `json:"address,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+	DoubleSig bool   `json:"double_sign,omitempty"`
+}
+
+// RemoteSigner signs payloads at signer process, node has no access to private key
+// endpoint is unix:///path/to/socket or tcp://host:port, tcp requires mutual tls
+type RemoteSigner struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+
+	signerAddress string
+}
+
+func NewRemoteSigner(endpoint string, tlsConfig *tls.Config) (*RemoteSigner, error) {
+	network, address, err := parseEndpoint(endpoint, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RemoteSigner{
+		network:   network,
+		address:   address,
+		tlsConfig: tlsConfig,
+	}
+
+	resp, err := r.call(&remoteRequest{Method: remoteMethodAddress})
+	if err != nil {
+		return nil, fmt.Errorf("get remote signer address : %w", err)
+	}
+	r.signerAddress = resp.Address
+	return r, nil
+}
+
+func (r *RemoteSigner) Address() string {
+	return r.signerAddress
+}
+
+func (r *RemoteSigner) Sign(payload []byte) (string, error) {
+	resp, err := r.call(&remoteRequest{Method: remoteMethodSign, Payload: payload})
+	if err != nil {
+		return "", err
+	}
+	return resp.Signature, nil
+}
+
+func (r *RemoteSigner) SignMessage(msg interface{}) (string, error) {
+	msgType, err := MessageType(msg)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("marshal %s message : %w", msgType, err)
+	}
+	resp, err := r.call(&remoteRequest{Method: remoteMethodSign, Type: msgType, Message: data})
+	if err != nil {
+		return "", err
+	}
+	return resp.Signature, nil
+}
+
+// send request, broken connection is reopened once
+func (r *RemoteSigner) call(req *remoteRequest) (*remoteResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal remote signer request : %w", err)
+	}
+	data = append(data, '\n')
+
+	var line []byte
+	for attempt := 0; attempt < 2; attempt++ {
+		line, err = r.roundTrip(data)
+		if err == nil {
+			break
+		}
+		r.closeConn()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("remote signer %s : %w", r.address, err)
+	}
+
+	resp := &remoteResponse{}
+	err = json.Unmarshal(line, resp)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal remote signer response : %w", err)
+	}
+	if resp.DoubleSig {
+		// keep message of signer, but wrap ErrDoubleSign
+		return nil, fmt.Errorf("%w%s", ErrDoubleSign, strings.TrimPrefix(resp.Error, ErrDoubleSign.Error()))
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("remote signer : %s", resp.Error)
+	}
+	return resp, nil
+}
+
+func (r *RemoteSigner) roundTrip(data []byte) ([]byte, error) {
+	if r.conn == nil {
+		conn, err := r.dial()
+		if err != nil {
+			return nil, err
+		}
+		r.conn = conn
+		r.reader = bufio.NewReader(conn)
+	}
+
+	err := r.conn.SetDeadline(time.Now().Add(remoteTimeout))
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.conn.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.reader.ReadBytes('\n')
+}
+
+func (r *RemoteSigner) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: remoteTimeout}
+	if r.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, r.network, r.address, r.tlsConfig)
+	}
+	return dialer.Dial(r.network, r.address)
+}
+
+func (r *RemoteSigner) closeConn() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+		r.reader = nil
+	}
+}
+
+// Close closes connection to signer
+func (r *RemoteSigner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeConn()
+	return nil
+}
+
+// Server serves signer to nodes, consensus steps are checked by double sign guard
+type Server struct {
+	signer Signer
+	guard  *DoubleSignGuard
+	logf   func(format string, args ...interface{})
+}
+
+func NewServer(signer Signer, guard *DoubleSignGuard, logf func(format string, args ...interface{})) *Server {
+	return &Server{
+		signer: signer,
+		guard:  guard,
+		logf:   logf,
+	}
+}
+
+// Serve accepts connections until listener is closed
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	encoder := json.NewEncoder(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		req := &remoteRequest{}
+		err = json.Unmarshal(line, req)
+		resp := &remoteResponse{}
+		if err != nil {
+			resp.Error = fmt.Sprintf("unmarshal request : %s", err)
+		} else {
+			resp = s.process(req)
+		}
+
+		err = encoder.Encode(resp)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) process(req *remoteRequest) *remoteResponse {
+	switch req.Method {
+	case remoteMethodAddress:
+		return &remoteResponse{Address: s.signer.Address()}
+	case remoteMethodSign:
+		signature, err := s.sign(req)
+		if err != nil {
+			s.logf("signer - sign : %s", err)
+			return &remoteResponse{Error: err.Error(), DoubleSig: errors.Is(err, ErrDoubleSign)}
+		}
+		return &remoteResponse{Signature: signature}
+	default:
+		return &remoteResponse{Error: fmt.Sprintf("unknown method : %s", req.Method)}
+	}
+}
+
+// consensus messages and blocks are signed through double sign guard, step is taken from the message
+func (s *Server) sign(req *remoteRequest) (string, error) {
+	if req.Type == "" {
+		if isStepPayload(req.Payload) {
+			return "", ErrStepRequired
+		}
+		return s.signer.Sign(req.Payload)
+	}
+
+	msg, err := decodeMessage(req.Type, req.Message)
+	if err != nil {
+		return "", err
+	}
+	payload, err := models.SignPayload(msg)
+	if err != nil {
+		return "", err
+	}
+	sign := func() (string, error) {
+		return s.signer.Sign(payload)
+	}
+	step := messageStep(msg)
+	if step == nil {
+		return sign()
+	}
+	return s.guard.Sign(step, payload, sign)
+}
+
+// Listen listens on signer endpoint, unix socket is accessible only by owner
+func Listen(endpoint string, tlsConfig *tls.Config) (net.Listener, error) {
+	network, address, err := parseEndpoint(endpoint, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "unix" {
+		os.Remove(address)
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+		err = os.Chmod(address, 0600)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+	return tls.Listen(network, address, tlsConfig)
+}
+
+func parseEndpoint(endpoint string, tlsConfig *tls.Config) (string, string, error) {
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		return "unix", strings.TrimPrefix(endpoint, "unix://"), nil
+	case strings.HasPrefix(endpoint, "tcp://"):
+		if tlsConfig == nil {
+			return "", "", errors.New("tcp remote signer requires tls certificates")
+		}
+		return "tcp", strings.TrimPrefix(endpoint, "tcp://"), nil
+	default:
+		return "", "", fmt.Errorf("wrong remote signer endpoint : %s", endpoint)
+	}
+}
+
+// LoadTLSConfig creates mutual tls config, peer certificate should be signed by ca
+func LoadTLSConfig(certFile, keyFile, caFile string, server bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate : %w", err)
+	}
+
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read tls ca : %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("tls ca has no certificates")
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if server {
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		config.RootCAs = pool
+	}
+	return config, nil
+}
@@ -0,0 +1,59 @@
+package signer
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+func TestServerSign(t *testing.T) {
+	btcSigner, err := NewBtcSigner(vectorPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard, err := NewDoubleSignGuard("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(btcSigner, guard, t.Logf)
+
+	consensusMsg := func(messages ...string) *remoteRequest {
+		data, err := json.Marshal(&models.ConsensusMessage{
+			ChainID:       "bft-test",
+			SenderAddress: vectorAddress,
+			BlockNumber:   2,
+			Round:         1,
+			Messages:      messages,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &remoteRequest{Method: remoteMethodSign, Type: MessageTypeConsensus, Message: data}
+	}
+	consensusPayload, err := models.SignPayload(&models.ConsensusMessage{ChainID: "bft-test", BlockNumber: 2, Round: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		req     *remoteRequest
+		wantErr error
+	}{
+		{name: "consensus message", req: consensusMsg("a")},
+		{name: "same consensus message again", req: consensusMsg("a")},
+		{name: "other consensus message of the same step", req: consensusMsg("b"), wantErr: ErrDoubleSign},
+		{name: "raw consensus payload", req: &remoteRequest{Method: remoteMethodSign, Payload: consensusPayload}, wantErr: ErrStepRequired},
+		{name: "raw payload", req: &remoteRequest{Method: remoteMethodSign, Payload: []byte(vectorMessage)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := server.sign(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/utils"
+)
+
+// SaiBtcSigner signs payloads at saiBTC service
+// private key is sent with every request, so it should be used only with local saiBTC
+type SaiBtcSigner struct {
+	url  string
+	keys *models.BtcKeys
+}
+
+func NewSaiBtcSigner(url string, keys *models.BtcKeys) *SaiBtcSigner {
+	return &SaiBtcSigner{
+		url:  url,
+		keys: keys,
+	}
+}
+
+func (s *SaiBtcSigner) Address() string {
+	return s.keys.Address
+}
+
+func (s *SaiBtcSigner) Sign(payload []byte) (string, error) {
+	resp, err := utils.SignMessage(payload, s.url, s.keys.Private)
+	if err != nil {
+		return "", err
+	}
+	if resp.Signature == "" {
+		return "", errors.New("saiBTC returned empty signature")
+	}
+	return resp.Signature, nil
+}
+
+// SaiBtcVerifier validates signatures at saiBTC service
+type SaiBtcVerifier struct {
+	url string
+}
+
+func NewSaiBtcVerifier(url string) *SaiBtcVerifier {
+	return &SaiBtcVerifier{
+		url: url,
+	}
+}
+
+func (v *SaiBtcVerifier) Verify(payload []byte, address, signature string) error {
+	err := utils.ValidateSignature(payload, v.url, address, signature)
+	if err != nil {
+		return fmt.Errorf("%w : %s", ErrInvalidSignature, err)
+	}
+	return nil
+}
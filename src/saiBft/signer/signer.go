@@ -0,0 +1,18 @@
+package signer
+
+import "errors"
+
+var (
+	ErrInvalidSignature = errors.New("signer - signature is not valid")
+)
+
+// Signer signs payloads with the node key
+type Signer interface {
+	Address() string                     // address of the node key
+	Sign(payload []byte) (string, error) // base64 encoded signature
+}
+
+// Verifier checks that the payload was signed by the owner of address
+type Verifier interface {
+	Verify(payload []byte, address, signature string) error
+}
@@ -0,0 +1,107 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+// kinds of consensus steps
+const (
+	StepConsensus = "consensus"
+	StepBlock     = "block"
+)
+
+// types of messages signed by MessageSigner
+const (
+	MessageTypeConsensus   = "consensus"
+	MessageTypeBlock       = "block"
+	MessageTypeTx          = "tx"
+	MessageTypeSnapshot    = "snapshot"
+	MessageTypeKeyRotation = "key_rotation"
+)
+
+var (
+	ErrDoubleSign   = errors.New("signer - double signing refused")
+	ErrStepRequired = errors.New("signer - consensus payload without step refused")
+)
+
+// Step identifies consensus step, validator signs only one payload for each step
+type Step struct {
+	Kind   string `json:"kind"`
+	Height int    `json:"height"`
+	Round  int    `json:"round"`
+}
+
+// MessageSigner signs canonical messages, payload and consensus step are computed from the message by signer itself
+// so consensus messages and blocks can't be signed twice for the same step
+type MessageSigner interface {
+	Signer
+	SignMessage(msg interface{}) (string, error)
+}
+
+// MessageType returns type of the message for MessageSigner
+func MessageType(msg interface{}) (string, error) {
+	switch msg.(type) {
+	case *models.ConsensusMessage:
+		return MessageTypeConsensus, nil
+	case *models.BlockConsensusMessage:
+		return MessageTypeBlock, nil
+	case *models.TransactionMessage:
+		return MessageTypeTx, nil
+	case *models.SnapshotManifest:
+		return MessageTypeSnapshot, nil
+	case *models.KeyRotation:
+		return MessageTypeKeyRotation, nil
+	default:
+		return "", fmt.Errorf("unknown type of signed message : %T", msg)
+	}
+}
+
+// decode message of the type, which was sent to signer
+func decodeMessage(msgType string, data []byte) (interface{}, error) {
+	var msg interface{}
+	switch msgType {
+	case MessageTypeConsensus:
+		msg = &models.ConsensusMessage{}
+	case MessageTypeBlock:
+		msg = &models.BlockConsensusMessage{}
+	case MessageTypeTx:
+		msg = &models.TransactionMessage{}
+	case MessageTypeSnapshot:
+		msg = &models.SnapshotManifest{}
+	case MessageTypeKeyRotation:
+		msg = &models.KeyRotation{}
+	default:
+		return nil, fmt.Errorf("unknown type of signed message : %s", msgType)
+	}
+	err := json.Unmarshal(data, msg)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s message : %w", msgType, err)
+	}
+	if block, ok := msg.(*models.BlockConsensusMessage); ok && block.Block == nil {
+		return nil, errors.New("block message without block")
+	}
+	return msg, nil
+}
+
+// messageStep returns consensus step of the message, nil if message is not a consensus step
+func messageStep(msg interface{}) *Step {
+	switch m := msg.(type) {
+	case *models.ConsensusMessage:
+		return &Step{Kind: StepConsensus, Height: m.BlockNumber, Round: m.Round}
+	case *models.BlockConsensusMessage:
+		return &Step{Kind: StepBlock, Height: m.Block.Number}
+	default:
+		return nil
+	}
+}
+
+// consensus messages and blocks can be signed only with step, raw payloads of these domains are refused
+func isStepPayload(payload []byte) bool {
+	return bytes.HasPrefix(payload, []byte(models.SignDomainConsensus+"/")) ||
+		bytes.HasPrefix(payload, []byte(models.SignDomainBlock+"/"))
+}
@@ -0,0 +1,41 @@
+//go:build byzantine
+
+package simulation
+
+import "testing"
+
+// one of 4 validators is faulty, 3 honest validators are enough for the quorum and must agree
+func TestByzantine(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+	}{
+		{name: "equivocate", mode: "equivocate"},
+		{name: "bad parent", mode: "bad_parent"},
+		{name: "phantom votes", mode: "phantom_votes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim, err := New(&Config{Nodes: 4, Seed: 1, Byzantine: map[int]string{3: tt.mode}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sim.Start()
+			t.Cleanup(sim.Stop)
+
+			err = sim.SubmitTx(0, "transfer", "a", "b", "10")
+			if err != nil {
+				t.Fatal(err)
+			}
+			honest := sim.Honest()
+			err = sim.WaitHeight(2, heightTimeout, honest...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = sim.CheckAgreement(honest...)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
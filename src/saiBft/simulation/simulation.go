@@ -0,0 +1,400 @@
+// Package simulation runs several bft nodes in one process
+// nodes use in-memory storage and are connected by loopback network with configurable links
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/internal"
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+	"github.com/iamthe1whoknocks/bft/storage"
+	"github.com/iamthe1whoknocks/bft/transport"
+	"github.com/iamthe1whoknocks/saiService"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRoundSleep = 50 * time.Millisecond
+	defaultChainID    = "bft-simulation"
+	pollInterval      = 20 * time.Millisecond
+	shutdownTimeout   = 10 * time.Second
+)
+
+var ErrTimeout = errors.New("simulation - timeout")
+
+type Config struct {
+	Nodes      int
+	RoundSleep time.Duration // duration of consensus round
+	Seed       int64         // seed of link latency and drops
+	ChainID    string
+	Logger     *zap.Logger // nodes logs are named by node index, logs are discarded if nil
+	// misbehaviour modes of faulty nodes by node index, see byzantine config key
+	// faulty nodes require build with byzantine tag
+	Byzantine map[int]string
+	// native (default) or remote, remote signer of each node is served in the process and requires DataDir
+	Signer string
+	// wal and signer state of nodes are kept in sub dirs of DataDir, wal is disabled if it is empty
+	DataDir string
+}
+
+// Node is one bft node of the simulation
+type Node struct {
+	Address   string
+	Service   *internal.InternalService
+	Storage   *storage.MemoryStore
+	Transport *transport.Loopback
+	Byzantine string       // misbehaviour modes, empty for honest node
+	signer    net.Listener // listener of remote signer, nil for native signer
+	name      string
+	config    map[string]interface{}
+	options   *internal.NodeOptions
+	logger    *zap.Logger
+}
+
+type Simulation struct {
+	Network *transport.LoopbackNetwork
+	Nodes   []*Node
+}
+
+// New creates nodes, all nodes are trusted validators
+func New(config *Config) (*Simulation, error) {
+	if config.Nodes < 1 {
+		return nil, fmt.Errorf("simulation - wrong number of nodes : %d", config.Nodes)
+	}
+	if config.RoundSleep <= 0 {
+		config.RoundSleep = defaultRoundSleep
+	}
+	if config.ChainID == "" {
+		config.ChainID = defaultChainID
+	}
+	if config.Logger == nil {
+		config.Logger = zap.NewNop()
+	}
+	if config.Signer == "" {
+		config.Signer = "native"
+	}
+	if config.Signer == "remote" && config.DataDir == "" {
+		return nil, errors.New("simulation - remote signer requires data dir")
+	}
+
+	keys := make([]*models.BtcKeys, 0, config.Nodes)
+	validators := make([]interface{}, 0, config.Nodes)
+	for i := 0; i < config.Nodes; i++ {
+		k, err := signer.GenerateEd25519Keys()
+		if err != nil {
+			return nil, fmt.Errorf("simulation - generate keys : %w", err)
+		}
+		keys = append(keys, k)
+		validators = append(validators, k.Address)
+	}
+
+	sim := &Simulation{
+		Network: transport.NewLoopbackNetwork(config.Seed),
+	}
+	for i, k := range keys {
+		node := &Node{
+			Address:   k.Address,
+			Storage:   storage.NewMemoryStore(),
+			Byzantine: config.Byzantine[i],
+		}
+		configuration := map[string]interface{}{
+			"chain_id":           config.ChainID,
+			"trusted_validators": validators,
+			"sleep":              int(math.Ceil(config.RoundSleep.Seconds())),
+			"sleep_ms":           int(config.RoundSleep / time.Millisecond),
+			"storage_type":       "memory",
+			"signer":             config.Signer,
+			"byzantine":          node.Byzantine,
+			"byzantine_seed":     int(config.Seed) + i,
+			"wal_path":           "",
+		}
+		opts := &internal.NodeOptions{
+			Storage: node.Storage,
+			Keys:    k,
+			Transport: func(handler transport.Handler) transport.Transport {
+				node.Transport = sim.Network.Join(node.Address, handler)
+				return node.Transport
+			},
+		}
+		if config.DataDir != "" {
+			dir := filepath.Join(config.DataDir, fmt.Sprintf("node-%d", i))
+			err := os.MkdirAll(dir, 0700)
+			if err != nil {
+				sim.closeSigners()
+				return nil, fmt.Errorf("simulation - create data dir : %w", err)
+			}
+			configuration["data_dir"] = dir
+			configuration["wal_path"] = "consensus.wal"
+		}
+		if config.Signer == "remote" {
+			// node gets only the address of the signer, key is kept by the signer
+			endpoint, err := node.serveSigner(k, configuration["data_dir"].(string), config.Logger.Named(fmt.Sprintf("signer-%d", i)))
+			if err != nil {
+				sim.closeSigners()
+				return nil, fmt.Errorf("simulation - serve signer of node %d : %w", i, err)
+			}
+			configuration["remote_signer"] = map[string]interface{}{"address": endpoint}
+			opts.Keys = nil
+		}
+
+		node.name = fmt.Sprintf("bft-%d", i)
+		node.config = configuration
+		node.options = opts
+		node.logger = config.Logger.Named(fmt.Sprintf("node-%d", i))
+		err := node.create()
+		if err != nil {
+			sim.closeSigners()
+			node.closeSigner()
+			return nil, fmt.Errorf("simulation - create node %d : %w", i, err)
+		}
+		sim.Nodes = append(sim.Nodes, node)
+	}
+	return sim, nil
+}
+
+// create service of the node, storage, wal and signer of the node are kept between services
+func (node *Node) create() error {
+	configuration := make(map[string]interface{}, len(node.config))
+	for key, value := range node.config {
+		configuration[key] = value
+	}
+	svc := &saiService.Service{
+		Name:          node.name,
+		Configuration: configuration,
+		Logger:        node.logger,
+	}
+	service, err := internal.NewNode(svc, node.options)
+	if err != nil {
+		return err
+	}
+	node.Service = service
+	return nil
+}
+
+func (node *Node) start() {
+	node.Service.Init()
+	node.Service.StartTransport()
+	go node.Service.Process()
+}
+
+// Start starts message listeners and consensus loops of all nodes
+func (sim *Simulation) Start() {
+	sim.StartNodes(sim.all()...)
+}
+
+// StartNodes starts the nodes by index, other nodes could be started later, e.g. to join the running chain
+func (sim *Simulation) StartNodes(nodes ...int) {
+	for _, i := range nodes {
+		sim.Nodes[i].start()
+	}
+}
+
+// Restart stops the node and starts it again with the same storage, wal and signer, like after crash of node process
+// current step of the node is not finished, so the node continues the height from wal
+func (sim *Simulation) Restart(i int) error {
+	node := sim.Nodes[i]
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	node.Service.Shutdown(ctx)
+
+	err := node.create()
+	if err != nil {
+		return fmt.Errorf("simulation - restart node %d : %w", i, err)
+	}
+	node.start()
+	return nil
+}
+
+// Stop shuts down all nodes and removes them from the network, storage of nodes is kept
+func (sim *Simulation) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, node := range sim.Nodes {
+		node.Service.Stop()
+	}
+	for _, node := range sim.Nodes {
+		node.Service.Shutdown(ctx)
+	}
+	sim.closeSigners()
+}
+
+// run remote signer of the node with double sign guard on unix socket in the dir, endpoint of the signer is returned
+func (node *Node) serveSigner(keys *models.BtcKeys, dir string, logger *zap.Logger) (string, error) {
+	nodeSigner, err := signer.NewEd25519Signer(keys.Private)
+	if err != nil {
+		return "", err
+	}
+	guard, err := signer.NewDoubleSignGuard(filepath.Join(dir, "signer_state.json"))
+	if err != nil {
+		return "", err
+	}
+	endpoint := "unix://" + filepath.Join(dir, "signer.sock")
+	listener, err := signer.Listen(endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	node.signer = listener
+	go signer.NewServer(nodeSigner, guard, logger.Sugar().Errorf).Serve(listener)
+	return endpoint, nil
+}
+
+func (node *Node) closeSigner() {
+	if node.signer != nil {
+		node.signer.Close()
+		node.signer = nil
+	}
+}
+
+func (sim *Simulation) closeSigners() {
+	for _, node := range sim.Nodes {
+		node.closeSigner()
+	}
+}
+
+// SubmitTx sends tx from the node
+func (sim *Simulation) SubmitTx(node int, method string, params ...string) error {
+	return sim.Nodes[node].Service.SendTx(&models.TxMessage{
+		Method: method,
+		Params: params,
+	})
+}
+
+// Chain returns blocks saved by the node, see CheckAgreement for the chain of the node
+func (sim *Simulation) Chain(node int) ([]*models.BlockConsensusMessage, error) {
+	return sim.Nodes[node].Storage.Blocks(1, math.MaxInt32)
+}
+
+// Height returns number of the last block of the node, 0 if there are no blocks
+func (sim *Simulation) Height(node int) (int, error) {
+	block, err := sim.Nodes[node].Storage.LastBlock()
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return block.Block.Number, nil
+}
+
+// WaitHeight waits until listed nodes (all nodes if not listed) reach the height
+func (sim *Simulation) WaitHeight(height int, timeout time.Duration, nodes ...int) error {
+	if len(nodes) == 0 {
+		nodes = sim.all()
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		reached := true
+		for _, i := range nodes {
+			h, err := sim.Height(i)
+			if err != nil {
+				return err
+			}
+			if h < height {
+				reached = false
+				break
+			}
+		}
+		if reached {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w : height %d was not reached in %s", ErrTimeout, height, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// CheckAgreement compares chains of listed nodes (all nodes if not listed)
+// blocks up to the lowest height of the nodes must be the same
+// chain of the node is followed from its last block by previous block hashes, storage keeps block once per saving,
+// so block candidates, which node saved at the same number and replaced by the block of the majority, are not the part of it
+func (sim *Simulation) CheckAgreement(nodes ...int) error {
+	if len(nodes) == 0 {
+		nodes = sim.all()
+	}
+	chains := make([]map[int]string, 0, len(nodes))
+	minHeight := math.MaxInt32
+	for _, i := range nodes {
+		chain, height, err := sim.chain(i)
+		if err != nil {
+			return err
+		}
+		if height < minHeight {
+			minHeight = height
+		}
+		chains = append(chains, chain)
+	}
+
+	for number := 1; number <= minHeight; number++ {
+		expected := chains[0][number]
+		for j, chain := range chains[1:] {
+			if chain[number] != expected {
+				return fmt.Errorf("simulation - nodes %d and %d disagree at block %d : %s != %s",
+					nodes[0], nodes[j+1], number, expected, chain[number])
+			}
+		}
+	}
+	return nil
+}
+
+// block hashes of the node chain by number and the height, up to which the chain is linked
+func (sim *Simulation) chain(node int) (map[int]string, int, error) {
+	blocks, err := sim.Chain(node)
+	if err != nil {
+		return nil, 0, fmt.Errorf("simulation - get chain of node %d : %w", node, err)
+	}
+	byHash := make(map[string]*models.BlockConsensusMessage, len(blocks))
+	for _, b := range blocks {
+		byHash[b.BlockHash] = b
+	}
+	last, err := sim.Nodes[node].Storage.LastBlock()
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return map[int]string{}, 0, nil
+		}
+		return nil, 0, fmt.Errorf("simulation - get last block of node %d : %w", node, err)
+	}
+
+	chain := make(map[int]string)
+	height := last.Block.Number
+	for b := last; b != nil; b = byHash[b.Block.PreviousBlockHash] {
+		if _, ok := chain[b.Block.Number]; ok {
+			return nil, 0, fmt.Errorf("simulation - node %d has loop in the chain at block %d", node, b.Block.Number)
+		}
+		chain[b.Block.Number] = b.BlockHash
+	}
+	// blocks below the gap are not linked to the last block
+	for number := height; number >= 1; number-- {
+		if _, ok := chain[number]; !ok {
+			return nil, 0, fmt.Errorf("simulation - chain of node %d is not linked at block %d", node, number)
+		}
+	}
+	return chain, height, nil
+}
+
+// Honest returns indexes of nodes without misbehaviour
+func (sim *Simulation) Honest() []int {
+	nodes := make([]int, 0, len(sim.Nodes))
+	for i, node := range sim.Nodes {
+		if node.Byzantine == "" {
+			nodes = append(nodes, i)
+		}
+	}
+	return nodes
+}
+
+func (sim *Simulation) all() []int {
+	nodes := make([]int, len(sim.Nodes))
+	for i := range nodes {
+		nodes[i] = i
+	}
+	return nodes
+}
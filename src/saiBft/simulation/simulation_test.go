@@ -0,0 +1,189 @@
+package simulation
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/transport"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const heightTimeout = 60 * time.Second
+
+// start simulation of honest nodes, nodes are stopped when the test ends
+func startSimulation(t *testing.T, nodes int) *Simulation {
+	t.Helper()
+	sim, err := New(&Config{Nodes: nodes, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Start()
+	t.Cleanup(sim.Stop)
+	return sim
+}
+
+func TestAgreement(t *testing.T) {
+	sim := startSimulation(t, 4)
+	err := sim.SubmitTx(0, "transfer", "a", "b", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.WaitHeight(2, heightTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.CheckAgreement()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// one of 4 nodes is separated, 3 of 4 validators are enough for the quorum
+func TestPartition(t *testing.T) {
+	sim := startSimulation(t, 4)
+	sim.Network.Partition([]string{sim.Nodes[3].Address})
+	err := sim.WaitHeight(2, heightTimeout, 0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.CheckAgreement(0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// new node is started after other nodes made several blocks, it syncs missed blocks from all of them
+// node is separated till it is started, so it gets no messages before
+func TestCatchUp(t *testing.T) {
+	sim, err := New(&Config{Nodes: 4, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Network.Partition([]string{sim.Nodes[3].Address})
+	sim.StartNodes(0, 1, 2)
+	t.Cleanup(sim.Stop)
+
+	err = sim.WaitHeight(3, heightTimeout, 0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Network.Heal()
+	sim.StartNodes(3)
+
+	err = sim.WaitHeight(5, heightTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.CheckAgreement()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// block 1 is signed once, so signers with double sign guard don't refuse the first block of the chain
+func TestRemoteSigner(t *testing.T) {
+	sim, err := New(&Config{Nodes: 4, Seed: 1, Signer: "remote", DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Start()
+	t.Cleanup(sim.Stop)
+
+	err = sim.SubmitTx(0, "transfer", "a", "b", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.WaitHeight(2, heightTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.CheckAgreement()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wait until the node sent its first vote at the height
+func waitVote(sim *Simulation, node, height int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		msgs, err := sim.Nodes[node].Storage.ConsensusMsgs(height, 1)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if msg.SenderAddress == sim.Nodes[node].Address {
+				return nil
+			}
+		}
+		time.Sleep(pollInterval)
+	}
+	return fmt.Errorf("%w : node %d didn't vote at height %d", ErrTimeout, node, height)
+}
+
+// node is restarted after it voted at the height, it continues the height from wal
+// signers with double sign guard refuse other votes of the node at the same rounds
+// node waits a second after start, rounds are longer, so the height is not finished by other nodes till then
+func TestRestart(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	sim, err := New(&Config{
+		Nodes:      4,
+		RoundSleep: 400 * time.Millisecond,
+		Seed:       1,
+		Signer:     "remote",
+		DataDir:    t.TempDir(),
+		Logger:     zap.New(core),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Start()
+	t.Cleanup(sim.Stop)
+
+	err = waitVote(sim, 0, 2, heightTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.Restart(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.SubmitTx(0, "transfer", "a", "b", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sim.WaitHeight(3, heightTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.CheckAgreement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs.FilterMessage("process - resume height from wal").Len() == 0 {
+		t.Error("restarted node didn't resume the height from wal")
+	}
+	if refused := logs.FilterMessageSnippet("double signing refused"); refused.Len() != 0 {
+		t.Errorf("signer refused %d signatures : %v", refused.Len(), refused.All()[0].Message)
+	}
+}
+
+func TestDrop(t *testing.T) {
+	sim := startSimulation(t, 4)
+	sim.Network.SetDefaultLink(transport.LinkConfig{
+		Latency:  5 * time.Millisecond,
+		Jitter:   5 * time.Millisecond,
+		DropRate: 0.1,
+	})
+	err := sim.WaitHeight(2, heightTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sim.CheckAgreement()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore is the embedded on-disk Store, node keeps its data in a single bbolt file
+type BoltStore struct {
+	*kvStore
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("create storage directory : %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt storage %s : %w", path, err)
+	}
+
+	return &BoltStore{
+		kvStore: &kvStore{kv: &boltKV{db: db}},
+	}, nil
+}
+
+// boltKV keeps every collection in its own bucket
+type boltKV struct {
+	db *bolt.DB
+}
+
+func (b *boltKV) get(collection, key string) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(collection))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		v := bucket.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		// value is valid only inside transaction
+		value = append([]byte{}, v...)
+		return nil
+	})
+	return value, err
+}
+
+func (b *boltKV) put(collection, key string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(collection))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+func (b *boltKV) nextSequence(collection string) (uint64, error) {
+	var seq uint64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(collection))
+		if err != nil {
+			return err
+		}
+		seq, err = bucket.NextSequence()
+		return err
+	})
+	return seq, err
+}
+
+func (b *boltKV) scan(collection, prefix string, fn func(key string, value []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(collection))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		p := []byte(prefix)
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			err := fn(string(k), append([]byte{}, v...))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltKV) last(collection, prefix string) (string, []byte, error) {
+	var (
+		key   string
+		value []byte
+	)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(collection))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		c := bucket.Cursor()
+		k, v := c.Last()
+		for k != nil && !hasPrefix(string(k), prefix) {
+			k, v = c.Prev()
+		}
+		if k == nil {
+			return ErrNotFound
+		}
+		key = string(k)
+		value = append([]byte{}, v...)
+		return nil
+	})
+	return key, value, err
+}
+
+func (b *boltKV) close() error {
+	return b.db.Close()
+}
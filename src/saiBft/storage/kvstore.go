@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+// errStopScan stops collection scan without error
+var errStopScan = errors.New("stop scan")
+
+// kv is the ordered key-value backend of embedded stores
+// values are json documents, keys are ordered lexicographically inside collection
+type kv interface {
+	get(collection, key string) ([]byte, error) // ErrNotFound if key does not exist
+	put(collection, key string, value []byte) error
+	nextSequence(collection string) (uint64, error)
+	scan(collection, prefix string, fn func(key string, value []byte) error) error // ascending order
+	last(collection, prefix string) (string, []byte, error)                        // ErrNotFound if nothing was found
+	close() error
+}
+
+// kvStore is the Store implementation on top of kv backend
+// documents are stored as json, the same way saiStorage keeps them
+type kvStore struct {
+	mu sync.Mutex // serializes read-modify-write operations
+	kv kv
+}
+
+// fixed width key of the number, keys are ordered as numbers
+// negative numbers are shifted by 2^63, so '-' prefix is followed by digits in the same order as numbers
+func numberKey(n int) string {
+	if n < 0 {
+		return fmt.Sprintf("-%019d", uint64(n)+1<<63)
+	}
+	return fmt.Sprintf("%020d", n)
+}
+
+// key with insertion sequence suffix, so documents with equal prefix are kept like in mongo
+func (s *kvStore) sequenceKey(collection, prefix string) (string, error) {
+	seq, err := s.kv.nextSequence(collection)
+	if err != nil {
+		return "", err
+	}
+	return prefix + "/" + numberKey(int(seq)), nil
+}
+
+func (s *kvStore) putDoc(collection, key string, doc interface{}) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshal %s document : %w", collection, err)
+	}
+	return s.kv.put(collection, key, data)
+}
+
+func (s *kvStore) insertDoc(collection, prefix string, doc interface{}) error {
+	key, err := s.sequenceKey(collection, prefix)
+	if err != nil {
+		return err
+	}
+	return s.putDoc(collection, key, doc)
+}
+
+func (s *kvStore) scanBlocks(collection, prefix string, fn func(key string, block *models.BlockConsensusMessage) error) error {
+	return s.kv.scan(collection, prefix, func(key string, value []byte) error {
+		block := &models.BlockConsensusMessage{}
+		err := json.Unmarshal(value, block)
+		if err != nil {
+			return fmt.Errorf("unmarshal %s document : %w", collection, err)
+		}
+		return fn(key, block)
+	})
+}
+
+func (s *kvStore) scanTxs(fn func(tx *models.TransactionMessage) error) error {
+	return s.kv.scan(MessagesPoolCollection, "", func(key string, value []byte) error {
+		tx := &models.TransactionMessage{}
+		err := json.Unmarshal(value, tx)
+		if err != nil {
+			return fmt.Errorf("unmarshal %s document : %w", MessagesPoolCollection, err)
+		}
+		return fn(tx)
+	})
+}
+
+func (s *kvStore) filterTxs(filter func(tx *models.TransactionMessage) bool) ([]*models.TransactionMessage, error) {
+	txs := make([]*models.TransactionMessage, 0)
+	err := s.scanTxs(func(tx *models.TransactionMessage) error {
+		if filter(tx) {
+			txs = append(txs, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func (s *kvStore) firstBlock(collection, prefix string) (*models.BlockConsensusMessage, error) {
+	var found *models.BlockConsensusMessage
+	err := s.scanBlocks(collection, prefix, func(key string, block *models.BlockConsensusMessage) error {
+		found = block
+		return errStopScan
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+func (s *kvStore) LastBlock() (*models.BlockConsensusMessage, error) {
+	_, value, err := s.kv.last(BlockchainCollection, "")
+	if err != nil {
+		return nil, err
+	}
+	block := &models.BlockConsensusMessage{}
+	err = json.Unmarshal(value, block)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s document : %w", BlockchainCollection, err)
+	}
+	return block, nil
+}
+
+func (s *kvStore) BlockByNumber(number int) (*models.BlockConsensusMessage, error) {
+	return s.firstBlock(BlockchainCollection, numberKey(number)+"/")
+}
+
+func (s *kvStore) Blocks(from, to int) ([]*models.BlockConsensusMessage, error) {
+	blocks := make([]*models.BlockConsensusMessage, 0)
+	err := s.scanBlocks(BlockchainCollection, "", func(key string, block *models.BlockConsensusMessage) error {
+		if block.Block == nil || block.Block.Number < from {
+			return nil
+		}
+		if block.Block.Number > to {
+			return errStopScan
+		}
+		blocks = append(blocks, block)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func (s *kvStore) PutBlock(block *models.BlockConsensusMessage) error {
+	if block.Block == nil {
+		return errors.New("block is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertDoc(BlockchainCollection, numberKey(block.Block.Number), block)
+}
+
+func (s *kvStore) UpdateBlockVotes(number, votes int, signatures []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := make(map[string]*models.BlockConsensusMessage)
+	err := s.scanBlocks(BlockchainCollection, numberKey(number)+"/", func(key string, block *models.BlockConsensusMessage) error {
+		block.Votes = votes
+		block.Signatures = signatures
+		updated[key] = block
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, block := range updated {
+		err = s.putDoc(BlockchainCollection, key, block)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvStore) BlockCandidate(hash string) (*models.BlockConsensusMessage, error) {
+	return s.firstBlock(BlockCandidatesCollection, hash+"/")
+}
+
+func (s *kvStore) PutBlockCandidate(block *models.BlockConsensusMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertDoc(BlockCandidatesCollection, block.BlockHash, block)
+}
+
+func (s *kvStore) TxByHash(hash string) (*models.TransactionMessage, error) {
+	value, err := s.kv.get(MessagesPoolCollection, hash)
+	if err != nil {
+		return nil, err
+	}
+	tx := &models.TransactionMessage{}
+	err = json.Unmarshal(value, tx)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s document : %w", MessagesPoolCollection, err)
+	}
+	return tx, nil
+}
+
+func (s *kvStore) PutTx(tx *models.TransactionMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putDoc(MessagesPoolCollection, tx.MessageHash, tx)
+}
+
+func (s *kvStore) PendingTxs() ([]*models.TransactionMessage, error) {
+	return s.filterTxs(func(tx *models.TransactionMessage) bool {
+		return tx.Votes[0] == 0
+	})
+}
+
+// update tx in place, does nothing if tx does not exist
+func (s *kvStore) updateTx(hash string, fn func(tx *models.TransactionMessage)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.TxByHash(hash)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	fn(tx)
+	return s.putDoc(MessagesPoolCollection, hash, tx)
+}
+
+func (s *kvStore) UpdateTxExecution(tx *models.TransactionMessage) error {
+	return s.updateTx(tx.MessageHash, func(stored *models.TransactionMessage) {
+		stored.Votes = tx.Votes
+		stored.VmProcessed = tx.VmProcessed
+		stored.VmResult = tx.VmResult
+		stored.VmResponse = tx.VmResponse
+	})
+}
+
+// increment vote of the round, tx is created if it does not exist (upsert)
+func (s *kvStore) IncrementVote(hash string, round int) error {
+	if round < 0 || round >= len(models.TransactionMessage{}.Votes) {
+		return fmt.Errorf("wrong round for votes : %d", round)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.TxByHash(hash)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		tx = &models.TransactionMessage{MessageHash: hash}
+	}
+	tx.Votes[round]++
+	return s.putDoc(MessagesPoolCollection, hash, tx)
+}
+
+func (s *kvStore) TxsWithVotes(round, votes int) ([]*models.TransactionMessage, error) {
+	return s.filterTxs(func(tx *models.TransactionMessage) bool {
+		return round >= 0 && round < len(tx.Votes) && tx.Votes[round] >= uint64(votes)
+	})
+}
+
+func (s *kvStore) CommitTx(hash, blockHash string, blockNumber int) error {
+	return s.updateTx(hash, func(tx *models.TransactionMessage) {
+		tx.BlockHash = blockHash
+		tx.BlockNumber = blockNumber
+	})
+}
+
+func (s *kvStore) ResetVotes() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := make([]*models.TransactionMessage, 0)
+	err := s.scanTxs(func(tx *models.TransactionMessage) error {
+		if tx.Votes[0] >= 1 && tx.BlockHash == "" {
+			tx.Votes = [7]uint64{}
+			updated = append(updated, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range updated {
+		err = s.putDoc(MessagesPoolCollection, tx.MessageHash, tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvStore) CommittedTxs(to int) ([]*models.TransactionMessage, error) {
+	return s.filterTxs(func(tx *models.TransactionMessage) bool {
+		return tx.BlockNumber >= 1 && tx.BlockNumber <= to
+	})
+}
+
+func consensusKey(height, round int) string {
+	return numberKey(height) + "/" + numberKey(round)
+}
+
+func (s *kvStore) PutConsensusMsg(msg *models.ConsensusMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertDoc(ConsensusPoolCollection, consensusKey(msg.BlockNumber, msg.Round), msg)
+}
+
+func (s *kvStore) ConsensusMsgs(height, round int) ([]*models.ConsensusMessage, error) {
+	msgs := make([]*models.ConsensusMessage, 0)
+	err := s.kv.scan(ConsensusPoolCollection, consensusKey(height, round)+"/", func(key string, value []byte) error {
+		msg := &models.ConsensusMessage{}
+		err := json.Unmarshal(value, msg)
+		if err != nil {
+			return fmt.Errorf("unmarshal %s document : %w", ConsensusPoolCollection, err)
+		}
+		msgs = append(msgs, msg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (s *kvStore) Snapshot(height int) (*models.SnapshotManifest, error) {
+	var (
+		value []byte
+		err   error
+	)
+	if height == 0 {
+		_, value, err = s.kv.last(SnapshotsCollection, "")
+	} else {
+		value, err = s.kv.get(SnapshotsCollection, numberKey(height))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &models.SnapshotManifest{}
+	err = json.Unmarshal(value, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s document : %w", SnapshotsCollection, err)
+	}
+	return manifest, nil
+}
+
+func (s *kvStore) PutSnapshot(manifest *models.SnapshotManifest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putDoc(SnapshotsCollection, numberKey(manifest.Height), manifest)
+}
+
+func (s *kvStore) UpdateSnapshotSignatures(height int, hash string, signatures []*models.SnapshotSignature) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	manifest, err := s.Snapshot(height)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if manifest.Hash != hash {
+		return nil
+	}
+	manifest.Signatures = signatures
+	return s.putDoc(SnapshotsCollection, numberKey(height), manifest)
+}
+
+func chunkKey(height, index int) string {
+	return numberKey(height) + "/" + numberKey(index)
+}
+
+func (s *kvStore) SnapshotChunk(height, index int) (*models.SnapshotChunk, error) {
+	value, err := s.kv.get(SnapshotChunksCollection, chunkKey(height, index))
+	if err != nil {
+		return nil, err
+	}
+	chunk := &models.SnapshotChunk{}
+	err = json.Unmarshal(value, chunk)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s document : %w", SnapshotChunksCollection, err)
+	}
+	return chunk, nil
+}
+
+func (s *kvStore) PutSnapshotChunk(chunk *models.SnapshotChunk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putDoc(SnapshotChunksCollection, chunkKey(chunk.Height, chunk.Index), chunk)
+}
+
+func (s *kvStore) KeyRotations() ([]*models.KeyRotation, error) {
+	rotations := make([]*models.KeyRotation, 0)
+	err := s.kv.scan(KeyRotationsCollection, "", func(key string, value []byte) error {
+		rotation := &models.KeyRotation{}
+		err := json.Unmarshal(value, rotation)
+		if err != nil {
+			return fmt.Errorf("unmarshal %s document : %w", KeyRotationsCollection, err)
+		}
+		rotations = append(rotations, rotation)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotations, nil
+}
+
+// one rotation of the validator per height, the same rotation applied twice (block resync) is overwritten
+func (s *kvStore) PutKeyRotation(rotation *models.KeyRotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putDoc(KeyRotationsCollection, rotation.Validator+"/"+numberKey(rotation.Height), rotation)
+}
+
+// Close closes the backend
+func (s *kvStore) Close() error {
+	return s.kv.close()
+}
+
+func hasPrefix(key, prefix string) bool {
+	return prefix == "" || strings.HasPrefix(key, prefix)
+}
@@ -0,0 +1,459 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+// embedded stores emulate queries of saiStorage (mongo), expected results follow the mongo query in SaiStorage
+func testStores(t *testing.T) map[string]Store {
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "bft.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"bolt":   bolt,
+	}
+}
+
+func runStores(t *testing.T, test func(t *testing.T, s Store)) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			test(t, s)
+		})
+	}
+}
+
+func block(number int, hash string) *models.BlockConsensusMessage {
+	return &models.BlockConsensusMessage{
+		Type:      models.BlockConsensusMsgType,
+		BlockHash: hash,
+		Block:     &models.Block{Number: number, BlockHash: hash},
+	}
+}
+
+func blockNumbers(blocks []*models.BlockConsensusMessage) []int {
+	numbers := make([]int, 0, len(blocks))
+	for _, b := range blocks {
+		numbers = append(numbers, b.Block.Number)
+	}
+	return numbers
+}
+
+func txHashes(txs []*models.TransactionMessage) []string {
+	hashes := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		hashes = append(hashes, tx.MessageHash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func TestNumberKeyOrder(t *testing.T) {
+	numbers := []int{math.MinInt64, -1000, -11, -10, -2, -1, 0, 1, 2, 9, 10, 11, 100, 1000, math.MaxInt64}
+	for i := 1; i < len(numbers); i++ {
+		a, b := numberKey(numbers[i-1]), numberKey(numbers[i])
+		if a >= b {
+			t.Errorf("numberKey(%d) = %q is not less than numberKey(%d) = %q", numbers[i-1], a, numbers[i], b)
+		}
+		if len(a) != len(b) {
+			t.Errorf("numberKey(%d) = %q and numberKey(%d) = %q have different width", numbers[i-1], a, numbers[i], b)
+		}
+	}
+}
+
+// {block.number: -1} sort, limit 1
+func TestLastBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		numbers []int
+		want    int
+		wantErr error
+	}{
+		{name: "empty", wantErr: ErrNotFound},
+		{name: "one", numbers: []int{1}, want: 1},
+		{name: "by number, not by insertion", numbers: []int{3, 1, 2}, want: 3},
+		{name: "numeric, not lexicographic", numbers: []int{9, 10, 2}, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runStores(t, func(t *testing.T, s Store) {
+				for _, n := range tt.numbers {
+					if err := s.PutBlock(block(n, "h")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got, err := s.LastBlock()
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if err == nil && got.Block.Number != tt.want {
+					t.Errorf("last block = %d, want %d", got.Block.Number, tt.want)
+				}
+			})
+		})
+	}
+}
+
+// {block.number: {$gte: from, $lte: to}}, {block.number: 1} sort
+func TestBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		want     []int
+	}{
+		{name: "all", from: 1, to: 12, want: []int{1, 2, 3, 10, 11, 12}},
+		{name: "range is inclusive", from: 2, to: 10, want: []int{2, 3, 10}},
+		{name: "from > to", from: 5, to: 4, want: []int{}},
+		{name: "after last", from: 13, to: 20, want: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runStores(t, func(t *testing.T, s Store) {
+				for _, n := range []int{12, 3, 1, 11, 2, 10} {
+					if err := s.PutBlock(block(n, "h")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got, err := s.Blocks(tt.from, tt.to)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(blockNumbers(got), tt.want) {
+					t.Errorf("blocks = %v, want %v", blockNumbers(got), tt.want)
+				}
+			})
+		})
+	}
+}
+
+// {block.number: n}, the first inserted document; update changes every block with the number
+func TestBlockByNumberAndVotes(t *testing.T) {
+	runStores(t, func(t *testing.T, s Store) {
+		if _, err := s.BlockByNumber(1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("err = %v, want ErrNotFound", err)
+		}
+		for _, b := range []*models.BlockConsensusMessage{block(1, "a"), block(1, "b"), block(10, "c")} {
+			if err := s.PutBlock(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := s.BlockByNumber(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.BlockHash != "a" {
+			t.Errorf("block hash = %s, want the first inserted block a", got.BlockHash)
+		}
+
+		if err := s.UpdateBlockVotes(1, 3, []string{"s1", "s2", "s3"}); err != nil {
+			t.Fatal(err)
+		}
+		blocks, err := s.Blocks(1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range blocks {
+			wantVotes := 3
+			if b.Block.Number == 10 {
+				wantVotes = 0
+			}
+			if b.Votes != wantVotes {
+				t.Errorf("block %s votes = %d, want %d", b.BlockHash, b.Votes, wantVotes)
+			}
+		}
+	})
+}
+
+// {block_hash: hash}
+func TestBlockCandidate(t *testing.T) {
+	runStores(t, func(t *testing.T, s Store) {
+		if err := s.PutBlockCandidate(block(1, "ab")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.PutBlockCandidate(block(1, "a")); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.BlockCandidate("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.BlockHash != "a" {
+			t.Errorf("block candidate = %s, want a", got.BlockHash)
+		}
+		if _, err := s.BlockCandidate("b"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestTxQueries(t *testing.T) {
+	txs := []*models.TransactionMessage{
+		{MessageHash: "pending"},
+		{MessageHash: "voted", Votes: [7]uint64{2, 1}},
+		{MessageHash: "more", Votes: [7]uint64{3, 4}},
+		{MessageHash: "committed", Votes: [7]uint64{4, 4, 4}, BlockHash: "b1", BlockNumber: 1},
+		{MessageHash: "committed later", Votes: [7]uint64{4}, BlockHash: "b5", BlockNumber: 5},
+	}
+	tests := []struct {
+		name  string
+		query func(s Store) ([]*models.TransactionMessage, error)
+		want  []string
+	}{
+		{
+			// {votes.0: 0}
+			name:  "pending",
+			query: func(s Store) ([]*models.TransactionMessage, error) { return s.PendingTxs() },
+			want:  []string{"pending"},
+		},
+		{
+			// {votes.1: {$gte: 4}}
+			name:  "votes >= x",
+			query: func(s Store) ([]*models.TransactionMessage, error) { return s.TxsWithVotes(1, 4) },
+			want:  []string{"committed", "more"},
+		},
+		{
+			name:  "votes >= 0 matches all",
+			query: func(s Store) ([]*models.TransactionMessage, error) { return s.TxsWithVotes(2, 0) },
+			want:  []string{"committed", "committed later", "more", "pending", "voted"},
+		},
+		{
+			name:  "wrong round",
+			query: func(s Store) ([]*models.TransactionMessage, error) { return s.TxsWithVotes(7, 0) },
+			want:  []string{},
+		},
+		{
+			// {block_number: {$gte: 1, $lte: to}}
+			name:  "committed",
+			query: func(s Store) ([]*models.TransactionMessage, error) { return s.CommittedTxs(4) },
+			want:  []string{"committed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runStores(t, func(t *testing.T, s Store) {
+				for _, tx := range txs {
+					if err := s.PutTx(tx); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got, err := tt.query(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(txHashes(got), tt.want) {
+					t.Errorf("txs = %v, want %v", txHashes(got), tt.want)
+				}
+			})
+		})
+	}
+}
+
+// {$inc: {votes.N: 1}} with upsert
+func TestIncrementVote(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  *models.TransactionMessage
+		rounds  []int
+		want    [7]uint64
+		wantErr bool
+	}{
+		{name: "upsert", rounds: []int{0}, want: [7]uint64{1}},
+		{name: "increment", stored: &models.TransactionMessage{MessageHash: "tx", Votes: [7]uint64{1, 2}}, rounds: []int{1, 1, 6}, want: [7]uint64{1, 4, 0, 0, 0, 0, 1}},
+		{name: "negative round", rounds: []int{-1}, wantErr: true},
+		{name: "round out of votes", rounds: []int{7}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runStores(t, func(t *testing.T, s Store) {
+				if tt.stored != nil {
+					if err := s.PutTx(tt.stored); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for _, round := range tt.rounds {
+					err := s.IncrementVote("tx", round)
+					if (err != nil) != tt.wantErr {
+						t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+					}
+				}
+				if tt.wantErr {
+					return
+				}
+				got, err := s.TxByHash("tx")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Votes != tt.want {
+					t.Errorf("votes = %v, want %v", got.Votes, tt.want)
+				}
+			})
+		})
+	}
+}
+
+func TestTxUpdates(t *testing.T) {
+	runStores(t, func(t *testing.T, s Store) {
+		for _, tx := range []*models.TransactionMessage{
+			{MessageHash: "voted", Votes: [7]uint64{2, 1}},
+			{MessageHash: "committed", Votes: [7]uint64{3}, BlockHash: "b"},
+			{MessageHash: "pending"},
+		} {
+			if err := s.PutTx(tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// {votes.0: {$gte: 1}, block_hash: ""}
+		if err := s.ResetVotes(); err != nil {
+			t.Fatal(err)
+		}
+		for hash, want := range map[string][7]uint64{"voted": {}, "committed": {3}, "pending": {}} {
+			tx, err := s.TxByHash(hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.Votes != want {
+				t.Errorf("%s votes = %v, want %v", hash, tx.Votes, want)
+			}
+		}
+
+		if err := s.CommitTx("voted", "b2", 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpdateTxExecution(&models.TransactionMessage{MessageHash: "voted", Votes: [7]uint64{5}, VmProcessed: true}); err != nil {
+			t.Fatal(err)
+		}
+		tx, err := s.TxByHash("voted")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.BlockHash != "b2" || tx.BlockNumber != 2 || tx.Votes != [7]uint64{5} || !tx.VmProcessed {
+			t.Errorf("updated tx = %+v", tx)
+		}
+
+		// updates of missing txs do nothing, as update without upsert
+		if err := s.CommitTx("missing", "b", 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.TxByHash("missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// {round: round, block_number: height}
+func TestConsensusMsgs(t *testing.T) {
+	runStores(t, func(t *testing.T, s Store) {
+		for _, msg := range []*models.ConsensusMessage{
+			{BlockNumber: 1, Round: 1, Hash: "a"},
+			{BlockNumber: 1, Round: 1, Hash: "b"},
+			{BlockNumber: 1, Round: 10, Hash: "c"},
+			{BlockNumber: 11, Round: 1, Hash: "d"},
+		} {
+			if err := s.PutConsensusMsg(msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		msgs, err := s.ConsensusMsgs(1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes := make([]string, 0)
+		for _, msg := range msgs {
+			hashes = append(hashes, msg.Hash)
+		}
+		if !reflect.DeepEqual(hashes, []string{"a", "b"}) {
+			t.Errorf("consensus messages = %v, want [a b]", hashes)
+		}
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	runStores(t, func(t *testing.T, s Store) {
+		if _, err := s.Snapshot(0); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("err = %v, want ErrNotFound", err)
+		}
+		for _, height := range []int{100, 1000, 200} {
+			if err := s.PutSnapshot(&models.SnapshotManifest{Height: height, Hash: "h"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// {height: -1} sort, limit 1
+		latest, err := s.Snapshot(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latest.Height != 1000 {
+			t.Errorf("latest snapshot = %d, want 1000", latest.Height)
+		}
+
+		// {height: height, hash: hash}
+		signatures := []*models.SnapshotSignature{{Address: "v1", Signature: "s1"}}
+		if err := s.UpdateSnapshotSignatures(200, "other", signatures); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpdateSnapshotSignatures(100, "h", signatures); err != nil {
+			t.Fatal(err)
+		}
+		for height, want := range map[int]int{100: 1, 200: 0} {
+			manifest, err := s.Snapshot(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(manifest.Signatures) != want {
+				t.Errorf("snapshot %d signatures = %d, want %d", height, len(manifest.Signatures), want)
+			}
+		}
+
+		if err := s.PutSnapshotChunk(&models.SnapshotChunk{Height: 100, Index: 1, Data: []byte("data")}); err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := s.SnapshotChunk(100, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(chunk.Data) != "data" {
+			t.Errorf("chunk data = %q", chunk.Data)
+		}
+		if _, err := s.SnapshotChunk(100, 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// {validator: 1, height: 1} sort, upsert by validator and height
+func TestKeyRotations(t *testing.T) {
+	runStores(t, func(t *testing.T, s Store) {
+		for _, rotation := range []*models.KeyRotation{
+			{Validator: "b", Height: 5, NewAddress: "b1"},
+			{Validator: "a", Height: 10, NewAddress: "a2"},
+			{Validator: "a", Height: 9, NewAddress: "a1"},
+			{Validator: "a", Height: 10, NewAddress: "a3"},
+		} {
+			if err := s.PutKeyRotation(rotation); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rotations, err := s.KeyRotations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0)
+		for _, rotation := range rotations {
+			got = append(got, rotation.NewAddress)
+		}
+		if !reflect.DeepEqual(got, []string{"a1", "a3", "b1"}) {
+			t.Errorf("rotations = %v, want [a1 a3 b1]", got)
+		}
+	})
+}
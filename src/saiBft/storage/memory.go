@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore is the in-memory Store for tests and simulations
+// it shares query logic with BoltStore, documents are kept as json like in persistent stores
+type MemoryStore struct {
+	*kvStore
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		kvStore: &kvStore{kv: newMemoryKV()},
+	}
+}
+
+type memoryKV struct {
+	mu          sync.RWMutex
+	collections map[string]map[string][]byte
+	sequences   map[string]uint64
+}
+
+func newMemoryKV() *memoryKV {
+	return &memoryKV{
+		collections: make(map[string]map[string][]byte),
+		sequences:   make(map[string]uint64),
+	}
+}
+
+func (m *memoryKV) get(collection, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, ok := m.collections[collection][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m *memoryKV) put(collection, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.collections[collection]; !ok {
+		m.collections[collection] = make(map[string][]byte)
+	}
+	m.collections[collection][key] = append([]byte{}, value...)
+	return nil
+}
+
+func (m *memoryKV) nextSequence(collection string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sequences[collection]++
+	return m.sequences[collection], nil
+}
+
+// sorted keys of the collection with the prefix
+func (m *memoryKV) keys(collection, prefix string) []string {
+	keys := make([]string, 0)
+	for key := range m.collections[collection] {
+		if hasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *memoryKV) scan(collection, prefix string, fn func(key string, value []byte) error) error {
+	// copy matched documents, so fn is able to write to the store
+	m.mu.RLock()
+	keys := m.keys(collection, prefix)
+	values := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, append([]byte{}, m.collections[collection][key]...))
+	}
+	m.mu.RUnlock()
+
+	for i, key := range keys {
+		err := fn(key, values[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) last(collection, prefix string) (string, []byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := m.keys(collection, prefix)
+	if len(keys) == 0 {
+		return "", nil, ErrNotFound
+	}
+	key := keys[len(keys)-1]
+	return key, append([]byte{}, m.collections[collection][key]...), nil
+}
+
+func (m *memoryKV) close() error {
+	return nil
+}
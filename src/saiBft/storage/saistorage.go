@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SaiStorage is the Store implementation, which works with saiStorage service over http
+type SaiStorage struct {
+	db    utils.Database
+	token string
+}
+
+// requests are cancelled when ctx is done
+func NewSaiStorage(ctx context.Context, url, email, password, token string) *SaiStorage {
+	return &SaiStorage{
+		db:    utils.Storage(url, email, password).WithContext(ctx),
+		token: token,
+	}
+}
+
+// Close does nothing, saiStorage service keeps the data
+func (s *SaiStorage) Close() error {
+	return nil
+}
+
+// get documents from collection and unmarshal them to result
+// returns false if nothing was found
+func (s *SaiStorage) find(collection string, criteria, opts interface{}, result interface{}) (bool, error) {
+	err, response := s.db.Get(collection, criteria, opts, s.token)
+	if err != nil {
+		return false, fmt.Errorf("get from %s : %w", collection, err)
+	}
+
+	// empty get response returns '{}' in storage get method
+	if len(response) == 2 {
+		return false, nil
+	}
+
+	data, err := utils.ExtractResult(response)
+	if err != nil {
+		return false, fmt.Errorf("get from %s - extract result : %w", collection, err)
+	}
+
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return false, fmt.Errorf("get from %s - unmarshal result : %w", collection, err)
+	}
+	return true, nil
+}
+
+func (s *SaiStorage) put(collection string, data interface{}) error {
+	err, _ := s.db.Put(collection, data, s.token)
+	if err != nil {
+		return fmt.Errorf("put to %s : %w", collection, err)
+	}
+	return nil
+}
+
+func (s *SaiStorage) update(collection string, criteria, data interface{}) error {
+	err, _ := s.db.Update(collection, criteria, data, s.token)
+	if err != nil {
+		return fmt.Errorf("update %s : %w", collection, err)
+	}
+	return nil
+}
+
+func (s *SaiStorage) findBlock(collection string, criteria, opts interface{}) (*models.BlockConsensusMessage, error) {
+	blocks := make([]*models.BlockConsensusMessage, 0)
+	found, err := s.find(collection, criteria, opts, &blocks)
+	if err != nil {
+		return nil, err
+	}
+	if !found || len(blocks) == 0 {
+		return nil, ErrNotFound
+	}
+	return blocks[0], nil
+}
+
+func (s *SaiStorage) findTxs(criteria interface{}) ([]*models.TransactionMessage, error) {
+	txs := make([]*models.TransactionMessage, 0)
+	_, err := s.find(MessagesPoolCollection, criteria, bson.M{}, &txs)
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func (s *SaiStorage) LastBlock() (*models.BlockConsensusMessage, error) {
+	opts := options.Find().SetSort(bson.M{"block.number": -1}).SetLimit(1)
+	return s.findBlock(BlockchainCollection, bson.M{}, opts)
+}
+
+func (s *SaiStorage) BlockByNumber(number int) (*models.BlockConsensusMessage, error) {
+	return s.findBlock(BlockchainCollection, bson.M{"block.number": number}, bson.M{})
+}
+
+func (s *SaiStorage) Blocks(from, to int) ([]*models.BlockConsensusMessage, error) {
+	blocks := make([]*models.BlockConsensusMessage, 0)
+	criteria := bson.M{"block.number": bson.M{"$gte": from, "$lte": to}}
+	opts := options.Find().SetSort(bson.M{"block.number": 1})
+	_, err := s.find(BlockchainCollection, criteria, opts, &blocks)
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func (s *SaiStorage) PutBlock(block *models.BlockConsensusMessage) error {
+	return s.put(BlockchainCollection, block)
+}
+
+func (s *SaiStorage) UpdateBlockVotes(number, votes int, signatures []string) error {
+	return s.update(BlockchainCollection, bson.M{"block.number": number}, bson.M{"votes": votes, "voted_signatures": signatures})
+}
+
+func (s *SaiStorage) BlockCandidate(hash string) (*models.BlockConsensusMessage, error) {
+	return s.findBlock(BlockCandidatesCollection, bson.M{"block_hash": hash}, bson.M{})
+}
+
+func (s *SaiStorage) PutBlockCandidate(block *models.BlockConsensusMessage) error {
+	return s.put(BlockCandidatesCollection, block)
+}
+
+func (s *SaiStorage) TxByHash(hash string) (*models.TransactionMessage, error) {
+	txs, err := s.findTxs(bson.M{"message_hash": hash})
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, ErrNotFound
+	}
+	return txs[0], nil
+}
+
+func (s *SaiStorage) PutTx(tx *models.TransactionMessage) error {
+	return s.put(MessagesPoolCollection, tx)
+}
+
+func (s *SaiStorage) PendingTxs() ([]*models.TransactionMessage, error) {
+	return s.findTxs(bson.M{"votes.0": 0})
+}
+
+func (s *SaiStorage) UpdateTxExecution(tx *models.TransactionMessage) error {
+	update := bson.M{"votes": tx.Votes, "vm_processed": tx.VmProcessed, "vm_result": tx.VmResult, "vm_response": tx.VmResponse}
+	return s.update(MessagesPoolCollection, bson.M{"message_hash": tx.MessageHash}, update)
+}
+
+func (s *SaiStorage) IncrementVote(hash string, round int) error {
+	criteria := bson.M{"message_hash": hash}
+	update := bson.M{"$inc": bson.M{"votes." + strconv.Itoa(round): 1}}
+	err, _ := s.db.Upsert(MessagesPoolCollection, criteria, update, s.token)
+	if err != nil {
+		return fmt.Errorf("upsert %s : %w", MessagesPoolCollection, err)
+	}
+	return nil
+}
+
+func (s *SaiStorage) TxsWithVotes(round, votes int) ([]*models.TransactionMessage, error) {
+	return s.findTxs(bson.M{"votes." + strconv.Itoa(round): bson.M{"$gte": votes}})
+}
+
+func (s *SaiStorage) CommitTx(hash, blockHash string, blockNumber int) error {
+	return s.update(MessagesPoolCollection, bson.M{"message_hash": hash}, bson.M{"block_hash": blockHash, "block_number": blockNumber})
+}
+
+func (s *SaiStorage) ResetVotes() error {
+	criteria := bson.M{"votes.0": bson.M{"$gte": 1}, "block_hash": ""}
+	return s.update(MessagesPoolCollection, criteria, bson.M{"votes": bson.A{0, 0, 0, 0, 0, 0, 0}})
+}
+
+func (s *SaiStorage) CommittedTxs(to int) ([]*models.TransactionMessage, error) {
+	return s.findTxs(bson.M{"block_number": bson.M{"$gte": 1, "$lte": to}})
+}
+
+func (s *SaiStorage) PutConsensusMsg(msg *models.ConsensusMessage) error {
+	return s.put(ConsensusPoolCollection, msg)
+}
+
+func (s *SaiStorage) ConsensusMsgs(height, round int) ([]*models.ConsensusMessage, error) {
+	msgs := make([]*models.ConsensusMessage, 0)
+	_, err := s.find(ConsensusPoolCollection, bson.M{"round": round, "block_number": height}, bson.M{}, &msgs)
+	if err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (s *SaiStorage) Snapshot(height int) (*models.SnapshotManifest, error) {
+	var (
+		criteria interface{} = bson.M{"height": height}
+		opts     interface{} = bson.M{}
+	)
+	if height == 0 {
+		criteria = bson.M{}
+		opts = options.Find().SetSort(bson.M{"height": -1}).SetLimit(1)
+	}
+
+	manifests := make([]*models.SnapshotManifest, 0)
+	found, err := s.find(SnapshotsCollection, criteria, opts, &manifests)
+	if err != nil {
+		return nil, err
+	}
+	if !found || len(manifests) == 0 {
+		return nil, ErrNotFound
+	}
+	return manifests[0], nil
+}
+
+func (s *SaiStorage) PutSnapshot(manifest *models.SnapshotManifest) error {
+	return s.put(SnapshotsCollection, manifest)
+}
+
+func (s *SaiStorage) UpdateSnapshotSignatures(height int, hash string, signatures []*models.SnapshotSignature) error {
+	return s.update(SnapshotsCollection, bson.M{"height": height, "hash": hash}, bson.M{"signatures": signatures})
+}
+
+func (s *SaiStorage) SnapshotChunk(height, index int) (*models.SnapshotChunk, error) {
+	chunks := make([]*models.SnapshotChunk, 0)
+	found, err := s.find(SnapshotChunksCollection, bson.M{"height": height, "index": index}, bson.M{}, &chunks)
+	if err != nil {
+		return nil, err
+	}
+	if !found || len(chunks) == 0 {
+		return nil, ErrNotFound
+	}
+	return chunks[0], nil
+}
+
+func (s *SaiStorage) PutSnapshotChunk(chunk *models.SnapshotChunk) error {
+	return s.put(SnapshotChunksCollection, chunk)
+}
+
+func (s *SaiStorage) KeyRotations() ([]*models.KeyRotation, error) {
+	rotations := make([]*models.KeyRotation, 0)
+	opts := options.Find().SetSort(bson.D{{Key: "validator", Value: 1}, {Key: "height", Value: 1}})
+	_, err := s.find(KeyRotationsCollection, bson.M{}, opts, &rotations)
+	if err != nil {
+		return nil, err
+	}
+	return rotations, nil
+}
+
+func (s *SaiStorage) PutKeyRotation(rotation *models.KeyRotation) error {
+	criteria := bson.M{"validator": rotation.Validator, "height": rotation.Height}
+	err, _ := s.db.Upsert(KeyRotationsCollection, criteria, bson.M{"$set": rotation}, s.token)
+	if err != nil {
+		return fmt.Errorf("upsert %s : %w", KeyRotationsCollection, err)
+	}
+	return nil
+}
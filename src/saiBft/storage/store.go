@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+// collection names
+const (
+	BlockchainCollection      = "Blockchain"
+	BlockCandidatesCollection = "BlockCandidates"
+	MessagesPoolCollection    = "MessagesPool"
+	ConsensusPoolCollection   = "ConsensusPool"
+	SnapshotsCollection       = "Snapshots"
+	SnapshotChunksCollection  = "SnapshotChunks"
+	KeyRotationsCollection    = "KeyRotations"
+)
+
+var (
+	// returned by single item getters if nothing was found
+	ErrNotFound = errors.New("storage - not found")
+)
+
+// Store is the storage layer of bft node
+type Store interface {
+	// blocks
+	LastBlock() (*models.BlockConsensusMessage, error)
+	BlockByNumber(number int) (*models.BlockConsensusMessage, error)
+	Blocks(from, to int) ([]*models.BlockConsensusMessage, error) // blocks with from <= number <= to, ordered by number
+	PutBlock(block *models.BlockConsensusMessage) error
+	UpdateBlockVotes(number, votes int, signatures []string) error
+
+	// block candidates
+	BlockCandidate(hash string) (*models.BlockConsensusMessage, error)
+	PutBlockCandidate(block *models.BlockConsensusMessage) error
+
+	// transactions
+	TxByHash(hash string) (*models.TransactionMessage, error)
+	PutTx(tx *models.TransactionMessage) error
+	PendingTxs() ([]*models.TransactionMessage, error) // txs without votes at round 0
+	UpdateTxExecution(tx *models.TransactionMessage) error
+	IncrementVote(hash string, round int) error
+	TxsWithVotes(round, votes int) ([]*models.TransactionMessage, error) // txs with votes[round] >= votes
+	CommitTx(hash, blockHash string, blockNumber int) error
+	ResetVotes() error // clear votes of not committed txs
+	CommittedTxs(to int) ([]*models.TransactionMessage, error)
+
+	// consensus messages
+	PutConsensusMsg(msg *models.ConsensusMessage) error
+	ConsensusMsgs(height, round int) ([]*models.ConsensusMessage, error)
+
+	// snapshots
+	Snapshot(height int) (*models.SnapshotManifest, error) // height = 0 means the latest snapshot
+	PutSnapshot(manifest *models.SnapshotManifest) error
+	UpdateSnapshotSignatures(height int, hash string, signatures []*models.SnapshotSignature) error
+	SnapshotChunk(height, index int) (*models.SnapshotChunk, error)
+	PutSnapshotChunk(chunk *models.SnapshotChunk) error
+
+	// validator key rotations
+	KeyRotations() ([]*models.KeyRotation, error) // ordered by validator and height
+	PutKeyRotation(rotation *models.KeyRotation) error
+
+	// Close releases the storage, it is called on shutdown of the node
+	Close() error
+}
@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// gossip frame : 4 bytes big endian length, json envelope
+const maxFrameSize = 32 << 20
+
+func writeFrame(w io.Writer, env *envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal envelope : %w", err)
+	}
+	if len(data) > maxFrameSize {
+		return fmt.Errorf("frame is too big : %d bytes", len(data))
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+func readFrame(r io.Reader) (*envelope, error) {
+	var header [4]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame is too big : %d bytes", size)
+	}
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &envelope{}
+	err = json.Unmarshal(data, env)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal envelope : %w", err)
+	}
+	return env, nil
+}
@@ -0,0 +1,657 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxPeers       = 32
+	defaultRequestTimeout = 10 * time.Second
+	dialTimeout           = 5 * time.Second
+	handshakeTimeout      = 5 * time.Second
+	writeTimeout          = 10 * time.Second
+	discoveryInterval     = 30 * time.Second
+	seenCacheSize         = 100000
+	peerInboxSize         = 1024
+	maxPeerRequests       = 8 // requests of one peer handled at once, other requests are refused
+)
+
+// kinds of gossip envelopes
+const (
+	kindHello    = "hello"
+	kindGetPeers = "getPeers"
+	kindPeers    = "peers"
+	kindGossip   = "gossip"
+	kindDirect   = "direct"
+	kindRequest  = "request"
+	kindResponse = "response"
+)
+
+type GossipConfig struct {
+	Listen         string   // address to listen for peers, host:port
+	Advertise      string   // address announced to peers, Listen if empty
+	Seeds          []string // nodes to connect on start
+	MaxPeers       int
+	RequestTimeout time.Duration
+}
+
+// Gossip is a tcp transport without saiP2p :
+// broadcast messages are flooded to all connected peers, every node forwards a message only once
+// peers are discovered from seed nodes and from peer lists of connected nodes
+type Gossip struct {
+	config  *GossipConfig
+	handler Handler
+	logger  *zap.Logger
+
+	mu      sync.RWMutex
+	peers   map[string]*gossipPeer // connected peers by advertised address
+	known   map[string]struct{}    // discovered addresses
+	pending map[uint64]*pendingRequest
+	dialing map[string]struct{}
+
+	seen   *seenCache
+	nextID uint64
+
+	listener net.Listener
+	done     chan struct{}
+	closed   int32
+}
+
+// message between gossip nodes
+type envelope struct {
+	Kind    string          `json:"kind"`
+	ID      uint64          `json:"id,omitempty"`      // request id
+	MsgID   string          `json:"msg_id,omitempty"`  // hash of gossip message
+	Address string          `json:"address,omitempty"` // advertised address of the sender (hello)
+	Peers   []string        `json:"peers,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type gossipPeer struct {
+	address  string
+	conn     net.Conn
+	writeMu  sync.Mutex
+	inbox    chan *envelope // messages to the handler, read loop is not blocked by the handler
+	requests chan struct{}  // requests of the peer being handled
+}
+
+// request waiting for response, response is accepted only from the peer, which got the request
+type pendingRequest struct {
+	peer   *gossipPeer
+	respCh chan *envelope
+}
+
+func (p *gossipPeer) send(env *envelope) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	err := p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err != nil {
+		return err
+	}
+	return writeFrame(p.conn, env)
+}
+
+func NewGossip(config *GossipConfig, handler Handler, logger *zap.Logger) *Gossip {
+	if config.Advertise == "" {
+		config.Advertise = config.Listen
+	}
+	if config.MaxPeers <= 0 {
+		config.MaxPeers = defaultMaxPeers
+	}
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = defaultRequestTimeout
+	}
+
+	g := &Gossip{
+		config:  config,
+		handler: handler,
+		logger:  logger,
+		peers:   make(map[string]*gossipPeer),
+		known:   make(map[string]struct{}),
+		pending: make(map[uint64]*pendingRequest),
+		dialing: make(map[string]struct{}),
+		seen:    newSeenCache(seenCacheSize),
+		done:    make(chan struct{}),
+	}
+	for _, seed := range config.Seeds {
+		g.known[seed] = struct{}{}
+	}
+	return g
+}
+
+// Start listens for peers and starts peer discovery
+func (g *Gossip) Start() error {
+	listener, err := net.Listen("tcp", g.config.Listen)
+	if err != nil {
+		return fmt.Errorf("gossip - listen : %w", err)
+	}
+	g.listener = listener
+	g.logger.Info("gossip - started", zap.String("listen", g.config.Listen), zap.String("advertise", g.config.Advertise))
+
+	go g.acceptLoop()
+	go g.discoveryLoop()
+	return nil
+}
+
+// Close closes listener and peer connections
+func (g *Gossip) Close() error {
+	if !atomic.CompareAndSwapInt32(&g.closed, 0, 1) {
+		return nil
+	}
+	close(g.done)
+	if g.listener != nil {
+		g.listener.Close()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, p := range g.peers {
+		p.conn.Close()
+	}
+	return nil
+}
+
+func (g *Gossip) Broadcast(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal msg : %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	env := &envelope{
+		Kind:  kindGossip,
+		MsgID: hex.EncodeToString(hash[:]),
+		Data:  data,
+	}
+	g.seen.add(env.MsgID)
+
+	peers := g.connectedPeers()
+	if len(peers) == 0 {
+		// cli commands broadcast without started transport
+		g.connectSeeds()
+		peers = g.connectedPeers()
+	}
+	if len(peers) == 0 {
+		return ErrNoPeers
+	}
+
+	g.forward(env, "")
+	return nil
+}
+
+func (g *Gossip) SendTo(peer string, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal msg : %w", err)
+	}
+
+	p, err := g.peer(peer)
+	if err != nil {
+		return err
+	}
+	return p.send(&envelope{Kind: kindDirect, Data: data})
+}
+
+func (g *Gossip) Request(peer string, request interface{}) ([]byte, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request : %w", err)
+	}
+
+	p, err := g.peer(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	id := atomic.AddUint64(&g.nextID, 1)
+	respCh := make(chan *envelope, 1)
+	g.mu.Lock()
+	g.pending[id] = &pendingRequest{peer: p, respCh: respCh}
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.pending, id)
+		g.mu.Unlock()
+	}()
+
+	err = p.send(&envelope{Kind: kindRequest, ID: id, Data: data})
+	if err != nil {
+		g.removePeer(p)
+		return nil, err
+	}
+
+	select {
+	case resp := <-respCh:
+		if resp.Error != "" {
+			return nil, fmt.Errorf("peer %s : %s", peer, resp.Error)
+		}
+		return resp.Data, nil
+	case <-time.After(g.config.RequestTimeout):
+		return nil, fmt.Errorf("%w : peer %s", ErrTimeout, peer)
+	}
+}
+
+func (g *Gossip) Peers() ([]string, error) {
+	peers := g.connectedPeers()
+	addresses := make([]string, 0, len(peers))
+	for _, p := range peers {
+		addresses = append(addresses, p.address)
+	}
+	return addresses, nil
+}
+
+// connected peer or new connection to the address
+func (g *Gossip) peer(address string) (*gossipPeer, error) {
+	g.mu.RLock()
+	p, ok := g.peers[address]
+	g.mu.RUnlock()
+	if ok {
+		return p, nil
+	}
+
+	err := g.dial(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s : %s", ErrUnknownPeer, address, err)
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	p, ok = g.peers[address]
+	if !ok {
+		return nil, fmt.Errorf("%w : %s", ErrUnknownPeer, address)
+	}
+	return p, nil
+}
+
+func (g *Gossip) connectedPeers() []*gossipPeer {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	peers := make([]*gossipPeer, 0, len(g.peers))
+	for _, p := range g.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// send gossip message to all peers except the source
+func (g *Gossip) forward(env *envelope, from string) {
+	for _, p := range g.connectedPeers() {
+		if p.address == from {
+			continue
+		}
+		err := p.send(env)
+		if err != nil {
+			g.logger.Error("gossip - forward message", zap.String("peer", p.address), zap.Error(err))
+			g.removePeer(p)
+		}
+	}
+}
+
+func (g *Gossip) acceptLoop() {
+	for {
+		conn, err := g.listener.Accept()
+		if err != nil {
+			select {
+			case <-g.done:
+				return
+			default:
+			}
+			g.logger.Error("gossip - accept", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		go g.accept(conn)
+	}
+}
+
+// inbound connection : read hello of the peer, answer with own hello
+func (g *Gossip) accept(conn net.Conn) {
+	hello, err := g.handshake(conn, false)
+	if err != nil {
+		g.logger.Debug("gossip - inbound handshake", zap.String("remote", conn.RemoteAddr().String()), zap.Error(err))
+		conn.Close()
+		return
+	}
+
+	// advertised address is trusted only if it has the host of the connection,
+	// otherwise inbound connection could take the address of another peer and replace it
+	address := hello.Address
+	if !sameHost(address, conn.RemoteAddr().String()) {
+		address = conn.RemoteAddr().String()
+	}
+	g.addPeer(address, conn, false)
+}
+
+// host of the address is ip or name, which is resolved to ip of the remote side of the connection
+func sameHost(address, remote string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return false
+	}
+	remoteHost, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return false
+	}
+	remoteIP := net.ParseIP(remoteHost)
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.Equal(remoteIP)
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if ip.Equal(remoteIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// outbound connection to the address, nothing is done if peer is already connected
+func (g *Gossip) dial(address string) error {
+	if address == "" || address == g.config.Advertise {
+		return errors.New("own address")
+	}
+
+	g.mu.Lock()
+	_, connected := g.peers[address]
+	_, dialing := g.dialing[address]
+	if connected || dialing {
+		g.mu.Unlock()
+		return nil
+	}
+	g.dialing[address] = struct{}{}
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.dialing, address)
+		g.mu.Unlock()
+	}()
+
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return err
+	}
+	_, err = g.handshake(conn, true)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	g.addPeer(address, conn, true)
+	return nil
+}
+
+// exchange hello messages, outbound side sends hello first
+func (g *Gossip) handshake(conn net.Conn, outbound bool) (*envelope, error) {
+	err := conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err != nil {
+		return nil, err
+	}
+	hello := &envelope{Kind: kindHello, Address: g.config.Advertise}
+
+	if outbound {
+		err = writeFrame(conn, hello)
+		if err != nil {
+			return nil, err
+		}
+	}
+	remote, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if remote.Kind != kindHello {
+		return nil, fmt.Errorf("expected hello, got : %s", remote.Kind)
+	}
+	if !outbound {
+		err = writeFrame(conn, hello)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return remote, conn.SetDeadline(time.Time{})
+}
+
+// if both nodes dial each other at the same time, connection dialed by the node with the lower address is kept
+func (g *Gossip) addPeer(address string, conn net.Conn, outbound bool) {
+	g.mu.Lock()
+	old, exists := g.peers[address]
+	keepNew := exists && (outbound == (g.config.Advertise < address))
+	if (exists && !keepNew) || (!exists && len(g.peers) >= g.config.MaxPeers) || address == g.config.Advertise {
+		g.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if keepNew {
+		old.conn.Close()
+	}
+	p := &gossipPeer{
+		address:  address,
+		conn:     conn,
+		inbox:    make(chan *envelope, peerInboxSize),
+		requests: make(chan struct{}, maxPeerRequests),
+	}
+	g.peers[address] = p
+	g.known[address] = struct{}{}
+	g.mu.Unlock()
+
+	g.logger.Debug("gossip - peer connected", zap.String("peer", address))
+	go g.readLoop(p)
+	go g.deliverLoop(p)
+
+	err := p.send(&envelope{Kind: kindGetPeers})
+	if err != nil {
+		g.removePeer(p)
+	}
+}
+
+func (g *Gossip) removePeer(p *gossipPeer) {
+	g.mu.Lock()
+	if g.peers[p.address] == p {
+		delete(g.peers, p.address)
+	}
+	g.mu.Unlock()
+	p.conn.Close()
+}
+
+func (g *Gossip) readLoop(p *gossipPeer) {
+	defer close(p.inbox)
+	defer g.removePeer(p)
+	for {
+		env, err := readFrame(p.conn)
+		if err != nil {
+			g.logger.Debug("gossip - peer disconnected", zap.String("peer", p.address), zap.Error(err))
+			return
+		}
+		g.handleEnvelope(p, env)
+	}
+}
+
+func (g *Gossip) handleEnvelope(p *gossipPeer, env *envelope) {
+	switch env.Kind {
+	case kindGossip:
+		if !g.seen.add(env.MsgID) {
+			return
+		}
+		g.forward(env, p.address)
+		g.deliver(p, env)
+	case kindDirect:
+		g.deliver(p, env)
+	case kindRequest:
+		select {
+		case p.requests <- struct{}{}:
+		default:
+			err := p.send(&envelope{Kind: kindResponse, ID: env.ID, Error: "too many requests"})
+			if err != nil {
+				g.removePeer(p)
+			}
+			return
+		}
+		go func() {
+			defer func() { <-p.requests }()
+			resp := &envelope{Kind: kindResponse, ID: env.ID}
+			data, err := g.handler.HandleRequest(env.Data)
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Data = data
+			}
+			err = p.send(resp)
+			if err != nil {
+				g.removePeer(p)
+			}
+		}()
+	case kindResponse:
+		g.mu.RLock()
+		request, ok := g.pending[env.ID]
+		g.mu.RUnlock()
+		if !ok || request.peer != p {
+			g.logger.Debug("gossip - response without request", zap.String("peer", p.address), zap.Uint64("id", env.ID)) // DEBUG
+			return
+		}
+		// duplicate response is dropped, read loop is not blocked
+		select {
+		case request.respCh <- env:
+		default:
+		}
+	case kindGetPeers:
+		peers, _ := g.Peers()
+		err := p.send(&envelope{Kind: kindPeers, Peers: peers})
+		if err != nil {
+			g.removePeer(p)
+		}
+	case kindPeers:
+		g.mu.Lock()
+		for _, address := range env.Peers {
+			g.known[address] = struct{}{}
+		}
+		g.mu.Unlock()
+		go g.connectKnown()
+	default:
+		g.logger.Error("gossip - unknown envelope kind", zap.String("peer", p.address), zap.String("kind", env.Kind))
+	}
+}
+
+// pass message to the handler, message is dropped if the handler is too slow
+func (g *Gossip) deliver(p *gossipPeer, env *envelope) {
+	select {
+	case p.inbox <- env:
+	default:
+		g.logger.Error("gossip - peer inbox is full, message dropped", zap.String("peer", p.address), zap.String("kind", env.Kind))
+	}
+}
+
+func (g *Gossip) deliverLoop(p *gossipPeer) {
+	for env := range p.inbox {
+		err := g.handler.HandleMessage(env.Data)
+		if err != nil {
+			g.logger.Error("gossip - handle message", zap.String("peer", p.address), zap.String("kind", env.Kind), zap.Error(err))
+		}
+	}
+}
+
+// reconnect to seeds if there are no peers, connect to discovered nodes and ask peers for their peers
+func (g *Gossip) discoveryLoop() {
+	g.connectSeeds()
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+		}
+
+		if len(g.connectedPeers()) == 0 {
+			g.connectSeeds()
+		}
+		g.connectKnown()
+		for _, p := range g.connectedPeers() {
+			err := p.send(&envelope{Kind: kindGetPeers})
+			if err != nil {
+				g.removePeer(p)
+			}
+		}
+	}
+}
+
+func (g *Gossip) connectSeeds() {
+	var wg sync.WaitGroup
+	for _, seed := range g.config.Seeds {
+		wg.Add(1)
+		go func(seed string) {
+			defer wg.Done()
+			err := g.dial(seed)
+			if err != nil {
+				g.logger.Debug("gossip - connect to seed", zap.String("seed", seed), zap.Error(err))
+			}
+		}(seed)
+	}
+	wg.Wait()
+}
+
+func (g *Gossip) connectKnown() {
+	g.mu.RLock()
+	candidates := make([]string, 0)
+	free := g.config.MaxPeers - len(g.peers)
+	for address := range g.known {
+		if len(candidates) >= free {
+			break
+		}
+		if _, ok := g.peers[address]; ok || address == g.config.Advertise {
+			continue
+		}
+		candidates = append(candidates, address)
+	}
+	g.mu.RUnlock()
+
+	for _, address := range candidates {
+		err := g.dial(address)
+		if err != nil {
+			g.logger.Debug("gossip - connect to discovered peer", zap.String("peer", address), zap.Error(err))
+		}
+	}
+}
+
+// ids of gossip messages, which were already handled, the oldest ids are forgotten
+type seenCache struct {
+	mu    sync.Mutex
+	ids   map[string]struct{}
+	order []string
+	next  int
+}
+
+func newSeenCache(size int) *seenCache {
+	return &seenCache{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, size),
+	}
+}
+
+// add returns false if id was already seen
+func (c *seenCache) add(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.ids[id]; ok {
+		return false
+	}
+	if old := c.order[c.next]; old != "" {
+		delete(c.ids, old)
+	}
+	c.order[c.next] = id
+	c.next = (c.next + 1) % len(c.order)
+	c.ids[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LinkConfig describes one direction of the link between two nodes of loopback network
+type LinkConfig struct {
+	Latency  time.Duration // delay of each message
+	Jitter   time.Duration // random delay in [0, Jitter) added to latency
+	DropRate float64       // probability of message loss, 0..1
+}
+
+type link struct {
+	from string
+	to   string
+}
+
+// LoopbackNetwork connects nodes running in one process (simulation)
+// links have configurable latency and drops, nodes can be partitioned
+type LoopbackNetwork struct {
+	mu          sync.Mutex
+	rand        *rand.Rand
+	nodes       map[string]*Loopback
+	links       map[link]LinkConfig
+	defaultLink LinkConfig
+	partitions  map[string]int // partition of the node, nodes from different partitions can't reach each other
+}
+
+func NewLoopbackNetwork(seed int64) *LoopbackNetwork {
+	return &LoopbackNetwork{
+		rand:  rand.New(rand.NewSource(seed)),
+		nodes: make(map[string]*Loopback),
+		links: make(map[link]LinkConfig),
+	}
+}
+
+// Join adds node to the network, messages for the address are passed to the handler
+func (n *LoopbackNetwork) Join(address string, handler Handler) *Loopback {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l := &Loopback{
+		address: address,
+		handler: handler,
+		network: n,
+	}
+	n.nodes[address] = l
+	return l
+}
+
+// SetDefaultLink sets config of links without own config
+func (n *LoopbackNetwork) SetDefaultLink(config LinkConfig) {
+	n.mu.Lock()
+	n.defaultLink = config
+	n.mu.Unlock()
+}
+
+// SetLink sets config of the link from one node to another, link of opposite direction is not changed
+func (n *LoopbackNetwork) SetLink(from, to string, config LinkConfig) {
+	n.mu.Lock()
+	n.links[link{from: from, to: to}] = config
+	n.mu.Unlock()
+}
+
+// Partition splits network into groups of nodes, nodes which are not listed form one more group
+func (n *LoopbackNetwork) Partition(groups ...[]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partitions = make(map[string]int)
+	for i, group := range groups {
+		for _, address := range group {
+			n.partitions[address] = i + 1
+		}
+	}
+}
+
+// Heal removes partitions
+func (n *LoopbackNetwork) Heal() {
+	n.mu.Lock()
+	n.partitions = nil
+	n.mu.Unlock()
+}
+
+func (n *LoopbackNetwork) leave(address string) {
+	n.mu.Lock()
+	delete(n.nodes, address)
+	n.mu.Unlock()
+}
+
+// route returns receiver and delay of the message from one node to another
+// ok = false if message is lost
+func (n *LoopbackNetwork) route(from, to string) (receiver *Loopback, delay time.Duration, ok bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	receiver, found := n.nodes[to]
+	if !found || n.partitions[from] != n.partitions[to] {
+		return nil, 0, false
+	}
+	config, found := n.links[link{from: from, to: to}]
+	if !found {
+		config = n.defaultLink
+	}
+	if config.DropRate > 0 && n.rand.Float64() < config.DropRate {
+		return nil, 0, false
+	}
+	delay = config.Latency
+	if config.Jitter > 0 {
+		delay += time.Duration(n.rand.Int63n(int64(config.Jitter)))
+	}
+	return receiver, delay, true
+}
+
+// Loopback is transport of the node in loopback network
+type Loopback struct {
+	address string
+	handler Handler
+	network *LoopbackNetwork
+}
+
+func (l *Loopback) Address() string {
+	return l.address
+}
+
+func (l *Loopback) Broadcast(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal msg : %w", err)
+	}
+	peers, _ := l.Peers()
+	for _, peer := range peers {
+		l.send(peer, data)
+	}
+	return nil
+}
+
+func (l *Loopback) SendTo(peer string, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal msg : %w", err)
+	}
+	l.network.mu.Lock()
+	_, ok := l.network.nodes[peer]
+	l.network.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w : %s", ErrUnknownPeer, peer)
+	}
+	l.send(peer, data)
+	return nil
+}
+
+// message is delivered asynchronously after the delay of the link, lost messages are not reported
+func (l *Loopback) send(peer string, data []byte) {
+	receiver, delay, ok := l.network.route(l.address, peer)
+	if !ok {
+		return
+	}
+	time.AfterFunc(delay, func() {
+		receiver.handler.HandleMessage(data)
+	})
+}
+
+// Request is synchronous, both request and response are delayed and could be lost
+func (l *Loopback) Request(peer string, request interface{}) ([]byte, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request : %w", err)
+	}
+	receiver, delay, ok := l.network.route(l.address, peer)
+	if !ok {
+		return nil, fmt.Errorf("%w : %s", ErrTimeout, peer)
+	}
+	time.Sleep(delay)
+
+	response, err := receiver.handler.HandleRequest(data)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s : %w", peer, err)
+	}
+
+	_, delay, ok = l.network.route(peer, l.address)
+	if !ok {
+		return nil, fmt.Errorf("%w : %s", ErrTimeout, peer)
+	}
+	time.Sleep(delay)
+	return response, nil
+}
+
+// Peers returns nodes, which are not separated from the node by partition
+func (l *Loopback) Peers() ([]string, error) {
+	l.network.mu.Lock()
+	defer l.network.mu.Unlock()
+	peers := make([]string, 0, len(l.network.nodes))
+	for address := range l.network.nodes {
+		if address == l.address || l.network.partitions[address] != l.network.partitions[l.address] {
+			continue
+		}
+		peers = append(peers, address)
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
+
+// Close removes node from the network
+func (l *Loopback) Close() error {
+	l.network.leave(l.address)
+	return nil
+}
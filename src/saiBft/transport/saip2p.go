@@ -0,0 +1,265 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+// SaiP2p sends messages via saiP2p service, connected nodes are provided by saiP2pProxy
+// incoming messages come to the message handler of the node
+// saiP2p doesn't return the answer of direct message, so request is answered by response message with the same request id
+type SaiP2p struct {
+	ctx            context.Context // requests are cancelled when ctx is done
+	address        string
+	proxyAddress   string
+	replyTo        string
+	requestTimeout time.Duration
+	client         *http.Client
+
+	mu      sync.Mutex
+	pending map[string]chan *models.PeerResponse // requests waiting for response by request id
+}
+
+type SaiP2pConfig struct {
+	Address        string        // saiP2p address
+	ProxyAddress   string        // saiP2pProxy address
+	ReplyTo        string        // saiP2p address of the node, which peers can reach, node can't send requests if empty
+	RequestTimeout time.Duration // time to wait for response of direct request
+}
+
+var errNoReplyTo = errors.New("saiP2p public address of the node is not set, peers don't answer requests without reply address")
+
+func NewSaiP2p(ctx context.Context, config *SaiP2pConfig) *SaiP2p {
+	requestTimeout := config.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	return &SaiP2p{
+		ctx:            ctx,
+		address:        config.Address,
+		proxyAddress:   config.ProxyAddress,
+		replyTo:        config.ReplyTo,
+		requestTimeout: requestTimeout,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		pending: make(map[string]chan *models.PeerResponse),
+	}
+}
+
+func (t *SaiP2p) Broadcast(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal msg : %w", err)
+	}
+
+	param := url.Values{}
+	param.Add("message", string(data))
+	postRequest, err := http.NewRequestWithContext(t.ctx, "POST", t.address, bytes.NewBufferString(param.Encode()))
+	if err != nil {
+		return fmt.Errorf("create post request : %w", err)
+	}
+	postRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(postRequest)
+	if err != nil {
+		return fmt.Errorf("send post request to %s : %w", t.address, err)
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+// send direct message to the node via saiP2p
+func (t *SaiP2p) SendTo(peer string, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal msg : %w", err)
+	}
+
+	param := url.Values{}
+	param.Add("message", string(data))
+	param.Add("node", peer)
+
+	postRequest, err := http.NewRequestWithContext(t.ctx, "POST", t.address+"/Send_message_to", strings.NewReader(param.Encode()))
+	if err != nil {
+		return fmt.Errorf("create post request : %w", err)
+	}
+	postRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(postRequest)
+	if err != nil {
+		return fmt.Errorf("send post request : %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("send post request wrong response status code : %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// send request to the node and wait for its response message
+// ErrTimeout is returned if the node doesn't answer in request timeout
+func (t *SaiP2p) Request(peer string, request interface{}) ([]byte, error) {
+	if t.replyTo == "" {
+		return nil, errNoReplyTo
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request : %w", err)
+	}
+	requestID, err := newRequestID()
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(chan *models.PeerResponse, 1)
+	t.mu.Lock()
+	t.pending[requestID] = responses
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, requestID)
+		t.mu.Unlock()
+	}()
+
+	err = t.SendTo(peer, &models.PeerRequest{
+		Type:      models.RequestMsgType,
+		RequestID: requestID,
+		ReplyTo:   t.replyTo,
+		Payload:   payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(t.requestTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-responses:
+		if resp.Error != "" {
+			return nil, fmt.Errorf("%s : %s", peer, resp.Error)
+		}
+		return resp.Payload, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w : %s, request %s", ErrTimeout, peer, requestID)
+	case <-t.ctx.Done():
+		return nil, t.ctx.Err()
+	}
+}
+
+// HandleResponse passes response to the waiting request, false if nobody waits for it
+// responses to unknown request ids are dropped, so responses sent to the node by other requests are ignored
+func (t *SaiP2p) HandleResponse(resp *models.PeerResponse) bool {
+	t.mu.Lock()
+	responses, ok := t.pending[resp.RequestID]
+	delete(t.pending, resp.RequestID)
+	t.mu.Unlock()
+	if !ok {
+		return false
+	}
+	responses <- resp
+	return true
+}
+
+// answer request of other node, response is sent only to reply address of connected node
+// saiP2p doesn't tell the sender of the request, so responses can't be sent to any address given by request
+func (t *SaiP2p) Respond(request *models.PeerRequest, resp *models.PeerResponse) error {
+	if request.ReplyTo == "" {
+		return errors.New("request without reply address")
+	}
+	peers, err := t.Peers()
+	if err != nil {
+		return fmt.Errorf("get connected nodes : %w", err)
+	}
+	if !containsHost(peers, request.ReplyTo) {
+		return fmt.Errorf("reply address %s is not connected node", request.ReplyTo)
+	}
+	return t.SendTo(request.ReplyTo, resp)
+}
+
+// connection port of the node differs from its saiP2p port, so nodes are compared by host
+func containsHost(addresses []string, address string) bool {
+	host := hostOf(address)
+	for _, a := range addresses {
+		if hostOf(a) == host {
+			return true
+		}
+	}
+	return false
+}
+
+func hostOf(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generate request id : %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// connected nodes from saiP2pProxy
+func (t *SaiP2p) Peers() ([]string, error) {
+	return t.PeersAtHeight(0)
+}
+
+// connected nodes from saiP2pProxy, which have block with the number >= height
+func (t *SaiP2p) PeersAtHeight(height int) ([]string, error) {
+	b, err := json.Marshal(&models.SyncRequest{
+		Number: height,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	postRequest, err := http.NewRequestWithContext(t.ctx, "POST", strings.TrimRight(t.proxyAddress, "/")+"/sync", bytes.NewBuffer(b))
+	if err != nil {
+		return nil, err
+	}
+	postRequest.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(postRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	syncRespBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sync request wrong response status code : %d, body : %s", resp.StatusCode, syncRespBody)
+	}
+
+	syncResp := models.SyncResponse{}
+	err = json.Unmarshal(syncRespBody, &syncResp)
+	if err != nil {
+		return nil, err
+	}
+	return syncResp.Addresses, nil
+}
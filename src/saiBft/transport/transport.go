@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"errors"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+var (
+	ErrNoPeers     = errors.New("transport - no connected peers")
+	ErrTimeout     = errors.New("transport - request timeout")
+	ErrUnknownPeer = errors.New("transport - unknown peer")
+)
+
+// Transport delivers messages between nodes
+// messages are json encoded by transport
+type Transport interface {
+	// Broadcast sends message to all nodes of the network
+	Broadcast(msg interface{}) error
+	// SendTo sends message to the peer
+	SendTo(peer string, msg interface{}) error
+	// Request sends request to the peer and returns its response
+	Request(peer string, request interface{}) ([]byte, error)
+	// Peers returns addresses of connected peers
+	Peers() ([]string, error)
+}
+
+// Handler handles messages and requests from other nodes
+type Handler interface {
+	HandleMessage(data []byte) error
+	HandleRequest(data []byte) ([]byte, error)
+}
+
+// Starter is implemented by transports, which listen for peers themselves
+type Starter interface {
+	Start() error
+}
+
+// HeightPeers is implemented by transports, which know heights of the peers
+type HeightPeers interface {
+	// PeersAtHeight returns addresses of connected peers with the last block number >= height
+	PeersAtHeight(height int) ([]string, error)
+}
+
+// Responder is implemented by transports, which answer requests by separate response messages
+type Responder interface {
+	// HandleResponse passes response message to the waiting request, false if nobody waits for it
+	HandleResponse(resp *models.PeerResponse) bool
+	// Respond sends response to the requester
+	Respond(request *models.PeerRequest, resp *models.PeerResponse) error
+}
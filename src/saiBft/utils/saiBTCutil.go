@@ -7,7 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"reflect"
+	"net/url"
 	"strings"
 	"time"
 
@@ -59,48 +59,15 @@ func GetBtcKeys(address string) (*models.BtcKeys, []byte, error) {
 	return &keys, body, nil
 }
 
-// validate message signature
-func ValidateSignature(msg interface{}, address, SenderAddress, signature string) (err error) {
-	b := make([]byte, 0)
-	switch msg.(type) {
-	case *models.BlockConsensusMessage:
-		BCMsg := msg.(*models.BlockConsensusMessage)
-		b, err = json.Marshal(&models.Block{
-			Number:            BCMsg.Block.Number,
-			PreviousBlockHash: BCMsg.Block.PreviousBlockHash,
-			Messages:          BCMsg.Block.Messages,
-			SenderAddress:     BCMsg.Block.SenderAddress,
-		})
-		if err != nil {
-			return fmt.Errorf(" marshal blockConsensusMessage : %w", err)
-		}
-	case *models.ConsensusMessage:
-		cMsg := msg.(*models.ConsensusMessage)
-		b, err = json.Marshal(&models.ConsensusMessage{
-			SenderAddress: cMsg.SenderAddress,
-			BlockNumber:   cMsg.BlockNumber,
-			Round:         cMsg.Round,
-			Messages:      cMsg.Messages,
-		})
-		if err != nil {
-			return fmt.Errorf("marshal ConsensusMessage : %w", err)
-		}
-	case *models.TransactionMessage:
-		txMsg := msg.(*models.TransactionMessage)
-		b, err = json.Marshal(&models.Tx{
-			SenderAddress: txMsg.Tx.SenderAddress,
-			Message:       txMsg.Tx.Message,
-		})
-		if err != nil {
-			return fmt.Errorf("marshal TransactionMessage : %w", err)
-		}
-	default:
-		return fmt.Errorf("unknown type of message, incoming type : %+v\n", reflect.TypeOf(msg))
-	}
-	preparedString := fmt.Sprintf("method=validateSignature&a=%s&signature=%s&message=%s", SenderAddress, signature, string(b))
-	requestBody := strings.NewReader(preparedString)
+// validate signature of payload at saiBTC
+func ValidateSignature(payload []byte, address, SenderAddress, signature string) error {
+	param := url.Values{}
+	param.Add("method", "validateSignature")
+	param.Add("a", SenderAddress)
+	param.Add("signature", signature)
+	param.Add("message", string(payload))
 
-	body, err := sendRequest(address, requestBody)
+	body, err := sendRequest(address, strings.NewReader(param.Encode()))
 	if err != nil {
 		return fmt.Errorf("sendRequest to saiBTC : %w", err)
 	}
@@ -118,59 +85,13 @@ func ValidateSignature(msg interface{}, address, SenderAddress, signature string
 }
 
 // saiBTC sign message method
-func SignMessage(msg interface{}, address, privateKey string) (resp *models.SignMessageResponse, err error) {
-	var preparedString string
-	switch msg.(type) {
-	case *models.BlockConsensusMessage:
-		BCMsg := msg.(*models.BlockConsensusMessage)
-		data, err := json.Marshal(&models.Block{
-			Number:            BCMsg.Block.Number,
-			PreviousBlockHash: BCMsg.Block.PreviousBlockHash,
-			Messages:          BCMsg.Block.Messages,
-			SenderAddress:     BCMsg.Block.SenderAddress,
-		})
-		if err != nil {
-			return nil, err
-		}
-		preparedString = fmt.Sprintf("method=signMessage&p=%s&message=%s", privateKey, string(data))
-	case *models.ConsensusMessage:
-		cMsg := msg.(*models.ConsensusMessage)
-		data, err := json.Marshal(&models.ConsensusMessage{
-			SenderAddress: cMsg.SenderAddress,
-			BlockNumber:   cMsg.BlockNumber,
-			Round:         cMsg.Round,
-			Messages:      cMsg.Messages,
-		})
-		if err != nil {
-			return nil, err
-		}
-		preparedString = fmt.Sprintf("method=signMessage&p=%s&message=%s", privateKey, string(data))
-	case *models.TransactionMessage:
-		TxMsg := msg.(*models.TransactionMessage)
-		data, err := json.Marshal(&models.Tx{
-			SenderAddress: TxMsg.Tx.SenderAddress,
-			Message:       TxMsg.Tx.Message,
-		})
-		if err != nil {
-			return nil, err
-		}
-		preparedString = fmt.Sprintf("method=signMessage&p=%s&message=%s", privateKey, string(data))
-	case *models.Tx:
-		TxMsg := msg.(*models.Tx)
-		data, err := json.Marshal(&models.Tx{
-			SenderAddress: TxMsg.SenderAddress,
-			Message:       TxMsg.Message,
-		})
-		if err != nil {
-			return nil, err
-		}
-		preparedString = fmt.Sprintf("method=signMessage&p=%s&message=%s", privateKey, string(data))
-	default:
-		return nil, errors.New("unknown type of message")
-	}
-	requestBody := strings.NewReader(preparedString)
+func SignMessage(payload []byte, address, privateKey string) (*models.SignMessageResponse, error) {
+	param := url.Values{}
+	param.Add("method", "signMessage")
+	param.Add("p", privateKey)
+	param.Add("message", string(payload))
 
-	body, err := sendRequest(address, requestBody)
+	body, err := sendRequest(address, strings.NewReader(param.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("sendRequest to saiBTC : %w", err)
 	}
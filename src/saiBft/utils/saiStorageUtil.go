@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,6 +17,7 @@ type Database struct {
 	url      string
 	email    string
 	password string
+	ctx      context.Context
 }
 
 func Storage(Url string, Email string, Password string) Database {
@@ -23,9 +25,16 @@ func Storage(Url string, Email string, Password string) Database {
 		url:      Url,
 		email:    Email,
 		password: Password,
+		ctx:      context.Background(),
 	}
 }
 
+// WithContext returns database, which requests are cancelled when ctx is done
+func (db Database) WithContext(ctx context.Context) Database {
+	db.ctx = ctx
+	return db
+}
+
 type StorageRequest struct {
 	token      string
 	collection string
@@ -82,11 +91,11 @@ func (db Database) makeRequest(method string, request StorageRequest, token stri
 		return jsonErr, []byte("")
 	}
 
-	return send(db.url+"/"+method, bytes.NewBuffer(jsonStr), token)
+	return send(db.ctx, db.url+"/"+method, bytes.NewBuffer(jsonStr), token)
 }
 
-func send(url string, data io.Reader, token string) (error, []byte) {
-	req, err := http.NewRequest("POST", url, data)
+func send(ctx context.Context, url string, data io.Reader, token string) (error, []byte) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, data)
 
 	if err != nil {
 		fmt.Println("Database error: ", err)
@@ -0,0 +1,250 @@
+// Package wal is the append-only write-ahead log of consensus steps
+// record is written and synced to disk before the step becomes visible to other nodes
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// types of entries
+const (
+	EntryReceived = "received" // consensus message of other node
+	EntryVote     = "vote"     // consensus message of the node
+	EntryBlock    = "block"    // block proposed by the node
+	EntryCounted  = "counted"  // votes of consensus message of the sender were counted at the round
+)
+
+// record header : 4 bytes length of data, 4 bytes crc32 of data
+const headerSize = 8
+
+// max size of one record, bigger length means corrupted record
+const maxRecordSize = 64 << 20
+
+type Entry struct {
+	Type   string          `json:"type"`
+	Height int             `json:"height"`
+	Round  int             `json:"round"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// WAL keeps entries of not finished heights, entries of finished heights are removed by Truncate
+type WAL struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	entries   []*Entry
+	minHeight int
+}
+
+// Open reads entries from the file and opens it for appending
+// incomplete record at the end of the file (crash while writing) is dropped
+func Open(path string) (*WAL, []*Entry, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wal - create dir : %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wal - open file : %w", err)
+	}
+
+	entries, size, err := readEntries(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	// cut incomplete record, new records are appended after the last valid one
+	err = file.Truncate(size)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("wal - truncate incomplete record : %w", err)
+	}
+	_, err = file.Seek(size, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("wal - seek : %w", err)
+	}
+
+	w := &WAL{
+		path:    path,
+		file:    file,
+		entries: entries,
+	}
+	w.minHeight = minHeight(entries)
+	return w, entries, nil
+}
+
+// read valid records, size is the length of valid part of the file
+func readEntries(file *os.File) (entries []*Entry, size int64, err error) {
+	reader := bufio.NewReader(file)
+	header := make([]byte, headerSize)
+	for {
+		_, err := io.ReadFull(reader, header)
+		if err != nil {
+			// io.EOF - end of log, io.ErrUnexpectedEOF - incomplete header
+			return entries, size, nil
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		if length > maxRecordSize {
+			return entries, size, nil
+		}
+		data := make([]byte, length)
+		_, err = io.ReadFull(reader, data)
+		if err != nil || crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+			return entries, size, nil
+		}
+		entry := &Entry{}
+		err = json.Unmarshal(data, entry)
+		if err != nil {
+			return nil, 0, fmt.Errorf("wal - unmarshal entry : %w", err)
+		}
+		entries = append(entries, entry)
+		size += int64(headerSize + length)
+	}
+}
+
+func encodeEntry(entry *Entry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("wal - marshal entry : %w", err)
+	}
+	record := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:headerSize], crc32.ChecksumIEEE(data))
+	copy(record[headerSize:], data)
+	return record, nil
+}
+
+// Append writes entry with msg as data, it returns after the entry is synced to disk
+func (w *WAL) Append(entryType string, height, round int, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("wal - marshal data : %w", err)
+	}
+	entry := &Entry{
+		Type:   entryType,
+		Height: height,
+		Round:  round,
+		Data:   data,
+	}
+	record, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return errors.New("wal - closed")
+	}
+	_, err = w.file.Write(record)
+	if err != nil {
+		return fmt.Errorf("wal - write : %w", err)
+	}
+	err = w.file.Sync()
+	if err != nil {
+		return fmt.Errorf("wal - sync : %w", err)
+	}
+	w.entries = append(w.entries, entry)
+	if len(w.entries) == 1 || height < w.minHeight {
+		w.minHeight = height
+	}
+	return nil
+}
+
+// Truncate removes entries of heights lower than height
+// log is rewritten to temp file, which replaces the log atomically
+func (w *WAL) Truncate(height int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return errors.New("wal - closed")
+	}
+	if len(w.entries) == 0 || w.minHeight >= height {
+		return nil
+	}
+
+	kept := make([]*Entry, 0, len(w.entries))
+	for _, entry := range w.entries {
+		if entry.Height >= height {
+			kept = append(kept, entry)
+		}
+	}
+
+	tmpPath := w.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("wal - create temp file : %w", err)
+	}
+	for _, entry := range kept {
+		record, err := encodeEntry(entry)
+		if err == nil {
+			_, err = tmp.Write(record)
+		}
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("wal - write temp file : %w", err)
+		}
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("wal - sync temp file : %w", err)
+	}
+	err = os.Rename(tmpPath, w.path)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("wal - replace log : %w", err)
+	}
+	syncDir(filepath.Dir(w.path))
+
+	w.file.Close()
+	w.file = tmp
+	w.entries = kept
+	w.minHeight = minHeight(kept)
+	return nil
+}
+
+// Close closes the log file
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func minHeight(entries []*Entry) int {
+	if len(entries) == 0 {
+		return 0
+	}
+	min := entries[0].Height
+	for _, entry := range entries[1:] {
+		if entry.Height < min {
+			min = entry.Height
+		}
+	}
+	return min
+}
+
+// rename is durable after sync of the directory
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,196 @@
+package wal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testEntry struct {
+	Type   string
+	Height int
+	Round  int
+	Data   string
+}
+
+func openWAL(t *testing.T, path string) (*WAL, []testEntry) {
+	t.Helper()
+	w, entries, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w, decodeEntries(t, entries)
+}
+
+func decodeEntries(t *testing.T, entries []*Entry) []testEntry {
+	t.Helper()
+	decoded := make([]testEntry, 0, len(entries))
+	for _, entry := range entries {
+		data := ""
+		err := json.Unmarshal(entry.Data, &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, testEntry{Type: entry.Type, Height: entry.Height, Round: entry.Round, Data: data})
+	}
+	return decoded
+}
+
+func appendEntries(t *testing.T, w *WAL, entries ...testEntry) {
+	t.Helper()
+	for _, entry := range entries {
+		err := w.Append(entry.Type, entry.Height, entry.Round, entry.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+var testEntries = []testEntry{
+	{Type: EntryVote, Height: 1, Round: 1, Data: "vote 1/1"},
+	{Type: EntryReceived, Height: 1, Round: 1, Data: "received 1/1"},
+	{Type: EntryBlock, Height: 1, Data: "block 1"},
+	{Type: EntryVote, Height: 2, Round: 1, Data: "vote 2/1"},
+	{Type: EntryCounted, Height: 2, Round: 1, Data: "sender"},
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal", "consensus.wal")
+	w, entries := openWAL(t, path)
+	if len(entries) != 0 {
+		t.Fatalf("entries of new log = %v, want none", entries)
+	}
+	appendEntries(t, w, testEntries...)
+	w.Close()
+
+	_, entries = openWAL(t, path)
+	if !reflect.DeepEqual(entries, testEntries) {
+		t.Errorf("replayed entries = %v, want %v", entries, testEntries)
+	}
+}
+
+// record, which was not written completely or was damaged, and records after it are dropped
+// next records are appended after the last valid record
+func TestDamagedTail(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(data []byte, last int) []byte
+	}{
+		{
+			name: "torn header",
+			damage: func(data []byte, last int) []byte {
+				return data[:last+headerSize/2]
+			},
+		},
+		{
+			name: "torn data",
+			damage: func(data []byte, last int) []byte {
+				return data[:len(data)-1]
+			},
+		},
+		{
+			name: "wrong crc",
+			damage: func(data []byte, last int) []byte {
+				data[len(data)-1] ^= 0xff
+				return data
+			},
+		},
+		{
+			name: "wrong length",
+			damage: func(data []byte, last int) []byte {
+				data[last] = 0xff
+				return data
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "consensus.wal")
+			w, _ := openWAL(t, path)
+			appendEntries(t, w, testEntries[:len(testEntries)-1]...)
+			last := fileSize(t, path)
+			appendEntries(t, w, testEntries[len(testEntries)-1])
+			w.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(path, tt.damage(data, int(last)), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, entries := openWAL(t, path)
+			want := testEntries[:len(testEntries)-1]
+			if !reflect.DeepEqual(entries, want) {
+				t.Fatalf("replayed entries = %v, want %v", entries, want)
+			}
+			if size := fileSize(t, path); size != last {
+				t.Fatalf("size of log = %d, want %d", size, last)
+			}
+
+			appendEntries(t, w, testEntries[len(testEntries)-1])
+			w.Close()
+			_, entries = openWAL(t, path)
+			if !reflect.DeepEqual(entries, testEntries) {
+				t.Errorf("entries after append = %v, want %v", entries, testEntries)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "consensus.wal")
+	w, _ := openWAL(t, path)
+	appendEntries(t, w, testEntries...)
+
+	err := w.Truncate(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// entries are appended to the rewritten log
+	next := testEntry{Type: EntryVote, Height: 2, Round: 2, Data: "vote 2/2"}
+	appendEntries(t, w, next)
+	// truncate below the lowest height keeps the log
+	err = w.Truncate(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	_, entries := openWAL(t, path)
+	want := append(append([]testEntry{}, testEntries[3:]...), next)
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries after truncate = %v, want %v", entries, want)
+	}
+	_, err = os.Stat(path + ".tmp")
+	if !os.IsNotExist(err) {
+		t.Errorf("temp file of truncate is left, err = %v", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	w, _ := openWAL(t, filepath.Join(t.TempDir(), "consensus.wal"))
+	w.Close()
+	err := w.Append(EntryVote, 1, 1, "vote")
+	if err == nil {
+		t.Error("append to closed log succeeded")
+	}
+	err = w.Truncate(2)
+	if err == nil {
+		t.Error("truncate of closed log succeeded")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// names of peer lists
+const (
+	blacklistName = "blacklist"
+	whitelistName = "whitelist"
+)
+
+// blacklist and whitelist of peers, lists can be changed at runtime by admin endpoints
+// peer is ip, ip:port (port is ignored, connection port of the peer differs from its p2p port) or cidr
+// lists are checked against connections of saiP2p, blocks and heights are not requested from rejected peers
+// callback of saiP2p doesn't tell the peer, which sent the message (request comes from saiP2p itself),
+// so messages relayed by saiP2p can't be filtered by the proxy
+type acl struct {
+	mu    sync.RWMutex
+	lists map[string]map[string]*peerMatcher
+}
+
+type peerMatcher struct {
+	ip  net.IP
+	net *net.IPNet
+}
+
+func parsePeer(peer string) (*peerMatcher, error) {
+	peer = strings.TrimSpace(peer)
+	if strings.Contains(peer, "/") {
+		_, ipNet, err := net.ParseCIDR(peer)
+		if err != nil {
+			return nil, fmt.Errorf("wrong cidr %s : %w", peer, err)
+		}
+		return &peerMatcher{net: ipNet}, nil
+	}
+	host := peer
+	if h, _, err := net.SplitHostPort(peer); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("wrong peer address : %s", peer)
+	}
+	return &peerMatcher{ip: ip}, nil
+}
+
+func (m *peerMatcher) match(ip net.IP) bool {
+	if m.net != nil {
+		return m.net.Contains(ip)
+	}
+	return m.ip.Equal(ip)
+}
+
+func newACL(blacklist, whitelist []string) (*acl, error) {
+	a := &acl{
+		lists: map[string]map[string]*peerMatcher{
+			blacklistName: {},
+			whitelistName: {},
+		},
+	}
+	for name, peers := range map[string][]string{blacklistName: blacklist, whitelistName: whitelist} {
+		for _, peer := range peers {
+			err := a.add(name, peer)
+			if err != nil {
+				return nil, fmt.Errorf("%s : %w", name, err)
+			}
+		}
+	}
+	return a, nil
+}
+
+func (a *acl) add(list, peer string) error {
+	m, err := parsePeer(peer)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lists[list][strings.TrimSpace(peer)] = m
+	return nil
+}
+
+func (a *acl) remove(list, peer string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	peer = strings.TrimSpace(peer)
+	_, ok := a.lists[list][peer]
+	delete(a.lists[list], peer)
+	return ok
+}
+
+func (a *acl) peers(list string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	peers := make([]string, 0, len(a.lists[list]))
+	for peer := range a.lists[list] {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// check ip of the peer, error describes the reason of rejection
+func (a *acl) allowed(source string) error {
+	ip := net.ParseIP(source)
+	if ip == nil {
+		return fmt.Errorf("unknown source address : %s", source)
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for peer, m := range a.lists[blacklistName] {
+		if m.match(ip) {
+			return fmt.Errorf("peer %s is blacklisted (%s)", source, peer)
+		}
+	}
+	if len(a.lists[whitelistName]) == 0 {
+		return nil
+	}
+	for _, m := range a.lists[whitelistName] {
+		if m.match(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("peer %s is not whitelisted", source)
+}
+
+// admin endpoints are allowed with admin_token, from localhost only if token is not set
+func (cfg *Config) adminMiddleware(c *gin.Context) {
+	if cfg.AdminToken == "" {
+		ip := net.ParseIP(c.ClientIP())
+		if ip == nil || !ip.IsLoopback() {
+			abortWithError(c, http.StatusForbidden, fmt.Errorf("admin endpoints are allowed from localhost only"))
+			return
+		}
+		c.Next()
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+		abortWithError(c, http.StatusUnauthorized, fmt.Errorf("wrong admin token"))
+		return
+	}
+	c.Next()
+}
+
+type aclRequest struct {
+	Peer string `json:"peer" binding:"required"`
+}
+
+// GET /acl - current blacklist and whitelist
+func (cfg *Config) getACL(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		blacklistName: cfg.acl.peers(blacklistName),
+		whitelistName: cfg.acl.peers(whitelistName),
+	})
+}
+
+// POST /acl/:list {"peer": "..."} - add peer to blacklist or whitelist
+func (cfg *Config) addACL(c *gin.Context) {
+	list, req, ok := cfg.aclRequest(c)
+	if !ok {
+		return
+	}
+	err := cfg.acl.add(list, req.Peer)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	log.Printf("acl - %s added to %s", req.Peer, list)
+	c.JSON(http.StatusOK, cfg.acl.peers(list))
+}
+
+// DELETE /acl/:list {"peer": "..."} - remove peer from blacklist or whitelist
+func (cfg *Config) removeACL(c *gin.Context) {
+	list, req, ok := cfg.aclRequest(c)
+	if !ok {
+		return
+	}
+	if !cfg.acl.remove(list, req.Peer) {
+		abortWithError(c, http.StatusNotFound, fmt.Errorf("peer %s is not in %s", req.Peer, list))
+		return
+	}
+	log.Printf("acl - %s removed from %s", req.Peer, list)
+	c.JSON(http.StatusOK, cfg.acl.peers(list))
+}
+
+func (cfg *Config) aclRequest(c *gin.Context) (string, *aclRequest, bool) {
+	list := c.Param("list")
+	if list != blacklistName && list != whitelistName {
+		abortWithError(c, http.StatusNotFound, fmt.Errorf("unknown list : %s", list))
+		return "", nil, false
+	}
+	req := &aclRequest{}
+	err := c.ShouldBindJSON(req)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return "", nil, false
+	}
+	return list, req, true
+}
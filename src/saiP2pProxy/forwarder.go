@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRetryMinBackoff = 500   // milliseconds
+	defaultRetryMaxBackoff = 30000 // milliseconds
+)
+
+// bft handled the message and rejected it, message is not sent again
+var errRejected = errors.New("message is rejected by bft")
+
+// delivers messages from the queue to bft in order, message is sent until bft accepts or rejects it
+type forwarder struct {
+	mu        sync.Mutex
+	delivered uint64
+	rejected  uint64
+	retries   uint64
+	lastError string
+}
+
+// send queued messages to bft, waits with backoff while bft is unavailable
+func (cfg *Config) deliver() {
+	minBackoff := time.Duration(cfg.RetryMinBackoff) * time.Millisecond
+	if minBackoff <= 0 {
+		minBackoff = defaultRetryMinBackoff * time.Millisecond
+	}
+	maxBackoff := time.Duration(cfg.RetryMaxBackoff) * time.Millisecond
+	if maxBackoff < minBackoff {
+		maxBackoff = defaultRetryMaxBackoff * time.Millisecond
+	}
+	backoff := minBackoff
+
+	for {
+		data, err := cfg.queue.peek()
+		if err != nil {
+			log.Fatalf("forwarder - read queue : %s", err)
+		}
+		if data == nil {
+			<-cfg.queue.notify
+			continue
+		}
+
+		err = cfg.forward(data)
+		if err != nil && !errors.Is(err, errRejected) {
+			cfg.forwarder.failed(err, true)
+			log.Printf("forwarder - bft is unavailable, retry in %s : %s", backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = minBackoff
+
+		if err != nil {
+			cfg.forwarder.failed(err, false)
+			log.Printf("forwarder - %s", err)
+		} else {
+			cfg.forwarder.mu.Lock()
+			cfg.forwarder.delivered++
+			cfg.forwarder.mu.Unlock()
+		}
+		err = cfg.queue.pop()
+		if err != nil {
+			log.Fatalf("forwarder - remove message from queue : %s", err)
+		}
+	}
+}
+
+func (f *forwarder) failed(err error, retry bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if retry {
+		f.retries++
+	} else {
+		f.rejected++
+	}
+	f.lastError = err.Error()
+}
+
+// response of saiService with error, status code is always 200
+type bftError struct {
+	Status string `json:"Status"`
+	Error  string `json:"Error"`
+}
+
+// send message to bft
+// errRejected is returned if bft handled the message with error, other errors are temporary
+func (cfg *Config) forward(b []byte) error {
+	resp, err := cfg.client.Post(fmt.Sprintf("http://%s:%s", cfg.BftHost, cfg.BftPort), "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return err
+	}
+	// rest of the body is read, so connection is reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bft responded with status %d : %s", resp.StatusCode, respBody)
+	}
+	bftErr := &bftError{}
+	if json.Unmarshal(respBody, bftErr) == nil && bftErr.Status == "NOK" {
+		// inbound queue of bft is overloaded, message is sent later
+		if strings.Contains(bftErr.Error, "queue is full") {
+			return fmt.Errorf("bft is overloaded : %s", bftErr.Error)
+		}
+		return fmt.Errorf("%w : %s", errRejected, bftErr.Error)
+	}
+	return nil
+}
+
+// GET /queue - messages waiting for delivery to bft
+func (cfg *Config) getQueue(c *gin.Context) {
+	stats := cfg.queue.stats()
+	cfg.forwarder.mu.Lock()
+	defer cfg.forwarder.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"depth":      stats.Depth,
+		"bytes":      stats.Bytes,
+		"delivered":  cfg.forwarder.delivered,
+		"rejected":   cfg.forwarder.rejected,
+		"retries":    cfg.forwarder.retries,
+		"last_error": cfg.forwarder.lastError,
+	})
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
 	"gopkg.in/yaml.v2"
 )
 
@@ -19,37 +23,122 @@ type Config struct {
 	ProxyEndpoint string `yaml:"proxy_endpoint"`
 	BftHost       string `yaml:"bft_http_host"`
 	BftPort       string `yaml:"bft_http_port"`
+	P2pHost       string `yaml:"p2p_host"`
+	P2pPort       string `yaml:"p2p_port"`
+
+	PeersPollInterval int    `yaml:"peers_poll_interval"` // seconds between updates of peer table from saiP2p
+	P2pPublicAddress  string `yaml:"p2p_public_address"`  // ip:port of this saiP2p for responses of the peers, heights of the peers are not requested if empty
+	RequestTimeout    int    `yaml:"request_timeout"`     // seconds to wait for response of the peer
+
+	Blacklist      []string `yaml:"blacklist"`        // peers of saiP2p, which are not asked for blocks
+	Whitelist      []string `yaml:"whitelist"`        // if not empty, only these peers of saiP2p are asked for blocks
+	TrustedProxies []string `yaml:"trusted_proxies"`  // client of the proxy is taken from X-Forwarded-For of these proxies
+	RateLimit      float64  `yaml:"rate_limit"`       // messages per second from one http client (saiP2p for relayed messages), 0 - unlimited
+	RateBurst      int      `yaml:"rate_burst"`       // messages, which client can send at once above the rate limit
+	MaxMessageSize int64    `yaml:"max_message_size"` // bytes, 0 - unlimited
+	AdminToken     string   `yaml:"admin_token"`      // token of acl endpoints, allowed from localhost only if empty
+
+	DedupWindow      int  `yaml:"dedup_window"`      // seconds to remember forwarded messages, duplicates are dropped, -1 - disabled
+	VerifySignatures bool `yaml:"verify_signatures"` // check signatures of messages before forwarding
+
+	QueuePath       string `yaml:"queue_path"`        // dir of the queue of messages to bft
+	QueueMaxBytes   int64  `yaml:"queue_max_bytes"`   // messages are rejected if queue is larger, 0 - unlimited
+	QueueFsync      bool   `yaml:"queue_fsync"`       // sync every message to disk before the response
+	RetryMinBackoff int    `yaml:"retry_min_backoff"` // milliseconds before the first retry, doubled on each next one
+	RetryMaxBackoff int    `yaml:"retry_max_backoff"` // milliseconds
+
+	acl       *acl
+	limiter   *rateLimiter
+	dedup     *dedupCache     // nil if disabled
+	verifier  signer.Verifier // nil if signatures are not checked
+	queue     *diskQueue
+	forwarder forwarder
+	peers     *peerTable
+	pending   *pendingRequests // requests of the proxy waiting for response
+	client    *http.Client     // client of saiP2p
 }
 
 func main() {
 	config, err := NewConfig("config.yml")
 	if err != nil {
-		log.Fatalf("Open config file : ", err)
+		log.Fatalf("Open config file : %s", err)
 	}
 
+	config.queue, err = openQueue(config.QueuePath, config.QueueMaxBytes, config.QueueFsync)
+	if err != nil {
+		log.Fatalf("Open queue : %s", err)
+	}
+	if depth := config.queue.stats().Depth; depth > 0 {
+		log.Printf("%d messages restored from the queue", depth)
+	}
+	go config.deliver()
+
 	r := gin.Default()
+	err = r.SetTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Set trusted proxies : %s", err)
+	}
 	r.Use(gin.Recovery())
 	r.Use(cors.Default())
 	cfg := cors.DefaultConfig()
 	cfg.AllowAllOrigins = true
 
-	r.POST(config.ProxyEndpoint, config.handler)
+	r.POST(config.ProxyEndpoint, config.rateLimitMiddleware, config.handler)
 	r.GET("/check", config.check)
-	r.GET("/sync", config.sync)
+	r.GET("/queue", config.getQueue)
+	r.POST("/sync", config.sync)
+	r.GET("/sync", config.getPeers)
+
+	admin := r.Group("/acl", config.adminMiddleware)
+	admin.GET("", config.getACL)
+	admin.POST("/:list", config.addACL)
+	admin.DELETE("/:list", config.removeACL)
+
+	go config.pollPeers()
 
 	r.Run(fmt.Sprintf("%s:%s", config.Host, config.Port))
 }
 
 func (cfg *Config) handler(c *gin.Context) {
+	body := io.Reader(c.Request.Body)
+	if cfg.MaxMessageSize > 0 {
+		body = io.LimitReader(body, cfg.MaxMessageSize+1)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	if cfg.MaxMessageSize > 0 && int64(len(data)) > cfg.MaxMessageSize {
+		abortWithError(c, http.StatusRequestEntityTooLarge, fmt.Errorf("message is larger than %d bytes", cfg.MaxMessageSize))
+		return
+	}
+
 	m := make(map[string]interface{})
-	err := c.ShouldBindJSON(&m)
+	err = json.Unmarshal(data, &m)
 	if err != nil {
-		c.Status(500)
-		log.Println(err)
-		c.Writer.Write([]byte(err.Error()))
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
+	msg, err := cfg.checkMessage(data)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, fmt.Errorf("invalid message : %w", err))
+		return
+	}
+	// response to the request of the proxy is not forwarded to bft
+	if resp, ok := msg.Msg.(*models.PeerResponse); ok && cfg.pending.resolve(resp) {
+		c.JSON(http.StatusOK, gin.H{"status": "delivered"})
+		return
+	}
+	key := msg.Type + "/" + msg.Key
+	if cfg.dedup != nil {
+		if !cfg.dedup.add(key, time.Now()) {
+			c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+			return
+		}
+	}
+
 	req := jsonRequestType{
 		Method: "message",
 		Data:   m,
@@ -58,21 +147,28 @@ func (cfg *Config) handler(c *gin.Context) {
 
 	b, err := json.Marshal(req)
 	if err != nil {
-		c.Status(500)
-		log.Println(err)
-		c.Writer.Write([]byte(err.Error()))
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	_, err = http.Post(fmt.Sprintf("http://%s:%s", cfg.BftHost, cfg.BftPort), "application/json", bytes.NewBuffer(b))
+	// message is sent to bft by forwarder, it is kept in the queue while bft is unavailable
+	err = cfg.queue.push(b)
 	if err != nil {
-		c.Status(500)
-		log.Println(err)
-		c.Writer.Write([]byte(err.Error()))
+		if cfg.dedup != nil {
+			cfg.dedup.remove(key)
+		}
+		abortWithError(c, http.StatusServiceUnavailable, err)
 		return
 	}
 
-	log.Printf("Successfuly broadcasted msg : %+v", m)
+	log.Printf("Successfuly queued msg : %+v", m)
+	c.JSON(http.StatusOK, gin.H{"status": "queued"})
+}
+
+// log error and respond with it
+func abortWithError(c *gin.Context, status int, err error) {
+	log.Printf("%s %s from %s : %d %s", c.Request.Method, c.Request.URL.Path, c.ClientIP(), status, err)
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
 }
 
 type jsonRequestType struct {
@@ -99,6 +195,32 @@ func NewConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	config.acl, err = newACL(config.Blacklist, config.Whitelist)
+	if err != nil {
+		return nil, err
+	}
+	config.peers = newPeerTable()
+	config.pending = newPendingRequests()
+	config.client = &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	if config.QueuePath == "" {
+		config.QueuePath = defaultQueuePath
+	}
+	if config.DedupWindow >= 0 {
+		window := config.DedupWindow
+		if window == 0 {
+			window = defaultDedupWindow
+		}
+		config.dedup = newDedupCache(time.Duration(window) * time.Second)
+	}
+	if config.VerifySignatures {
+		config.verifier = newVerifier()
+	}
+	if config.RateLimit > 0 {
+		config.limiter = newRateLimiter(config.RateLimit, config.RateBurst)
+	}
+
 	return config, nil
 }
 
@@ -106,8 +228,3 @@ func (cfg *Config) check(c *gin.Context) {
 	c.JSON(200, "check ok")
 	return
 }
-
-func (cfg *Config) sync(c *gin.Context) {
-	c.JSON(200, "check ok")
-	return
-}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+const defaultPeersPollInterval = 10 // seconds
+
+// connections list of saiP2p has no documented format, so ip:port of the peers are taken from any part of it
+var peerAddressRe = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}:\d{1,5}\b`)
+
+// peers connected to saiP2p with their heights, updated by polling saiP2p
+type peerTable struct {
+	mu    sync.RWMutex
+	peers map[string]*peerInfo
+}
+
+type peerInfo struct {
+	Address string    `json:"address"`
+	Height  int       `json:"height"`
+	Updated time.Time `json:"updated"`
+	Error   string    `json:"error,omitempty"` // last height request failed, peer is returned by /sync only for block number 0
+}
+
+// request of bft node
+type syncRequest struct {
+	Number int `json:"block_number"`
+}
+
+type syncResponse struct {
+	Addresses []string `json:"addresses"`
+}
+
+type heightResponse struct {
+	Height int `json:"height"`
+}
+
+func newPeerTable() *peerTable {
+	return &peerTable{
+		peers: make(map[string]*peerInfo),
+	}
+}
+
+// peers with the last block number >= height, the highest peers first
+// height 0 returns all connected peers, also peers, which didn't answer height request
+func (t *peerTable) atHeight(height int) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	peers := make([]*peerInfo, 0, len(t.peers))
+	for _, peer := range t.peers {
+		if height <= 0 || (peer.Error == "" && peer.Height >= height) {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Height != peers[j].Height {
+			return peers[i].Height > peers[j].Height
+		}
+		return peers[i].Address < peers[j].Address
+	})
+	addresses := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		addresses = append(addresses, peer.Address)
+	}
+	return addresses
+}
+
+func (t *peerTable) list() []peerInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	peers := make([]peerInfo, 0, len(t.peers))
+	for _, peer := range t.peers {
+		peers = append(peers, *peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Address < peers[j].Address
+	})
+	return peers
+}
+
+// replace peers of the table, peers without new info keep the previous height
+func (t *peerTable) update(peers []*peerInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	table := make(map[string]*peerInfo, len(peers))
+	for _, peer := range peers {
+		if old, ok := t.peers[peer.Address]; ok && peer.Error != "" {
+			peer.Height = old.Height
+		}
+		table[peer.Address] = peer
+	}
+	t.peers = table
+}
+
+// update peer table every peers_poll_interval seconds
+func (cfg *Config) pollPeers() {
+	interval := time.Duration(cfg.PeersPollInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultPeersPollInterval * time.Second
+	}
+	for {
+		err := cfg.refreshPeers()
+		if err != nil {
+			log.Printf("peers - refresh : %s", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// get connected peers from saiP2p and ask each peer for its height
+func (cfg *Config) refreshPeers() error {
+	addresses, err := cfg.connections()
+	if err != nil {
+		return err
+	}
+
+	peers := make([]*peerInfo, 0, len(addresses))
+	wg := sync.WaitGroup{}
+	for _, address := range addresses {
+		host, _, _ := net.SplitHostPort(address)
+		if cfg.acl.allowed(host) != nil {
+			continue
+		}
+		peer := &peerInfo{Address: address}
+		peers = append(peers, peer)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			height, err := cfg.peerHeight(peer.Address)
+			peer.Updated = time.Now()
+			if err != nil {
+				peer.Error = err.Error()
+				return
+			}
+			peer.Height = height
+		}()
+	}
+	wg.Wait()
+	cfg.peers.update(peers)
+	return nil
+}
+
+// addresses of the peers connected to saiP2p
+func (cfg *Config) connections() ([]string, error) {
+	resp, err := cfg.client.PostForm(cfg.p2pURL("Get_connections_list"), url.Values{})
+	if err != nil {
+		return nil, fmt.Errorf("get connections list : %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read connections list : %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get connections list wrong response status code : %d", resp.StatusCode)
+	}
+
+	seen := make(map[string]bool)
+	addresses := make([]string, 0)
+	for _, address := range peerAddressRe.FindAllString(string(body), -1) {
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// ask bft node of the peer for its last block number
+func (cfg *Config) peerHeight(address string) (int, error) {
+	data, err := cfg.request(address, map[string]string{"type": models.GetHeightMsgType})
+	if err != nil {
+		return 0, fmt.Errorf("request height : %w", err)
+	}
+	height := &heightResponse{}
+	err = json.Unmarshal(data, height)
+	if err != nil {
+		return 0, fmt.Errorf("unmarshal height : %w", err)
+	}
+	return height.Height, nil
+}
+
+func (cfg *Config) p2pURL(method string) string {
+	return fmt.Sprintf("http://%s:%s/%s", cfg.P2pHost, cfg.P2pPort, method)
+}
+
+// POST /sync {"block_number": N} - connected peers, which have blocks up to N
+func (cfg *Config) sync(c *gin.Context) {
+	req := &syncRequest{}
+	err := c.ShouldBindJSON(req)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, &syncResponse{
+		Addresses: cfg.peers.atHeight(req.Number),
+	})
+}
+
+// GET /sync - peer table
+func (cfg *Config) getPeers(c *gin.Context) {
+	c.JSON(http.StatusOK, cfg.peers.list())
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultQueuePath = "data/queue"
+	queueFileName    = "queue.log"
+	offsetFileName   = "queue.offset"
+	recordHeader     = 8 // length and crc32 of the record
+	maxRecordSize    = 64 << 20
+
+	// delivered part of the file is removed, when it is larger than this
+	compactThreshold = 16 << 20
+)
+
+var errQueueFull = errors.New("forwarding queue is full")
+
+// persistent fifo queue of messages to bft
+// records are appended to the file, offset of the first not delivered record is kept in the separate file
+// messages are delivered at least once, the last message could be delivered again after restart
+type diskQueue struct {
+	mu          sync.Mutex
+	dir         string
+	file        *os.File
+	readOffset  int64 // the first not delivered record
+	writeOffset int64 // end of the last record
+	depth       int
+	maxBytes    int64
+	fsync       bool
+	notify      chan struct{}
+}
+
+// open queue in the dir, not delivered messages of previous run are restored
+func openQueue(dir string, maxBytes int64, fsync bool) (*diskQueue, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("create queue dir : %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, queueFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open queue : %w", err)
+	}
+	q := &diskQueue{
+		dir:      dir,
+		file:     file,
+		maxBytes: maxBytes,
+		fsync:    fsync,
+		notify:   make(chan struct{}, 1),
+	}
+
+	offset, err := ioutil.ReadFile(filepath.Join(dir, offsetFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read queue offset : %w", err)
+	}
+	if len(offset) > 0 {
+		q.readOffset, err = strconv.ParseInt(strings.TrimSpace(string(offset)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse queue offset : %w", err)
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat queue : %w", err)
+	}
+	// queue was emptied, but offset was not saved
+	if q.readOffset > info.Size() {
+		q.readOffset = 0
+	}
+
+	// count records after the offset, torn record at the end is removed
+	q.writeOffset = q.readOffset
+	for {
+		data, err := q.readAt(q.writeOffset)
+		if err != nil {
+			break
+		}
+		q.writeOffset += recordHeader + int64(len(data))
+		q.depth++
+	}
+	err = file.Truncate(q.writeOffset)
+	if err != nil {
+		return nil, fmt.Errorf("truncate queue : %w", err)
+	}
+	return q, nil
+}
+
+func (q *diskQueue) readAt(offset int64) ([]byte, error) {
+	header := make([]byte, recordHeader)
+	_, err := q.file.ReadAt(header, offset)
+	if err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("queue record at %d is corrupted", offset)
+	}
+	data := make([]byte, size)
+	_, err = q.file.ReadAt(data, offset+recordHeader)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, fmt.Errorf("queue record at %d is corrupted", offset)
+	}
+	return data, nil
+}
+
+// append message to the queue, errQueueFull is returned if queue_max_bytes is reached
+func (q *diskQueue) push(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	size := recordHeader + int64(len(data))
+	if q.maxBytes > 0 && q.writeOffset-q.readOffset+size > q.maxBytes {
+		return errQueueFull
+	}
+
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[recordHeader:], data)
+	_, err := q.file.WriteAt(record, q.writeOffset)
+	if err != nil {
+		return fmt.Errorf("write queue : %w", err)
+	}
+	if q.fsync {
+		err = q.file.Sync()
+		if err != nil {
+			return fmt.Errorf("sync queue : %w", err)
+		}
+	}
+	q.writeOffset += size
+	q.depth++
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// the first not delivered message, nil if queue is empty
+func (q *diskQueue) peek() ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.depth == 0 {
+		return nil, nil
+	}
+	return q.readAt(q.readOffset)
+}
+
+// remove the first message, it was delivered
+func (q *diskQueue) pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.depth == 0 {
+		return nil
+	}
+	data, err := q.readAt(q.readOffset)
+	if err != nil {
+		return err
+	}
+	q.readOffset += recordHeader + int64(len(data))
+	q.depth--
+
+	switch {
+	case q.depth == 0:
+		err = q.file.Truncate(0)
+		if err != nil {
+			return fmt.Errorf("truncate queue : %w", err)
+		}
+		q.readOffset, q.writeOffset = 0, 0
+	case q.readOffset > compactThreshold:
+		err = q.compact()
+		if err != nil {
+			return err
+		}
+	}
+	return q.saveOffset()
+}
+
+func (q *diskQueue) saveOffset() error {
+	path := filepath.Join(q.dir, offsetFileName)
+	err := ioutil.WriteFile(path+".tmp", []byte(strconv.FormatInt(q.readOffset, 10)), 0600)
+	if err != nil {
+		return fmt.Errorf("write queue offset : %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// move not delivered records to the new file, offset is saved by the caller
+func (q *diskQueue) compact() error {
+	path := filepath.Join(q.dir, queueFileName)
+	tmp, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("compact queue : %w", err)
+	}
+	_, err = io.Copy(tmp, io.NewSectionReader(q.file, q.readOffset, q.writeOffset-q.readOffset))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("compact queue : %w", err)
+	}
+
+	// offset 0 is saved before rename, if the proxy stops between them,
+	// delivered records of the old file are sent again instead of skipping not delivered ones
+	delivered := q.readOffset
+	q.readOffset = 0
+	err = q.saveOffset()
+	if err != nil {
+		q.readOffset = delivered
+		tmp.Close()
+		return err
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		q.readOffset = delivered
+		tmp.Close()
+		return fmt.Errorf("compact queue : %w", err)
+	}
+	q.file.Close()
+	q.file = tmp
+	q.writeOffset -= delivered
+	return nil
+}
+
+type queueStats struct {
+	Depth int   `json:"depth"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (q *diskQueue) stats() queueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return queueStats{
+		Depth: q.depth,
+		Bytes: q.writeOffset - q.readOffset,
+	}
+}
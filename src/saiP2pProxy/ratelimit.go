@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// buckets of peers, which sent nothing for this time, are removed
+const limiterIdleTimeout = 10 * time.Minute
+
+// token bucket rate limiter by http client of the proxy
+// messages relayed by saiP2p all come from saiP2p, so it limits the whole inbound traffic, not one peer
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+	cleaned time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		cleaned: time.Now(),
+	}
+}
+
+// take token of the source, returns time to wait for the next token if there are no tokens
+func (l *rateLimiter) allow(source string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.cleaned) > limiterIdleTimeout {
+		for key, b := range l.buckets {
+			if now.Sub(b.last) > limiterIdleTimeout {
+				delete(l.buckets, key)
+			}
+		}
+		l.cleaned = now
+	}
+
+	b, ok := l.buckets[source]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[source] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// reject messages of the client, which exceeded rate_limit, rate_limit 0 disables the limit
+func (cfg *Config) rateLimitMiddleware(c *gin.Context) {
+	if cfg.limiter == nil {
+		c.Next()
+		return
+	}
+	source := c.ClientIP()
+	ok, wait := cfg.limiter.allow(source, time.Now())
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		abortWithError(c, http.StatusTooManyRequests, fmt.Errorf("client %s exceeded rate limit of %v messages per second", source, cfg.RateLimit))
+		return
+	}
+	c.Next()
+}
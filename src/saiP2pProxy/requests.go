@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/models"
+)
+
+const defaultRequestTimeout = 10 // seconds
+
+var (
+	errRequestTimeout = errors.New("request timeout")
+	errNoReplyTo      = errors.New("p2p_public_address is not set, peers don't answer requests without reply address")
+)
+
+// requests of the proxy to bft nodes of the peers, waiting for response messages
+// saiP2p doesn't return the answer of direct message, response comes to the proxy endpoint with the same request id
+type pendingRequests struct {
+	mu       sync.Mutex
+	requests map[string]chan *models.PeerResponse
+}
+
+func newPendingRequests() *pendingRequests {
+	return &pendingRequests{
+		requests: make(map[string]chan *models.PeerResponse),
+	}
+}
+
+func (p *pendingRequests) add(requestID string) chan *models.PeerResponse {
+	responses := make(chan *models.PeerResponse, 1)
+	p.mu.Lock()
+	p.requests[requestID] = responses
+	p.mu.Unlock()
+	return responses
+}
+
+func (p *pendingRequests) remove(requestID string) {
+	p.mu.Lock()
+	delete(p.requests, requestID)
+	p.mu.Unlock()
+}
+
+// pass response to the waiting request, false if the proxy didn't send this request
+func (p *pendingRequests) resolve(resp *models.PeerResponse) bool {
+	p.mu.Lock()
+	responses, ok := p.requests[resp.RequestID]
+	delete(p.requests, resp.RequestID)
+	p.mu.Unlock()
+	if !ok {
+		return false
+	}
+	responses <- resp
+	return true
+}
+
+// send request to bft node of the peer and wait for its response
+func (cfg *Config) request(address string, request interface{}) ([]byte, error) {
+	if cfg.P2pPublicAddress == "" {
+		return nil, errNoReplyTo
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("generate request id : %w", err)
+	}
+	requestID := hex.EncodeToString(b)
+
+	responses := cfg.pending.add(requestID)
+	defer cfg.pending.remove(requestID)
+
+	err = cfg.sendTo(address, &models.PeerRequest{
+		Type:      models.RequestMsgType,
+		RequestID: requestID,
+		ReplyTo:   cfg.P2pPublicAddress,
+		Payload:   payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(cfg.RequestTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-responses:
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+		return resp.Payload, nil
+	case <-timer.C:
+		return nil, errRequestTimeout
+	}
+}
+
+// send direct message via saiP2p
+func (cfg *Config) sendTo(address string, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	param := url.Values{}
+	param.Add("message", string(data))
+	param.Add("node", address)
+
+	resp, err := cfg.client.Post(cfg.p2pURL("Send_message_to"), "application/x-www-form-urlencoded", strings.NewReader(param.Encode()))
+	if err != nil {
+		return fmt.Errorf("send message to %s : %w", address, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("send message to %s wrong response status code : %d", address, resp.StatusCode)
+	}
+	return nil
+}
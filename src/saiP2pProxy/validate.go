@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamthe1whoknocks/bft/models"
+	"github.com/iamthe1whoknocks/bft/signer"
+)
+
+const defaultDedupWindow = 60 // seconds
+
+var errHashMismatch = errors.New("hash does not match the message")
+
+// message, which is forwarded to bft
+type checkedMsg struct {
+	Type string
+	Key  string      // messages with the same key are duplicates
+	Msg  interface{} // decoded message
+}
+
+// decode message by its type, check schema and hash and optionally signatures
+// key has signatures, signatures are not always verified, so copy with wrong signature doesn't make the genuine message dropped as duplicate
+func (cfg *Config) checkMessage(data []byte) (*checkedMsg, error) {
+	header := struct {
+		Type string `json:"type"`
+	}{}
+	err := json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch header.Type {
+	case models.ConsensusMsgType:
+		msg := &models.ConsensusMessage{}
+		err = decodeAndValidate(data, msg, msg.Validate)
+		if err != nil {
+			return nil, err
+		}
+		err = checkHash(msg.Hash, msg.GetHash)
+		if err != nil {
+			return nil, err
+		}
+		err = cfg.verify(msg, msg.SenderAddress, msg.Signature)
+		if err != nil {
+			return nil, err
+		}
+		return &checkedMsg{Type: header.Type, Key: dedupKey(msg.Hash, msg.Signature), Msg: msg}, nil
+
+	case models.BlockConsensusMsgType:
+		msg := &models.BlockConsensusMessage{}
+		err = decodeAndValidate(data, msg, msg.Validate)
+		if err != nil {
+			return nil, err
+		}
+		err = checkHash(msg.BlockHash, msg.Block.GetHash)
+		if err != nil {
+			return nil, err
+		}
+		err = cfg.verify(msg, msg.Block.SenderAddress, msg.Block.SenderSignature)
+		if err != nil {
+			return nil, err
+		}
+		// sender is not a part of block hash, block with more votes is not a duplicate
+		return &checkedMsg{
+			Type: header.Type,
+			Key:  dedupKey(append([]string{msg.BlockHash, msg.Block.SenderAddress, strconv.Itoa(msg.Votes), msg.Block.SenderSignature}, msg.Signatures...)...),
+			Msg:  msg,
+		}, nil
+
+	case models.TransactionMsgType:
+		msg := &models.Tx{}
+		err = decodeAndValidate(data, msg, func() error {
+			return (&models.TransactionMessage{Tx: msg, MessageHash: msg.MessageHash}).Validate()
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = checkHash(msg.MessageHash, msg.GetHash)
+		if err != nil {
+			return nil, err
+		}
+		err = cfg.verify(msg, msg.SenderAddress, msg.SenderSignature)
+		if err != nil {
+			return nil, err
+		}
+		return &checkedMsg{Type: header.Type, Key: dedupKey(msg.MessageHash, msg.SenderSignature), Msg: msg}, nil
+
+	case models.SnapshotMsgType:
+		msg := &models.SnapshotManifest{}
+		err = decodeAndValidate(data, msg, msg.Validate)
+		if err != nil {
+			return nil, err
+		}
+		err = checkHash(msg.Hash, msg.GetHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range msg.Signatures {
+			err = cfg.verify(msg, s.Address, s.Signature)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// manifest is broadcasted again with more signatures
+		parts := []string{msg.Hash}
+		for _, s := range msg.Signatures {
+			parts = append(parts, s.Address, s.Signature)
+		}
+		return &checkedMsg{Type: header.Type, Key: dedupKey(parts...), Msg: msg}, nil
+
+	// direct requests and responses aren't signed, request id is unique
+	case models.RequestMsgType:
+		msg := &models.PeerRequest{}
+		err = decodeAndValidate(data, msg, msg.Validate)
+		if err != nil {
+			return nil, err
+		}
+		return &checkedMsg{Type: header.Type, Key: msg.RequestID, Msg: msg}, nil
+
+	case models.ResponseMsgType:
+		msg := &models.PeerResponse{}
+		err = decodeAndValidate(data, msg, msg.Validate)
+		if err != nil {
+			return nil, err
+		}
+		return &checkedMsg{Type: header.Type, Key: msg.RequestID, Msg: msg}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown message type : %q", header.Type)
+	}
+}
+
+// hex sha256 of the parts, so keys of large messages don't take memory of dedup cache
+func dedupKey(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "/")))
+	return hex.EncodeToString(hash[:])
+}
+
+func decodeAndValidate(data []byte, msg interface{}, validate func() error) error {
+	err := json.Unmarshal(data, msg)
+	if err != nil {
+		return err
+	}
+	return validate()
+}
+
+func checkHash(hash string, getHash func() (string, error)) error {
+	expected, err := getHash()
+	if err != nil {
+		return err
+	}
+	if hash != expected {
+		return errHashMismatch
+	}
+	return nil
+}
+
+// check signature of the message, if verify_signatures is set
+func (cfg *Config) verify(msg interface{}, address, signature string) error {
+	if cfg.verifier == nil {
+		return nil
+	}
+	payload, err := models.SignPayload(msg)
+	if err != nil {
+		return err
+	}
+	err = cfg.verifier.Verify(payload, address, signature)
+	if err != nil {
+		return fmt.Errorf("signature of %s : %w", address, err)
+	}
+	return nil
+}
+
+func newVerifier() signer.Verifier {
+	return signer.NewKeyTypeVerifier(signer.NewBtcVerifier())
+}
+
+// keys of messages forwarded during the window, gossip delivers the same message from many peers
+type dedupCache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	seen    map[string]time.Time // key -> time, when it expires
+	cleaned time.Time
+}
+
+func newDedupCache(window time.Duration) *dedupCache {
+	return &dedupCache{
+		window:  window,
+		seen:    make(map[string]time.Time),
+		cleaned: time.Now(),
+	}
+}
+
+// remember the key, returns false if the key was seen during the window
+func (d *dedupCache) add(key string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.cleaned) > d.window {
+		for k, expires := range d.seen {
+			if now.After(expires) {
+				delete(d.seen, k)
+			}
+		}
+		d.cleaned = now
+	}
+
+	if expires, ok := d.seen[key]; ok && now.Before(expires) {
+		return false
+	}
+	d.seen[key] = now.Add(d.window)
+	return true
+}
+
+// forget the key, message was not delivered to bft and can be accepted again
+func (d *dedupCache) remove(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, key)
+}
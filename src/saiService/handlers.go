@@ -8,6 +8,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
@@ -32,9 +33,15 @@ type cliRequestType struct {
 type j map[string]interface{}
 
 func (s *Service) handleSocketConnections(conn net.Conn) {
+	defer conn.Close()
 	for {
 		var message jsonRequestType
-		socketMessage, _ := bufio.NewReader(conn).ReadString('\n')
+		socketMessage, readErr := bufio.NewReader(conn).ReadString('\n')
+
+		// connection is closed
+		if readErr != nil && socketMessage == "" {
+			return
+		}
 
 		if socketMessage != "" {
 			_ = json.Unmarshal([]byte(socketMessage), &message)
@@ -177,16 +184,21 @@ func (s *Service) handleHttpConnections(resp http.ResponseWriter, req *http.Requ
 	resp.Write(body)
 }
 
-func (s *Service) processPath(path string, data interface{}) (interface{}, error) {
+func (s *Service) processPath(path string, data interface{}) (response interface{}, err error) {
+	started := time.Now()
 	h, ok := s.Handlers[path]
 
 	if !ok {
+		s.getMetrics().observe(unknownHandler, started, errors.New("no handler"))
 		return nil, errors.New("no handler")
 	}
+	defer func() {
+		s.getMetrics().observe(path, started, err)
+	}()
 
 	//todo: Rutina na process
 
-	response, err := h.Function(data)
+	response, err = h.Function(data)
 	if err != nil {
 		return nil, err
 	}
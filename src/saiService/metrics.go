@@ -0,0 +1,85 @@
+package saiService
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// handler label of requests to not registered handlers, so unknown paths don't create new series
+const unknownHandler = "unknown"
+
+// metrics of handlers, they are exposed on /metrics of http server with metrics of the service
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// metrics of the service, several services of one process (simulation) don't share registry
+func (s *Service) getMetrics() *metrics {
+	s.metricsOnce.Do(func() {
+		m := &metrics{
+			registry: prometheus.NewRegistry(),
+			requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "saiservice",
+				Name:      "requests_total",
+				Help:      "Requests to handlers of the service.",
+			}, []string{"handler"}),
+			errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "saiservice",
+				Name:      "request_errors_total",
+				Help:      "Requests to handlers of the service, which returned error.",
+			}, []string{"handler"}),
+			duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Namespace: "saiservice",
+				Name:      "request_duration_seconds",
+				Help:      "Time of handling requests by handlers of the service.",
+				Buckets:   prometheus.DefBuckets,
+			}, []string{"handler"}),
+		}
+		m.registry.MustRegister(
+			m.requests,
+			m.errors,
+			m.duration,
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		s.metrics = m
+	})
+	return s.metrics
+}
+
+// record request to the handler
+func (m *metrics) observe(handler string, started time.Time, err error) {
+	m.requests.WithLabelValues(handler).Inc()
+	m.duration.WithLabelValues(handler).Observe(time.Since(started).Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(handler).Inc()
+	}
+}
+
+// MetricsRegistry returns registry of the service metrics, metrics registered in it are exposed on /metrics
+func (s *Service) MetricsRegistry() prometheus.Registerer {
+	return s.getMetrics().registry
+}
+
+// RegisterMetrics adds gauges, counters and other collectors of the service to /metrics
+func (s *Service) RegisterMetrics(collectors ...prometheus.Collector) error {
+	for _, collector := range collectors {
+		err := s.getMetrics().registry.Register(collector)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// http handler of metrics in prometheus format
+func (s *Service) metricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.getMetrics().registry, promhttp.HandlerOpts{})
+}
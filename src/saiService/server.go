@@ -1,6 +1,7 @@
 package saiService
 
 import (
+	"errors"
 	"log"
 	"net"
 	"net/http"
@@ -14,8 +15,11 @@ func (s *Service) StartHttp() {
 	log.Println("Http server has been started:", port)
 
 	http.HandleFunc("/", s.handleHttpConnections)
+	if s.GetConfig("metrics.enabled", true).(bool) {
+		http.Handle("/metrics", s.metricsHandler())
+	}
 
-	err := http.ListenAndServe(":"+strconv.Itoa(port), nil)
+	err := s.serve(&http.Server{Addr: ":" + strconv.Itoa(port)})
 
 	if err != nil {
 		log.Println("Http server error: ", err)
@@ -30,13 +34,26 @@ func (s *Service) StartWS() {
 
 	r.Handle("/ws", websocket.Handler(s.handleWSConnections))
 
-	err := http.ListenAndServe(":"+strconv.Itoa(port), r)
+	err := s.serve(&http.Server{Addr: ":" + strconv.Itoa(port), Handler: r})
 
 	if err != nil {
 		log.Println("WS server error: ", err)
 	}
 }
 
+// server is shut down with the service
+func (s *Service) serve(server *http.Server) error {
+	s.mu.Lock()
+	s.servers = append(s.servers, server)
+	s.mu.Unlock()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
 func (s *Service) StartSocket() {
 	port := s.GetConfig("socket.port", 8000).(int)
 	log.Println("Socket server has been started:", port)
@@ -47,11 +64,22 @@ func (s *Service) StartSocket() {
 		log.Fatalf("networkErr: %v", nErr)
 	}
 
-	conn, cErr := ln.Accept()
+	s.mu.Lock()
+	s.listeners = append(s.listeners, ln)
+	s.mu.Unlock()
 
-	if cErr != nil {
-		log.Fatalf("networkErr: %v", cErr)
-	}
+	for {
+		conn, cErr := ln.Accept()
 
-	s.handleSocketConnections(conn)
+		if cErr != nil {
+			// listener is closed on shutdown
+			if s.Context().Err() != nil {
+				return
+			}
+			log.Printf("networkErr: %v", cErr)
+			continue
+		}
+
+		go s.handleSocketConnections(conn)
+	}
 }
@@ -1,11 +1,18 @@
 package saiService
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
@@ -18,7 +25,19 @@ type Service struct {
 	Handlers      Handler
 	Tasks         []func()
 	InitTask      func()
+	ShutdownTasks []func(ctx context.Context)
 	Logger        *zap.Logger
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	ctxOnce   sync.Once
+	mu        sync.Mutex
+	servers   []*http.Server
+	listeners []net.Listener
+	tasks     sync.WaitGroup
+
+	metricsOnce sync.Once
+	metrics     *metrics // created on first use, every service has own registry
 }
 
 var (
@@ -61,6 +80,27 @@ func (s *Service) RegisterInitTask(initTask func()) {
 	s.InitTask = initTask
 }
 
+// RegisterShutdownTask adds task, which is executed on shutdown after tasks are stopped
+// shutdown tasks are executed in reverse order of registration, ctx is cancelled when shutdown timeout expires
+func (s *Service) RegisterShutdownTask(task func(ctx context.Context)) {
+	s.ShutdownTasks = append(s.ShutdownTasks, task)
+}
+
+// Context is cancelled when the service is stopped (SIGINT, SIGTERM or Stop)
+// tasks should return after it is done
+func (s *Service) Context() context.Context {
+	s.ctxOnce.Do(func() {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	})
+	return s.ctx
+}
+
+// Stop cancels service context, started services are shut down
+func (s *Service) Stop() {
+	s.Context()
+	s.cancel()
+}
+
 func (s *Service) GetConfig(path string, def interface{}) interface{} {
 	steps := strings.Split(path, ".")
 	configuration := s.Configuration
@@ -133,7 +173,20 @@ func (s *Service) ExecuteCommand(path string, data []string, mode string) error
 	return nil
 }
 
+// StartServices starts servers and tasks, it returns after shutdown
 func (s *Service) StartServices() {
+	ctx := s.Context()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Printf("%s got signal %s, shutting down", s.Name, sig)
+			s.Stop()
+		case <-ctx.Done():
+		}
+	}()
 
 	useHttp := s.GetConfig("common.http.enabled", true).(bool)
 	useWS := s.GetConfig("common.ws.enabled", true).(bool)
@@ -150,12 +203,64 @@ func (s *Service) StartServices() {
 
 	log.Printf("%s has been started!", s.Name)
 
-	s.StartSocket()
+	go s.StartSocket()
+
+	<-ctx.Done()
+	signal.Stop(signals)
+	s.Shutdown()
 }
 
 func (s *Service) StartTasks() {
 	for _, task := range s.Tasks {
-		go task()
+		s.tasks.Add(1)
+		go func(task func()) {
+			defer s.tasks.Done()
+			task()
+		}(task)
+	}
+}
+
+// Shutdown closes listeners, waits for tasks and executes shutdown tasks
+// it takes common.shutdown_timeout seconds at most, then shutdown tasks are asked to abort
+func (s *Service) Shutdown() {
+	s.Stop()
+	timeout := time.Duration(s.GetConfig("common.shutdown_timeout", 10).(int)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// new requests are not accepted, running requests are finished
+	s.mu.Lock()
+	listeners := s.listeners
+	servers := s.servers
+	s.mu.Unlock()
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	for _, server := range servers {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			log.Println("Server shutdown error: ", err)
+		}
+	}
+
+	tasksDone := make(chan struct{})
+	go func() {
+		s.tasks.Wait()
+		close(tasksDone)
+	}()
+	select {
+	case <-tasksDone:
+	case <-ctx.Done():
+		log.Println("Tasks were not stopped in shutdown timeout")
+	}
+
+	for i := len(s.ShutdownTasks) - 1; i >= 0; i-- {
+		s.ShutdownTasks[i](ctx)
+	}
+
+	log.Printf("%s has been stopped", s.Name)
+	if s.Logger != nil {
+		s.Logger.Sync()
 	}
 }
 